@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// projectDatabases returns the names of the *.caido files that make up a
+// project's data, which differ between Caido versions. Each may be
+// accompanied by -wal and -shm sidecar files while SQLite has it open.
+func projectDatabases(projectPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(projectPath, "*.caido"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = filepath.Base(m)
+	}
+	return names, nil
+}
+
+// openSidecars returns the -wal and -shm files present in the project. SQLite
+// creates them when a WAL database is opened and removes them when the last
+// connection closes, so they indicate that another process, normally Caido,
+// has the project open, or that one exited without closing it.
+func openSidecars(projectPath string) ([]string, error) {
+	databases, err := projectDatabases(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, name := range databases {
+		for _, file := range []string{name + "-wal", name + "-shm"} {
+			if _, err := os.Stat(filepath.Join(projectPath, file)); err == nil {
+				found = append(found, file)
+			}
+		}
+	}
+	return found, nil
+}
+
+// stagedProject is a copy of a project's databases that an -atomic import
+// writes to before it replaces the originals.
+type stagedProject struct {
+	projectPath string
+	dir         string
+	databases   []string
+}
+
+// stageProject copies the project's databases into a staging directory
+// inside the project, so the final swap is a rename on the same filesystem.
+// Uncheckpointed -wal contents are copied along with each database; -shm
+// files only hold an index that SQLite rebuilds, so they are left behind.
+func stageProject(projectPath string) (*stagedProject, error) {
+	databases, err := projectDatabases(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(projectPath, ".csv-import-stage-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging directory: %v", err)
+	}
+	stage := &stagedProject{projectPath: projectPath, dir: dir, databases: databases}
+
+	for _, name := range databases {
+		for _, file := range []string{name, name + "-wal"} {
+			err := copyFile(filepath.Join(projectPath, file), filepath.Join(dir, file))
+			if os.IsNotExist(err) && file != name {
+				continue
+			}
+			if err != nil {
+				stage.Discard()
+				return nil, fmt.Errorf("error copying %s: %v", file, err)
+			}
+		}
+	}
+	log.Printf("[INFO] Staged project copy in %s", dir)
+	return stage, nil
+}
+
+// Commit replaces the project's databases with the staged copies. The
+// originals, with their sidecar files, are moved to a backup directory in the
+// project. If any rename fails, the files already moved are put back. The
+// staged databases must be closed first.
+func (s *stagedProject) Commit() (backupDir string, err error) {
+	backupDir = filepath.Join(s.projectPath, ".csv-import-backup-"+time.Now().Format("20060102-150405"))
+	if err := os.Mkdir(backupDir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating backup directory: %v", err)
+	}
+
+	type move struct{ from, to string }
+	var done []move
+	rename := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		done = append(done, move{from, to})
+		return nil
+	}
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				log.Printf("[WARN] Failed to restore %s from %s: %v", done[i].from, done[i].to, err)
+			}
+		}
+	}
+
+	for _, name := range s.databases {
+		for _, file := range []string{name, name + "-wal", name + "-shm"} {
+			err := rename(filepath.Join(s.projectPath, file), filepath.Join(backupDir, file))
+			if err != nil && !(os.IsNotExist(err) && file != name) {
+				rollback()
+				return "", fmt.Errorf("error backing up %s: %v", file, err)
+			}
+		}
+		for _, file := range []string{name, name + "-wal"} {
+			err := rename(filepath.Join(s.dir, file), filepath.Join(s.projectPath, file))
+			if err != nil && !(os.IsNotExist(err) && file != name) {
+				rollback()
+				return "", fmt.Errorf("error moving staged %s into place: %v", file, err)
+			}
+		}
+	}
+	s.Discard()
+	return backupDir, nil
+}
+
+// Discard removes the staging directory and anything left in it.
+func (s *stagedProject) Discard() {
+	if err := os.RemoveAll(s.dir); err != nil {
+		log.Printf("[WARN] Failed to remove staging directory %s: %v", s.dir, err)
+	}
+}
+
+// copyFile copies src to dst, syncing dst before returning.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// batch is a transaction grouping the inserts of several rows, used when
+// Options.CommitEvery is set.
+type batch struct {
+	tx   *sql.Tx
+	rows int
+	// inserted counts the rows of the batch that were inserted, as opposed
+	// to failed, and requests those of them that inserted a request.
+	inserted int
+	requests int
+	// lastLine is the line of the last row stored in the batch, recorded
+	// as the progress of -resume when it is committed.
+	lastLine int
+	// stateIDs are the ids of the inserted rows, added to Options.State
+	// when the batch is committed.
+	stateIDs []int64
+	// stmts are the converter's statements from before the batch began.
+	stmts *statements
+	// tracked are the counts of ids tracked before the batch began, which
+	// a rollback restores.
+	tracked map[string]int
+}
+
+// beginBatch opens a transaction for the next rows if batching is enabled
+// and none is open, and binds the prepared statements to it. The
+// transaction ignores cancellation of ctx, so rows inserted before an import
+// is stopped are still committed by commitBatch, as they would be without
+// batching.
+func (c *Converter) beginBatch(ctx context.Context) error {
+	if c.opts.CommitEvery <= 0 || c.batch != nil {
+		return nil
+	}
+	tx, err := c.db.BeginTx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	c.batch = &batch{tx: tx, stmts: c.stmts, tracked: c.tracked()}
+	c.stmts = c.stmts.bind(tx)
+	return nil
+}
+
+// countBatchRow records a row processed in the open batch, committing it
+// once it holds Options.CommitEvery rows. request is whether the row
+// inserted a request, which a standalone response does not.
+func (c *Converter) countBatchRow(inserted, request bool) error {
+	if c.batch == nil {
+		return nil
+	}
+	c.batch.rows++
+	if inserted {
+		c.batch.inserted++
+	}
+	if inserted && request {
+		c.batch.requests++
+	}
+	if c.batch.rows < c.opts.CommitEvery {
+		return nil
+	}
+	return c.commitBatch()
+}
+
+// commitBatch commits the open batch, if any, and restores the unbound
+// statements.
+func (c *Converter) commitBatch() error {
+	if c.batch == nil {
+		return nil
+	}
+	defer addSince(&c.stats.timings.Commits, time.Now())
+	b := c.batch
+	c.batch = nil
+	c.stmts = b.stmts
+	if c.emit != nil {
+		// An -emit-sql dry run leaves the project unchanged.
+		c.debugf("Rolled back %d rows of the dry run", b.rows)
+		return b.tx.Rollback()
+	}
+	if err := c.saveProgress(context.Background(), b.tx, b.lastLine); err != nil {
+		b.tx.Rollback()
+		c.discardBatch(b)
+		return err
+	}
+	if err := b.tx.Commit(); err != nil {
+		c.discardBatch(b)
+		return fmt.Errorf("failed to commit %d rows: %w", b.rows, err)
+	}
+	c.debugf("Committed %d rows", b.rows)
+	if c.opts.State != nil {
+		if err := c.opts.State.record(b.stateIDs); err != nil {
+			return fmt.Errorf("failed to write -state: %w", err)
+		}
+	}
+	return nil
+}
+
+// rollbackBatch rolls back the open batch, if any, and restores the unbound
+// statements. Its inserted rows are counted as failed instead.
+func (c *Converter) rollbackBatch() {
+	b := c.batch
+	if b == nil {
+		return
+	}
+	c.batch = nil
+	c.stmts = b.stmts
+	b.tx.Rollback()
+	if b.inserted > 0 {
+		log.Printf("[WARN] Rolled back %d rows of the uncommitted transaction", b.inserted)
+	}
+	c.discardBatch(b)
+}
+
+// discardBatch accounts for a batch whose rows did not reach the project,
+// because it was rolled back or failed to commit: its ids are no longer
+// tracked and its inserted rows are counted as failed instead.
+func (c *Converter) discardBatch(b *batch) {
+	c.untrack(b.tracked)
+	c.stats.rowsInserted -= b.inserted
+	c.stats.requestsInserted -= b.requests
+	c.stats.rowsFailed += b.inserted
+	if b.inserted > 0 {
+		tally(&c.stats.failReasons, reasonRolledBack, b.inserted)
+	}
+}
+
+// queryer is the part of *sql.DB and *sql.Tx used for one-off statements.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the open batch's transaction, or the database outside a
+// batch. The database has a single connection, which an open transaction
+// holds, so statements during a batch must run on it.
+func (c *Converter) conn() queryer {
+	if c.batch != nil {
+		return c.batch.tx
+	}
+	return c.db
+}
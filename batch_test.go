@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestCommitBatchFailure imports with -commit-every whose last batch fails
+// to commit, on a deferred foreign key violation a trigger adds, which must
+// fail the import and count the batch's rows as failed.
+func TestCommitBatchFailure(t *testing.T) {
+	project := newTestProject(t)
+	db := openTestDB(t, project, "database.caido")
+	for _, query := range []string{
+		"CREATE TABLE commit_guard (request_id INTEGER REFERENCES requests(id) DEFERRABLE INITIALLY DEFERRED)",
+		"CREATE TRIGGER commit_guard AFTER INSERT ON requests WHEN NEW.path = '/3' BEGIN INSERT INTO commit_guard VALUES (-1); END",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewConverter(project, Options{CommitEvery: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	stats, err := c.Import(context.Background(), writeTestFile(t, "batches.csv", preservedCSV(1, 2, 3)), "csv")
+	if err == nil {
+		t.Fatal("the import succeeded although its last batch failed to commit")
+	}
+	if stats.RowsInserted != 2 || stats.FailReasons[reasonRolledBack] != 1 {
+		t.Errorf("inserted %d rows and failed %v, want 2 and 1 %s", stats.RowsInserted, stats.FailReasons, reasonRolledBack)
+	}
+	if got := len(tableIDs(t, db, "requests")); got != 2 {
+		t.Errorf("project has %d requests, want 2", got)
+	}
+}
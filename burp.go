@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// burpFormat is the input format of Converter.Import for Burp Suite's
+// "Save items" XML.
+const burpFormat = "burp-xml"
+
+// burpTimeLayout is the format of an item's <time>, that of Java's
+// Date.toString, e.g. "Mon Jan 02 15:04:05 UTC 2006".
+const burpTimeLayout = "Mon Jan 02 15:04:05 MST 2006"
+
+// burpItem is one <item> of a Burp Suite XML export.
+type burpItem struct {
+	Time      string   `xml:"time"`
+	Host      string   `xml:"host"`
+	Port      string   `xml:"port"`
+	Protocol  string   `xml:"protocol"`
+	Method    string   `xml:"method"`
+	Path      string   `xml:"path"`
+	Extension string   `xml:"extension"`
+	Request   burpData `xml:"request"`
+	Status    string   `xml:"status"`
+	Response  burpData `xml:"response"`
+}
+
+// burpData is the request or response of an item, base64 encoded unless the
+// export was saved without that option.
+type burpData struct {
+	Base64 bool   `xml:"base64,attr"`
+	Data   string `xml:",chardata"`
+}
+
+func (d burpData) decode() ([]byte, error) {
+	if !d.Base64 {
+		return []byte(d.Data), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(d.Data))
+}
+
+// ImportFromBurpXML imports the items of an XML file saved with Burp Suite's
+// "Save items". Rows are numbered by the line their <item> starts on. Like
+// ImportFromCSV, it returns the converter's Stats.
+func (c *Converter) ImportFromBurpXML(ctx context.Context, path string) (Stats, error) {
+	start := time.Now()
+	err := c.importBurpXML(ctx, path)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importBurpXML(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening Burp XML file: %v", err)
+	}
+	defer f.Close()
+	return c.importBurpXMLReader(ctx, f)
+}
+
+// importBurpXMLReader imports the Burp Suite XML read from r.
+func (c *Converter) importBurpXMLReader(ctx context.Context, r io.Reader) error {
+	release, err := c.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	decoder := xml.NewDecoder(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return c.flushPending(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading Burp XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "item" {
+			continue
+		}
+		line, _ := decoder.InputPos()
+		c.stats.rowsRead++
+		var item burpItem
+		if err := decoder.DecodeElement(&item, &start); err != nil {
+			// The rest of the file cannot be read past malformed XML.
+			return fmt.Errorf("error reading Burp XML item on line %d: %v", line, err)
+		}
+		if err := c.importBurpItem(ctx, item, line); err != nil {
+			return err
+		}
+	}
+}
+
+// importBurpItem converts and imports the item starting on line.
+func (c *Converter) importBurpItem(ctx context.Context, item burpItem, line int) error {
+	defer c.recoverRow(line, nil)
+
+	record, err := item.toCSVRecord()
+	if err != nil {
+		log.Printf("Error parsing Burp XML item on line %d: %v", line, err)
+		c.failRow(line, nil, withReason(reasonParse, err))
+		return nil
+	}
+	return c.submit(ctx, record, line)
+}
+
+// toCSVRecord converts the item into a CSVRecord. The path is split into the
+// path and query, and the time, read as burpTimeLayout, is used for both the
+// request and the response. Lengths are those of the messages.
+func (item burpItem) toCSVRecord() (CSVRecord, error) {
+	raw, err := item.Request.decode()
+	if err != nil {
+		return CSVRecord{}, fmt.Errorf("failed to decode request: %w", err)
+	}
+	rawResponse, err := item.Response.decode()
+	if err != nil {
+		return CSVRecord{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	record := CSVRecord{
+		Host:        strings.TrimSpace(item.Host),
+		Method:      strings.TrimSpace(item.Method),
+		Length:      int64(len(raw)),
+		Raw:         raw,
+		IsTLS:       strings.EqualFold(strings.TrimSpace(item.Protocol), "https"),
+		ResponseRaw: rawResponse,
+	}
+	record.ResponseLength = int64(len(rawResponse))
+	record.Path, record.Query, _ = strings.Cut(item.Path, "?")
+	// Burp writes "null" for paths without an extension.
+	if ext := strings.TrimSpace(item.Extension); ext != "" && ext != "null" {
+		record.FileExtensions = "." + ext
+	}
+	if port := strings.TrimSpace(item.Port); port != "" {
+		if record.Port, err = strconv.Atoi(port); err != nil {
+			return CSVRecord{}, fmt.Errorf("invalid port %q", item.Port)
+		}
+	}
+	if status := strings.TrimSpace(item.Status); status != "" {
+		if record.ResponseStatusCode, err = strconv.Atoi(status); err != nil {
+			return CSVRecord{}, fmt.Errorf("invalid status %q", item.Status)
+		}
+	}
+	created := time.Now()
+	if t := strings.TrimSpace(item.Time); t != "" {
+		if created, err = time.Parse(burpTimeLayout, t); err != nil {
+			return CSVRecord{}, fmt.Errorf("invalid time %q: %v", item.Time, err)
+		}
+	}
+	record.CreatedAt = created.UnixMilli()
+	record.ResponseCreatedAt = record.CreatedAt
+	return record, nil
+}
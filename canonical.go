@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// hostAliases maps host names to the canonical names -canonical-host stores
+// them as. Keys are lowercase, without a trailing dot; a key starting with
+// "*." matches every subdomain of the rest, but not the rest itself.
+type hostAliases map[string]string
+
+// parseHostAliases parses a -canonical-host value: comma-separated
+// alias=canonical rules, or the path of a file of such rules, one per line,
+// as read by readMapping.
+func parseHostAliases(value string) (hostAliases, error) {
+	rules := make(map[string]string)
+	if _, err := os.Stat(value); err == nil {
+		if rules, err = readMapping(value); err != nil {
+			return nil, err
+		}
+	} else if strings.Contains(value, "=") {
+		for _, rule := range strings.Split(value, ",") {
+			alias, canonical, found := strings.Cut(rule, "=")
+			if !found {
+				return nil, fmt.Errorf("expected alias=canonical, got %q", rule)
+			}
+			rules[strings.TrimSpace(alias)] = strings.TrimSpace(canonical)
+		}
+	} else {
+		return nil, fmt.Errorf("not a file or a list of alias=canonical rules")
+	}
+
+	aliases := make(hostAliases, len(rules))
+	for alias, canonical := range rules {
+		if alias == "" || canonical == "" || strings.Contains(canonical, "*") {
+			return nil, fmt.Errorf("invalid rule %s=%s", alias, canonical)
+		}
+		aliases[strings.TrimRight(strings.ToLower(alias), ".")] = canonical
+	}
+	return aliases, nil
+}
+
+// canonical returns the canonical name of host, keeping any port, or host
+// unchanged if no rule matches it. An exact rule wins over a wildcard, and a
+// longer wildcard over a shorter one.
+func (a hostAliases) canonical(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	canonical, ok := matchHost(a, name)
+	if !ok {
+		return host
+	}
+	if port != "" {
+		return net.JoinHostPort(canonical, port)
+	}
+	return canonical
+}
+
+// matchHost looks up the value of the rule matching a host name without a
+// port, in rules keyed like hostAliases. An exact rule wins over a wildcard,
+// and a longer wildcard over a shorter one.
+func matchHost(rules map[string]string, name string) (string, bool) {
+	key := strings.TrimRight(strings.ToLower(name), ".")
+	value, ok := rules[key]
+	for rest := key; !ok; {
+		i := strings.IndexByte(rest, '.')
+		if i == -1 {
+			return "", false
+		}
+		rest = rest[i+1:]
+		value, ok = rules["*."+rest]
+	}
+	return value, true
+}
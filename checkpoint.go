@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// checkpoint runs a passive WAL checkpoint once Options.CheckpointEvery rows
+// have been processed since the last one, copying committed pages back into
+// the databases so the WALs do not keep growing during a long import. A
+// passive checkpoint never waits for readers such as Caido; pages they still
+// need are left for the next one. Rows in an open -commit-every batch are not
+// in the database yet, so the checkpoint waits until the batch is committed.
+func (c *Converter) checkpoint(ctx context.Context) {
+	if c.opts.CheckpointEvery <= 0 {
+		return
+	}
+	c.sinceCheckpoint++
+	if c.sinceCheckpoint < c.opts.CheckpointEvery || c.batch != nil {
+		return
+	}
+	c.sinceCheckpoint = 0
+	defer addSince(&c.stats.timings.Checkpoints, time.Now())
+
+	schemas := c.schema.schemas()
+	for _, schema := range schemas {
+		// busy is 1 if the checkpoint could not finish; pages and
+		// checkpointed are the WAL's size and how much of it is now in the
+		// database, or -1 if the database is not in WAL mode.
+		var busy, pages, checkpointed int
+		err := c.db.QueryRowContext(ctx, "PRAGMA "+schema+".wal_checkpoint(PASSIVE)").Scan(&busy, &pages, &checkpointed)
+		if err != nil {
+			log.Printf("[WARN] Failed to checkpoint %s: %v", schema, err)
+			continue
+		}
+		c.debugf("Checkpointed %s: %d of %d WAL pages (busy=%d)", schema, checkpointed, pages, busy)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readKey resolves a -key value of the form env:NAME or file:PATH, so the key
+// itself never appears on the command line.
+func readKey(spec string) (string, error) {
+	kind, value, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "env":
+		key := os.Getenv(value)
+		if key == "" {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return key, nil
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("key must be given as env:NAME or file:PATH")
+	}
+}
+
+// quoteSQLString quotes s as an SQL string literal.
+func quoteSQLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
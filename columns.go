@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// columnField describes a column of the input: its -spec type, the
+// CSVRecord field it is parsed into, where that ends up in the project, and
+// what it holds. Optional columns are recognized by name only; the others
+// make up the positional (v1) layout, in order. -print-fields lists them.
+type columnField struct {
+	name     string
+	typ      string
+	optional bool
+	field    string
+	stored   string
+	desc     string
+}
+
+// columnFields are the columns of the input, in the order of the positional
+// (v1) layout produced by Caido's HTTP history export followed by the
+// optional columns.
+var columnFields = []columnField{
+	{"id", SpecInt, false, "ID", "-", "id of the request where it was exported; checked by -unique-id and -state, kept by -preserve-ids"},
+	{"host", SpecString, false, "Host", "requests.host", "host the request was sent to"},
+	{"method", SpecString, false, "Method", "requests.method", "request method, uppercased"},
+	{"path", SpecString, false, "Path", "requests.path", "path of the request target"},
+	{"length", SpecInt, false, "Length", "requests.length", "size of the raw request"},
+	{"port", SpecInt, false, "Port", "requests.port", "port the request was sent to"},
+	{"raw", SpecBase64, false, "Raw", "requests_raw.data", "raw request, encoded as -raw-encoding says"},
+	{"is_tls", SpecBool, false, "IsTLS", "requests.is_tls", "whether the request was sent over TLS"},
+	{"query", SpecString, false, "Query", "requests.query", "query string, without the ?"},
+	{"file_extensions", SpecString, false, "FileExtensions", "requests.file_extension", "file extension of the path, e.g. .js; see -extension-source and -store-extensions"},
+	{"source", SpecString, false, "Source", "requests.source", "tool the request came from"},
+	{"alteration", SpecString, false, "Alteration", "requests.alteration", "how the request was altered"},
+	{"edited", SpecBool, false, "Edited", "requests.edited", "whether the request was edited"},
+	{"parent_id", SpecInt, false, "ParentID", "requests.parent_id", "id of the request this one was derived from; see -remap-parents"},
+	{"created_at", SpecInt, false, "CreatedAt", "requests.created_at", "time the request was made, in milliseconds since the epoch"},
+	{"response_id", SpecInt, false, "ResponseID", "-", "id of the response where it was exported; kept by -preserve-ids"},
+	{"response_status_code", SpecInt, false, "ResponseStatusCode", "responses.status_code", "status code of the response"},
+	{"response_raw", SpecBase64, false, "ResponseRaw", "responses_raw.data", "raw response, encoded as -raw-encoding says"},
+	{"response_length", SpecInt, false, "ResponseLength", "responses.length", "size of the raw response"},
+	{"response_alteration", SpecString, false, "ResponseAlteration", "responses.alteration", "how the response was altered"},
+	{"response_edited", SpecBool, false, "ResponseEdited", "responses.edited", "whether the response was edited"},
+	{"response_parent_id", SpecInt, false, "ResponseParentID", "responses.parent_id", "id of the response this one was derived from; see -remap-parents"},
+	{"response_created_at", SpecInt, false, "ResponseCreatedAt", "responses.created_at", "time the response was received, in milliseconds since the epoch"},
+	{"intercept", SpecBool, true, "Intercept", "intercept_entries", "false to import the row without an intercept entry"},
+	{"intercept_position", SpecInt, true, "InterceptPosition", "intercept_entries.position", "position of the entry, counted from the end of the queue"},
+	{"url", SpecString, true, "Raw", "requests_raw.data", "absolute URL to build a minimal request from, instead of raw"},
+	{"request_headers", SpecString, true, "Raw", "requests_raw.data", "request line and headers, instead of raw"},
+	{"request_body", SpecBase64, true, "Raw", "requests_raw.data", "request body to go with request_headers"},
+	{"response_headers", SpecString, true, "ResponseRaw", "responses_raw.data", "status line and headers, instead of response_raw"},
+	{"response_body", SpecBase64, true, "ResponseRaw", "responses_raw.data", "response body to go with response_headers"},
+	{"request_sent_at", SpecInt, true, "RequestSentAt", "responses.roundtrip_time", "time the request was sent, in milliseconds since the epoch"},
+	{"response_received_at", SpecInt, true, "ResponseReceivedAt", "responses.roundtrip_time", "time the response was received, in milliseconds since the epoch"},
+	{"roundtrip_time", SpecInt, true, "RoundtripTime", "responses.roundtrip_time", "latency of the response in milliseconds"},
+}
+
+// csvColumns lists the canonical column names in the order of the
+// positional (v1) layout, and optionalColumns those recognized by name in
+// addition to them. In v2 optional columns may appear anywhere; in v1 they
+// may follow the positional columns.
+var (
+	csvColumns      = columnNames(false)
+	optionalColumns = columnNames(true)
+)
+
+// columnNames returns the names of the optional or positional columnFields.
+func columnNames(optional bool) []string {
+	var names []string
+	for _, c := range columnFields {
+		if c.optional == optional {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// printFields writes the columnFields to w as a table, for -print-fields.
+func printFields(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLUMN\tTYPE\tV1\tFIELD\tSTORED IN\tDESCRIPTION")
+	for i, c := range columnFields {
+		position := "optional"
+		if !c.optional {
+			position = strconv.Itoa(i + 1)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.name, c.typ, position, c.field, c.stored, c.desc)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nV1 is the position of a column in v1 files, which must have all %d positional columns; optional columns follow them. In v2 files and with -columns, columns may come in any order and any may be left out.\n", len(csvColumns))
+	return err
+}
+
+// messageFromColumns returns the raw message of a row: raw as decoded from its
+// raw column, or, when that is blank, the message assembled from the row's
+// separate head and body columns, with the body decoded like raw. Giving both
+// is an error. kind names the message in errors.
+func messageFromColumns(raw []byte, head, body string, encoding, kind string) ([]byte, error) {
+	if strings.TrimSpace(head) == "" && body == "" {
+		return raw, nil
+	}
+	if len(raw) > 0 {
+		return nil, fmt.Errorf("%s has both a raw column and %s_headers or %s_body", kind, kind, kind)
+	}
+	if strings.TrimSpace(head) == "" {
+		return nil, fmt.Errorf("%s_body is given without %s_headers", kind, kind)
+	}
+	decoded, err := decodeRaw(body, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s_body: %w", kind, err)
+	}
+	message, err := assembleHTTPMessage(head, decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble raw %s: %w", kind, err)
+	}
+	return message, nil
+}
+
+// columnLayout maps a canonical column name to its index in a CSV row.
+// Columns missing from the layout are parsed as blank.
+type columnLayout map[string]int
+
+// width returns the number of fields a row needs to hold every column in the
+// layout. Optional columns may be missing from a row, so they do not count.
+func (l columnLayout) width() int {
+	width := 0
+	for _, name := range csvColumns {
+		if i, ok := l[name]; ok && i+1 > width {
+			width = i + 1
+		}
+	}
+	return width
+}
+
+// names returns the canonical name of the column at each index of a row of
+// n fields, or "" where the layout has none. These are the columns an error
+// report records, so that a retried row is read by name into the same fields
+// whatever the layout of its file was.
+func (l columnLayout) names(n int) []string {
+	for _, i := range l {
+		n = max(n, i+1)
+	}
+	names := make([]string, n)
+	for name, i := range l {
+		names[i] = name
+	}
+	return names
+}
+
+// positionalLayout returns the v1 layout, where every column is at its
+// position in csvColumns regardless of the header row. Optional columns named
+// in the header after the positional ones are included too.
+func positionalLayout(header []string) columnLayout {
+	layout := make(columnLayout, len(csvColumns))
+	for i, name := range csvColumns {
+		layout[name] = i
+	}
+	for i := len(csvColumns); i < len(header); i++ {
+		name := strings.ToLower(strings.TrimSpace(header[i]))
+		for _, optional := range optionalColumns {
+			if name == optional {
+				layout[name] = i
+			}
+		}
+	}
+	return layout
+}
+
+// headerLayout builds a layout from the names in a header row, as used by the
+// v2 format. Names are matched case-insensitively and unknown names are
+// ignored.
+func headerLayout(header []string) columnLayout {
+	known := make(map[string]bool, len(csvColumns)+len(optionalColumns))
+	for _, name := range append(csvColumns, optionalColumns...) {
+		known[name] = true
+	}
+	layout := make(columnLayout)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if known[name] {
+			layout[name] = i
+		}
+	}
+	return layout
+}
+
+// requestFromURL fills in the request of a record given as a url column
+// instead of a raw request: the host, port, TLS flag, path and query are
+// taken from the URL where their columns are blank, and a minimal request
+// with the record's method, GET by default, is synthesized. The fragment is
+// dropped.
+func requestFromURL(record *CSVRecord, rawURL string) error {
+	if len(record.Raw) > 0 {
+		return fmt.Errorf("row has both a raw request and a url")
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid url %q: must be an absolute http or https URL", rawURL)
+	}
+	if record.Host == "" {
+		record.Host = u.Hostname()
+	}
+	if record.Port == 0 {
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			record.Port = port
+		}
+	}
+	record.IsTLS = record.IsTLS || u.Scheme == "https"
+	if record.Path == "" {
+		record.Path = u.EscapedPath()
+		if record.Path == "" {
+			record.Path = "/"
+		}
+	}
+	if record.Query == "" {
+		record.Query = u.RawQuery
+	}
+	if record.Method == "" {
+		record.Method = "GET"
+	}
+
+	target := record.Path
+	if record.Query != "" {
+		target += "?" + record.Query
+	}
+	record.Raw = []byte(fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\n\r\n", record.Method, target, u.Host))
+	return nil
+}
+
+// withStatusLine returns the head of a response given as a response_headers
+// column, starting it with a status line for status when it has none. A
+// blank head becomes the status line alone.
+func withStatusLine(head string, status int) string {
+	if status == 0 || strings.HasPrefix(strings.TrimSpace(head), "HTTP/") {
+		return head
+	}
+	return fmt.Sprintf("HTTP/1.1 %d %s\r\n", status, http.StatusText(status)) + strings.TrimLeft(head, "\r\n")
+}
+
+// unknownColumns returns the names in a header row that are not column
+// names, each with its position, for Options.StrictColumns.
+func unknownColumns(header []string) []string {
+	known := make(map[string]bool, len(csvColumns)+len(optionalColumns))
+	for _, name := range append(csvColumns, optionalColumns...) {
+		known[name] = true
+	}
+	var unknown []string
+	for i, name := range header {
+		if !known[strings.ToLower(strings.TrimSpace(name))] {
+			unknown = append(unknown, fmt.Sprintf("%q (column %d)", name, i+1))
+		}
+	}
+	return unknown
+}
+
+// missing reports whether the layout has no column called name.
+func (l columnLayout) missing(name string) bool {
+	_, ok := l[name]
+	return !ok
+}
+
+// fillMissingColumns fills in the fields of columns absent from the layout,
+// so a v2 file can be as small as a raw column. Host, method, path and query
+// are taken from the raw request when any of them is absent, the port and TLS
+// flag from an absolute-form target or the Host header, and lengths from the
+// raw messages. Missing created_at columns default to the current time. A
+// row without a raw response gets an empty one with status 0. Blank values in
+// columns that are present are left alone, except for the query.
+func fillMissingColumns(record *CSVRecord, layout columnLayout) error {
+	if layout.missing("host") || layout.missing("method") || layout.missing("path") || layout.missing("query") {
+		if err := deriveFromRaw(record); err != nil {
+			return fmt.Errorf("failed to derive missing columns: %w", err)
+		}
+	}
+	if record.Query == "" && len(record.Raw) > 0 {
+		// Unlike the other columns, a blank query is filled in too, as
+		// exports often leave it out of requests that have one.
+		record.Query = queryFromRaw(record.Raw)
+	}
+	if layout.missing("port") && record.Port == 0 && len(record.Raw) > 0 {
+		if msg, err := parseHTTPMessage(record.Raw); err == nil {
+			if hostHeader, ok := msg.Header("Host"); ok {
+				_, record.Port = splitHostPort(strings.TrimSpace(hostHeader))
+			}
+		}
+	}
+	if layout.missing("is_tls") && record.Port == 443 {
+		record.IsTLS = true
+	}
+	if layout.missing("length") {
+		record.Length = int64(len(record.Raw))
+	}
+	if layout.missing("response_length") {
+		record.ResponseLength = int64(len(record.ResponseRaw))
+	}
+	if layout.missing("created_at") {
+		record.CreatedAt = time.Now().UnixMilli()
+	}
+	if layout.missing("response_created_at") && len(record.ResponseRaw) > 0 {
+		record.ResponseCreatedAt = record.CreatedAt
+	}
+	return nil
+}
+
+// queryFromRaw returns the query string of a raw request's target, as sent,
+// with repeated parameters kept and without any fragment. It is empty if the
+// request cannot be parsed.
+func queryFromRaw(raw []byte) string {
+	msg, err := parseHTTPMessage(raw)
+	if err != nil {
+		return ""
+	}
+	method, target, _, err := parseRequestLine(msg.StartLine)
+	if err != nil {
+		return ""
+	}
+	rt, err := parseRequestTarget(method, target)
+	if err != nil {
+		return ""
+	}
+	return rt.Query
+}
+
+// explicitLayout builds a layout from the column names given with -columns,
+// in file order. A blank name or "-" skips the column at that position. It
+// reports unknown and repeated names.
+func explicitLayout(names []string) (columnLayout, error) {
+	known := make(map[string]bool, len(csvColumns)+len(optionalColumns))
+	for _, name := range append(csvColumns, optionalColumns...) {
+		known[name] = true
+	}
+	layout := make(columnLayout)
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "-" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := layout[name]; dup {
+			return nil, fmt.Errorf("column %q given twice", name)
+		}
+		layout[name] = i
+	}
+	if len(layout) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	return layout, nil
+}
+
+// isHeaderFor reports whether row is a header naming the columns of an
+// explicit layout, so a file with a header can be read with -columns too.
+// Skipped columns may have any name.
+func isHeaderFor(row []string, names []string) bool {
+	if len(row) != len(names) {
+		return false
+	}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "-" {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(row[i]), name) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatPrefix starts the optional line declaring a CSV's format version,
+// e.g. "#caido-csv v2". The version may be followed by key=value attributes,
+// of which only sourceAttribute is understood.
+const formatPrefix = "#caido-csv"
+
+// CSV format versions understood by the importer. Files without a version
+// line are treated as v1.
+const (
+	formatV1 = "v1" // Fixed positional columns, header row ignored.
+	formatV2 = "v2" // Columns identified by name in the header row.
+)
+
+// readFormatVersion consumes the format version line from r if present and
+// returns the declared version, defaulting to v1, and the source project
+// identifier it names, if any, along with the number of lines consumed.
+func readFormatVersion(r *bufio.Reader) (version, source string, lines int, err error) {
+	peek, _ := r.Peek(len(formatPrefix))
+	if string(peek) != formatPrefix {
+		return formatV1, "", 0, nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", "", 0, fmt.Errorf("error reading format version line: %v", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != formatPrefix {
+		return "", "", 0, fmt.Errorf("malformed format version line %q", strings.TrimSpace(line))
+	}
+	for _, attr := range fields[2:] {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			return "", "", 0, fmt.Errorf("malformed format version line %q", strings.TrimSpace(line))
+		}
+		if key == sourceAttribute {
+			source = value
+		}
+	}
+	switch version := fields[1]; version {
+	case formatV1, formatV2:
+		return version, source, 1, nil
+	default:
+		return "", "", 0, fmt.Errorf("unsupported CSV format version %q (supported: %s, %s)", version, formatV1, formatV2)
+	}
+}
+
+// layoutFor returns the column layout for a format version and header row.
+func layoutFor(version string, header []string) columnLayout {
+	if version == formatV2 {
+		return headerLayout(header)
+	}
+	return positionalLayout(header)
+}
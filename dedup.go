@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+)
+
+// Defaults of Options.DedupExpected and DedupFPRate.
+const (
+	defaultDedupExpected = 1000000
+	defaultDedupFPRate   = 0.001
+)
+
+// bloomFilter is a set of request hashes that can answer "maybe present" for
+// a hash that was never added, at a rate set when it is created, but never
+// "absent" for one that was. Its size does not grow with what is added.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    int
+	// added counts the hashes added, and expected is the count the filter
+	// was sized for.
+	added    int
+	expected int
+}
+
+// newBloomFilter sizes a filter to hold n hashes with a false positive rate
+// of p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: max(k, 1), expected: n}
+}
+
+// positions calls fn with each bit of sum, derived by double hashing from
+// two halves of the SHA-256.
+func (b *bloomFilter) positions(sum [sha256.Size]byte, fn func(bit uint64) bool) {
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	for i := 0; i < b.k; i++ {
+		if !fn((h1 + uint64(i)*h2) % b.m) {
+			return
+		}
+	}
+}
+
+func (b *bloomFilter) add(sum [sha256.Size]byte) {
+	b.positions(sum, func(bit uint64) bool {
+		b.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+	b.added++
+	if b.added == b.expected+1 {
+		log.Printf("[WARN] -dedup has seen more than %d requests, so suspected duplicates will be confirmed more often; raise -dedup-expected", b.expected)
+	}
+}
+
+// has reports whether sum may have been added.
+func (b *bloomFilter) has(sum [sha256.Size]byte) bool {
+	found := true
+	b.positions(sum, func(bit uint64) bool {
+		found = b.bits[bit/64]&(1<<(bit%64)) != 0
+		return found
+	})
+	return found
+}
+
+// loadDedup fills the bloom filter of Options.Dedup with the hashes of the
+// project's requests, streaming them so that memory use is that of the
+// filter alone.
+func (c *Converter) loadDedup(ctx context.Context) error {
+	c.dedup = newBloomFilter(c.opts.DedupExpected, c.opts.DedupFPRate)
+	if err := c.eachRequestHash(ctx, c.dedup.add); err != nil {
+		return err
+	}
+	log.Printf("[INFO] Skipping requests already in the project, %d so far, with a %.1f MiB bloom filter", c.dedup.added, float64(len(c.dedup.bits)*8)/(1<<20))
+	return nil
+}
+
+// checkDedup skips a normalized record whose request is already in the
+// project, including one inserted earlier in the run, with Options.Dedup.
+// The bloom filter rules most records out; the ones it suspects are looked
+// up in the project, so a row is only skipped when its request is there.
+func (c *Converter) checkDedup(ctx context.Context, record CSVRecord, line int) (skip bool, err error) {
+	if c.dedup == nil {
+		return false, nil
+	}
+	sum := requestHash(record.Host, record.Port, record.IsTLS, record.Raw)
+	if !c.dedup.has(sum) {
+		// Added before the insert, which at worst leaves a hash whose
+		// suspects are looked up in vain.
+		c.dedup.add(sum)
+		return false, nil
+	}
+	c.stats.dedupSuspected++
+	query := fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT 1 FROM requests r JOIN %s.requests_raw rr ON rr.id = r.raw_id
+			WHERE r.host = ? AND r.port = ? AND r.is_tls = ? AND rr.data = ?
+		)`, c.schema.rawSchema)
+	var present bool
+	if err := c.conn().QueryRowContext(ctx, query, record.Host, record.Port, record.IsTLS, record.Raw).Scan(&present); err != nil {
+		return false, fmt.Errorf("failed to look up a duplicate request: %w", err)
+	}
+	if !present {
+		return false, nil
+	}
+	c.debugf("Line %d: request to %s is already in the project", line, record.Host)
+	c.skipRows(reasonDuplicateRequest, 1)
+	return true, nil
+}
+
+// logDedup reports how many of the rows the bloom filter suspected were
+// duplicates.
+func (c *Converter) logDedup() {
+	if c.dedup == nil || c.stats.dedupSuspected == 0 {
+		return
+	}
+	confirmed := c.stats.skipReasons[reasonDuplicateRequest]
+	log.Printf("[INFO] -dedup looked up %d suspected duplicates: %d were in the project, %d were false positives", c.stats.dedupSuspected, confirmed, c.stats.dedupSuspected-confirmed)
+}
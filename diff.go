@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+)
+
+// requestHash identifies a request by its destination and raw bytes, the
+// parts Caido uses to replay it.
+func requestHash(host string, port int, isTLS bool, raw []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(host))
+	h.Write([]byte{0})
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(port))
+	if isTLS {
+		buf[8] = 1
+	}
+	h.Write(buf[:])
+	h.Write(raw)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// eachRequestHash calls fn with the requestHash of every request already in
+// the project, streaming them so that only fn decides what is kept.
+func (c *Converter) eachRequestHash(ctx context.Context, fn func(sum [sha256.Size]byte)) error {
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT r.host, r.port, r.is_tls, rr.data
+		FROM requests r JOIN %s.requests_raw rr ON rr.id = r.raw_id`, c.schema.rawSchema))
+	if err != nil {
+		return fmt.Errorf("failed to query requests: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			host  string
+			port  int
+			isTLS bool
+			raw   []byte
+		)
+		if err := rows.Scan(&host, &port, &isTLS, &raw); err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+		fn(requestHash(host, port, isTLS, raw))
+	}
+	return rows.Err()
+}
+
+// loadExistingHashes reads the hash of every request already in the project,
+// turning the converter into one that only compares records against them;
+// see countDiff.
+func (c *Converter) loadExistingHashes(ctx context.Context) error {
+	c.existing = make(map[[sha256.Size]byte]bool)
+	if err := c.eachRequestHash(ctx, func(sum [sha256.Size]byte) {
+		c.existing[sum] = true
+	}); err != nil {
+		return err
+	}
+	c.validateOnly = true
+	return nil
+}
+
+// countDiff records whether a normalized record is already in the project.
+func (c *Converter) countDiff(record CSVRecord) {
+	if c.existing[requestHash(record.Host, record.Port, record.IsTLS, record.Raw)] {
+		c.stats.rowsPresent++
+	} else {
+		c.stats.rowsNew++
+	}
+}
+
+// runDiff reports how many rows of the input are already in the project,
+// without inserting anything. Rows are normalized with opts first, so the
+// comparison matches what an import with the same options would store.
+func runDiff(projectPath, path, format string, opts Options) {
+	converter, err := NewConverter(projectPath, opts)
+	if err != nil {
+		log.Fatalf("Failed to initialize converter: %v", err)
+	}
+	defer converter.Close()
+
+	ctx := context.Background()
+	if err := converter.loadExistingHashes(ctx); err != nil {
+		log.Fatalf("Failed to read project requests: %v", err)
+	}
+	log.Printf("[INFO] Comparing %s with %d requests in the project", path, len(converter.existing))
+
+	stats, err := converter.Import(ctx, path, format)
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+	fmt.Printf("%d new, %d already present (%d invalid, %d skipped)\n", stats.RowsNew, stats.RowsPresent, stats.RowsFailed, stats.RowsSkipped)
+}
@@ -0,0 +1,78 @@
+//go:build !purego
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the database/sql driver name. The default build uses the
+// cgo driver, which bundles SQLite; see driver_purego.go for the alternative.
+const sqliteDriver = "sqlite3"
+
+// dsnParams configures each connection to cooperate with a running Caido
+// instance: WAL journaling, waiting on locks instead of failing immediately,
+// and foreign key enforcement.
+const dsnParams = "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+
+// keyedConnector opens SQLCipher connections. The key has to be the first
+// statement run on a connection, before the pragmas normally set via the DSN,
+// so those are applied from the connect hook instead.
+type keyedConnector struct {
+	driver *sqlite3.SQLiteDriver
+	path   string
+}
+
+func (k keyedConnector) Connect(context.Context) (driver.Conn, error) {
+	return k.driver.Open(k.path)
+}
+
+func (k keyedConnector) Driver() driver.Driver {
+	return k.driver
+}
+
+// openKeyedDB opens the encrypted database at path with key. It fails if this
+// binary's SQLite was not built with SQLCipher, since the key would otherwise
+// be silently ignored.
+func openKeyedDB(path, key string) (*sql.DB, error) {
+	hook := func(conn *sqlite3.SQLiteConn) error {
+		for _, stmt := range []string{
+			"PRAGMA key = " + quoteSQLString(key),
+			"PRAGMA journal_mode = WAL",
+			"PRAGMA busy_timeout = 5000",
+			"PRAGMA foreign_keys = ON",
+		} {
+			if _, err := conn.Exec(stmt, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	db := sql.OpenDB(keyedConnector{driver: &sqlite3.SQLiteDriver{ConnectHook: hook}, path: path})
+
+	var cipherVersion string
+	if err := db.QueryRow("PRAGMA cipher_version").Scan(&cipherVersion); err != nil || cipherVersion == "" {
+		db.Close()
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("this build does not support encrypted projects; rebuild against SQLCipher")
+	}
+	return db, nil
+}
+
+// sqliteErrorCode returns the primary SQLite result code of err, if it
+// comes from SQLite.
+func sqliteErrorCode(err error) (int, bool) {
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	return int(e.Code), true
+}
@@ -0,0 +1,36 @@
+//go:build purego
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver name. Building with -tags purego
+// uses modernc.org/sqlite, a translation of SQLite to Go that needs no C
+// toolchain, so the importer can be cross-compiled with CGO_ENABLED=0.
+const sqliteDriver = "sqlite"
+
+// dsnParams configures each connection to cooperate with a running Caido
+// instance: WAL journaling, waiting on locks instead of failing immediately,
+// and foreign key enforcement.
+const dsnParams = "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+
+// openKeyedDB always fails: modernc.org/sqlite has no SQLCipher support.
+func openKeyedDB(path, key string) (*sql.DB, error) {
+	return nil, fmt.Errorf("this build does not support encrypted projects; rebuild without -tags purego against SQLCipher")
+}
+
+// sqliteErrorCode returns the primary SQLite result code of err, if it
+// comes from SQLite.
+func sqliteErrorCode(err error) (int, bool) {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	return e.Code() & 0xff, true
+}
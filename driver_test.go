@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestImportDriver imports a generated CSV with the SQLite driver the build
+// selects. Run it both as `go test` and as `go test -tags purego` to cover
+// the cgo and the pure-Go driver with the same import.
+func TestImportDriver(t *testing.T) {
+	const rows = 200
+	t.Logf("driver %q", sqliteDriver)
+
+	path := filepath.Join(t.TempDir(), "gen.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generateCSV(f, rows, 64); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	project := newTestProject(t)
+	stats := importTestCSV(t, project, path, Options{})
+	if stats.RowsInserted != rows {
+		t.Fatalf("inserted %d rows, want %d (failed %d)", stats.RowsInserted, rows, stats.RowsFailed)
+	}
+
+	db := openTestDB(t, project, "database.caido")
+	for _, table := range []string{"requests", "responses"} {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != rows {
+			t.Errorf("%s has %d rows, want %d", table, n, rows)
+		}
+	}
+
+	// The raw tables must hold the bytes of the input, in input order.
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, c := range []struct {
+		table  string
+		column int
+	}{
+		{"requests_raw", 6},
+		{"responses_raw", 17},
+	} {
+		blobs := rawBlobs(t, raw, c.table)
+		if len(blobs) != rows {
+			t.Fatalf("%s has %d rows, want %d", c.table, len(blobs), rows)
+		}
+		for i, record := range records[1:] {
+			want, err := base64.StdEncoding.DecodeString(record[c.column])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(blobs[i], want) {
+				t.Fatalf("%s row %d differs from line %d of the input", c.table, i+1, i+2)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlEmitter writes the statements of an -emit-sql dry run as literal SQL.
+// Statements run inside a savepoint are held until the outermost one is
+// released, so those of a row that failed and was rolled back are left out.
+type sqlEmitter struct {
+	w       *bufio.Writer
+	pending []string
+	depth   int
+	err     error
+}
+
+// newSQLEmitter starts a script applying the import to the project opened by
+// c: it attaches the databases the raw tables are in, under the names the
+// statements use, and opens a transaction.
+func (c *Converter) newSQLEmitter(ctx context.Context, w io.Writer, input string) (*sqlEmitter, error) {
+	e := &sqlEmitter{w: bufio.NewWriter(w)}
+	fmt.Fprintf(e.w, "-- Import of %s into %s, written by caido-importer -emit-sql on %s.\n", input, c.projectPath, time.Now().Format(time.RFC3339))
+	fmt.Fprintln(e.w, "-- Ids are those the project assigns as of then, so apply it to the project unchanged.")
+
+	rows, err := c.db.QueryContext(ctx, "SELECT name, file FROM pragma_database_list WHERE name NOT IN ('main', 'temp')")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attached databases: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, file string
+		if err := rows.Scan(&name, &file); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(e.w, "ATTACH DATABASE %s AS %s;\n", quoteSQLString(file), name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(e.w, "BEGIN;")
+	return e, nil
+}
+
+// statement records query as run with args. It does nothing on a nil
+// emitter, so callers need not check whether SQL is being emitted.
+func (e *sqlEmitter) statement(query string, args []any) {
+	if e == nil {
+		return
+	}
+	text, err := renderSQL(query, args)
+	if err != nil {
+		if e.err == nil {
+			e.err = err
+		}
+		return
+	}
+	if e.depth == 0 {
+		e.w.WriteString(text + ";\n")
+		return
+	}
+	e.pending = append(e.pending, text)
+}
+
+// begin marks the start of a savepoint, returning what end needs to discard
+// its statements.
+func (e *sqlEmitter) begin() int {
+	if e == nil {
+		return 0
+	}
+	e.depth++
+	return len(e.pending)
+}
+
+// end marks the end of the savepoint begin returned mark for, dropping its
+// statements unless it was released.
+func (e *sqlEmitter) end(mark int, released bool) {
+	if e == nil {
+		return
+	}
+	e.depth--
+	if !released {
+		e.pending = e.pending[:mark]
+	}
+	if e.depth > 0 {
+		return
+	}
+	for _, text := range e.pending {
+		e.w.WriteString(text + ";\n")
+	}
+	e.pending = e.pending[:0]
+}
+
+// close ends the script and flushes it.
+func (e *sqlEmitter) close() error {
+	e.w.WriteString("COMMIT;\n")
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	return e.err
+}
+
+// renderSQL returns query, on one line, with its ? placeholders replaced by
+// args as SQL literals. Blobs are written as hex literals, so they survive
+// any bytes they contain.
+func renderSQL(query string, args []any) (string, error) {
+	parts := strings.Split(strings.Join(strings.Fields(query), " "), "?")
+	if len(parts) != len(args)+1 {
+		return "", fmt.Errorf("statement %q has %d placeholders for %d arguments", query, len(parts)-1, len(args))
+	}
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for i, arg := range args {
+		value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return "", err
+		}
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("NULL")
+		case int64:
+			b.WriteString(strconv.FormatInt(v, 10))
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			if v {
+				b.WriteString("1")
+			} else {
+				b.WriteString("0")
+			}
+		case string:
+			b.WriteString(quoteSQLString(v))
+		case []byte:
+			// SQLite binds a nil blob as NULL.
+			if v == nil {
+				b.WriteString("NULL")
+			} else {
+				b.WriteString("X'" + hex.EncodeToString(v) + "'")
+			}
+		default:
+			return "", fmt.Errorf("cannot write %T as an SQL literal", value)
+		}
+		b.WriteString(parts[i+1])
+	}
+	return b.String(), nil
+}
+
+// runEmitSQL performs a dry run of the import, writing the statements it
+// runs for each row to path as SQL that can be reviewed or applied by hand.
+// Every row is inserted in one transaction that is rolled back at the end,
+// so the project is left unchanged while the ids the statements refer to
+// follow on from each other as they would in a real import.
+func runEmitSQL(projectPath, inputPath, format, path string, opts Options) {
+	opts.CommitEvery = math.MaxInt
+	converter, err := NewConverter(projectPath, opts)
+	if err != nil {
+		log.Fatalf("Failed to initialize converter: %v", err)
+	}
+	defer converter.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Failed to create -emit-sql file: %v", err)
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	if converter.emit, err = converter.newSQLEmitter(ctx, f, inputPath); err != nil {
+		log.Fatalf("Failed to start -emit-sql file: %v", err)
+	}
+	stats, err := converter.Import(ctx, inputPath, format)
+	if err != nil {
+		log.Fatalf("Failed to import: %v", err)
+	}
+	if err := converter.emit.close(); err != nil {
+		log.Fatalf("Failed to write -emit-sql file: %v", err)
+	}
+	log.Printf("[INFO] Wrote the SQL of %d rows to %s, without changing the project: %d rows read, %d skipped, %d failed.", stats.RowsInserted, path, stats.RowsRead, stats.RowsSkipped, stats.RowsFailed)
+	logReasons(stats)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// errorReportSyncEvery is how many failures errorReport writes between
+// syncs to disk.
+const errorReportSyncEvery = 100
+
+// rowSource is a row as it was read from the input, kept with its record
+// so that it can be written to the error report if it fails.
+type rowSource struct {
+	// columns and row are the names and values of a CSV row's fields.
+	columns []string
+	row     []string
+	// object is the line of a JSON Lines input. Lines that are not valid
+	// JSON are kept as the single value of row instead.
+	object json.RawMessage
+}
+
+// failedRow is one line of an error report.
+type failedRow struct {
+	Line    int             `json:"line"`
+	Error   string          `json:"error"`
+	Reason  string          `json:"reason"`
+	Columns []string        `json:"columns,omitempty"`
+	Row     []string        `json:"row,omitempty"`
+	Object  json.RawMessage `json:"object,omitempty"`
+}
+
+// errorReport writes the rows that fail to an -errors file as they fail,
+// one JSON object per line. Each line is written with a single write, so a
+// crash loses at most the line being written, and every complete line
+// remains valid on its own. The file is synced to disk every
+// errorReportSyncEvery failures and when it is closed.
+type errorReport struct {
+	// mu serializes the writes of -route-parallel workers.
+	mu       sync.Mutex
+	f        *os.File
+	unsynced int
+	// written counts the rows written to the report.
+	written int
+}
+
+// createErrorReport creates, or truncates, the error report at path.
+func createErrorReport(path string) (*errorReport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &errorReport{f: f}, nil
+}
+
+// write appends a failed row to the report. A nil source writes the line and
+// error only.
+func (r *errorReport) write(line int, source *rowSource, failure, reason string) error {
+	entry := failedRow{Line: line, Error: failure, Reason: reason}
+	if source != nil {
+		entry.Columns, entry.Row, entry.Object = source.columns, source.row, source.object
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.f.Write(data); err != nil {
+		return err
+	}
+	r.written++
+	if r.unsynced++; r.unsynced >= errorReportSyncEvery {
+		r.unsynced = 0
+		return r.f.Sync()
+	}
+	return nil
+}
+
+// Close syncs and closes the report.
+func (r *errorReport) Close() error {
+	if err := r.f.Sync(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// failRow counts a row as failed, tallied under the reason given to err by
+// withReason, and with Options.ErrorReport writes it to the report with the
+// error. The error is logged by the caller, in the words of the step that
+// failed.
+func (c *Converter) failRow(line int, source *rowSource, err error) {
+	reason := failureReason(err)
+	c.stats.rowsFailed++
+	tally(&c.stats.failReasons, reason, 1)
+	if c.opts.ErrorReport == nil {
+		return
+	}
+	if werr := c.opts.ErrorReport.write(line, source, err.Error(), reason); werr != nil {
+		log.Printf("[WARN] Failed to write line %d to the error report: %v", line, werr)
+	}
+}
+
+// csvSource returns the source of a CSV row to keep with its record, or nil
+// without an error report.
+func (c *Converter) csvSource(columns, row []string) *rowSource {
+	if c.opts.ErrorReport == nil {
+		return nil
+	}
+	return &rowSource{columns: columns, row: row}
+}
+
+// jsonSource returns the source of a JSON Lines line to keep with its record,
+// or nil without an error report.
+func (c *Converter) jsonSource(line []byte) *rowSource {
+	if c.opts.ErrorReport == nil {
+		return nil
+	}
+	line = bytes.TrimSpace(line)
+	if !json.Valid(line) {
+		return &rowSource{row: []string{string(line)}}
+	}
+	return &rowSource{object: json.RawMessage(line)}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+// exportSQL selects every request with its response and raw messages in the
+// v1 column order. %[1]s and %[3]s are the schemas holding requests_raw and
+// responses_raw, and %[2]s the prefix of the table names, which is empty
+// except for staged rows.
+const exportSQL = `
+	SELECT r.id, r.host, r.method, r.path, r.length, r.port, rr.data, r.is_tls, r.query,
+		r.source, r.alteration, r.edited, r.parent_id, r.created_at,
+		r.response_id, s.status_code, sr.data, s.length, s.alteration, s.edited, s.parent_id, s.created_at
+	FROM %[2]srequests r
+	LEFT JOIN %[1]s.%[2]srequests_raw rr ON rr.id = r.raw_id
+	LEFT JOIN %[2]sresponses s ON s.id = r.response_id
+	LEFT JOIN %[3]s.%[2]sresponses_raw sr ON sr.id = s.raw_id
+	ORDER BY r.id`
+
+// Export writes the project's requests to w as CSV in the v1 layout, with a
+// header row, so the output can be imported again. Rows are streamed from the
+// database in id order rather than loaded at once. It returns the number of
+// rows written.
+//
+// The output starts with a format version line naming the project's
+// ProjectID, created if needed, so that importing it back into the same
+// project can be refused. If the ID cannot be recorded, for example because
+// the project is open in Caido, the line is left out.
+func (c *Converter) Export(ctx context.Context, w io.Writer) (int, error) {
+	source, err := c.ProjectID(ctx, true)
+	if err != nil {
+		log.Printf("[WARN] Exporting without a project id: %v", err)
+	}
+	return c.export(ctx, w, "", source)
+}
+
+// export is Export for the tables whose names start with prefix. The format
+// version line naming source is written only if source is not empty.
+func (c *Converter) export(ctx context.Context, w io.Writer, prefix, source string) (int, error) {
+	if source != "" {
+		if _, err := fmt.Fprintf(w, "%s %s %s=%s\n", formatPrefix, formatV1, sourceAttribute, source); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(exportSQL, c.schema.rawSchema, prefix, c.schema.responseRawSchema))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query requests: %w", err)
+	}
+	defer rows.Close()
+
+	out := csv.NewWriter(w)
+	if err := out.Write(csvColumns); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for rows.Next() {
+		var (
+			id, length, port, createdAt                   int64
+			host, method, path, query, source, alteration string
+			raw, responseRaw                              []byte
+			isTLS                                         bool
+			edited, responseEdited                        sql.NullBool
+			parentID, responseID, responseParentID        sql.NullInt64
+			status, responseLength, responseCreatedAt     sql.NullInt64
+			responseAlteration                            sql.NullString
+		)
+		if err := rows.Scan(&id, &host, &method, &path, &length, &port, &raw, &isTLS, &query,
+			&source, &alteration, &edited, &parentID, &createdAt,
+			&responseID, &status, &responseRaw, &responseLength, &responseAlteration, &responseEdited, &responseParentID, &responseCreatedAt); err != nil {
+			return n, fmt.Errorf("failed to read request: %w", err)
+		}
+
+		record := []string{
+			strconv.FormatInt(id, 10),
+			host,
+			method,
+			path,
+			strconv.FormatInt(length, 10),
+			strconv.FormatInt(port, 10),
+			base64.StdEncoding.EncodeToString(raw),
+			strconv.FormatBool(isTLS),
+			query,
+			"",
+			source,
+			alteration,
+			formatNullBool(edited),
+			formatNullInt(parentID),
+			strconv.FormatInt(createdAt, 10),
+			formatNullInt(responseID),
+			formatNullInt(status),
+			base64.StdEncoding.EncodeToString(responseRaw),
+			formatNullInt(responseLength),
+			responseAlteration.String,
+			formatNullBool(responseEdited),
+			formatNullInt(responseParentID),
+			formatNullInt(responseCreatedAt),
+		}
+		if err := out.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	out.Flush()
+	return n, out.Error()
+}
+
+func formatNullInt(v sql.NullInt64) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.FormatInt(v.Int64, 10)
+}
+
+func formatNullBool(v sql.NullBool) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.FormatBool(v.Bool)
+}
+
+// runExport writes the project's requests as CSV to path, or to stdout when
+// path is "-".
+func runExport(projectPath, path, key string, rawDBs rawDatabaseList) {
+	converter, err := NewConverter(projectPath, Options{Key: key, RawDatabases: rawDBs})
+	if err != nil {
+		log.Fatalf("Failed to initialize converter: %v", err)
+	}
+	defer converter.Close()
+
+	w := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Failed to create export file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := converter.Export(context.Background(), w)
+	if err != nil {
+		log.Fatalf("Failed to export requests: %v", err)
+	}
+	log.Printf("[INFO] Exported %d requests.", n)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Values of Options.ExtensionSource, which selects where a request's file
+// extension comes from.
+const (
+	// ExtensionsColumn uses the file_extensions column, deriving the
+	// extension from the path when it is blank.
+	ExtensionsColumn = "column"
+	// ExtensionsPath always derives the extension from the path.
+	ExtensionsPath = "path"
+)
+
+// extensionPattern matches a cleaned file extension, such as ".js" or
+// ".tar.gz".
+var extensionPattern = regexp.MustCompile(`^(\.[a-z0-9_+-]{1,16})+$`)
+
+// cleanExtension lowercases ext and adds the leading dot if it is missing,
+// reporting whether the result is a valid extension. A blank ext is valid.
+func cleanExtension(ext string) (string, bool) {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" {
+		return "", true
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext, extensionPattern.MatchString(ext)
+}
+
+// resolveExtension sets the record's FileExtensions according to
+// Options.ExtensionSource. An invalid file_extensions value is replaced by
+// the extension of the path with a warning, or fails the row with
+// Options.Strict.
+func (c *Converter) resolveExtension(record *CSVRecord) error {
+	fromPath, ok := cleanExtension(path.Ext(record.Path))
+	if !ok {
+		fromPath = ""
+	}
+	if c.opts.ExtensionSource == ExtensionsPath || strings.TrimSpace(record.FileExtensions) == "" {
+		record.FileExtensions = fromPath
+		return nil
+	}
+	ext, ok := cleanExtension(record.FileExtensions)
+	switch {
+	case ok:
+		record.FileExtensions = ext
+	case c.opts.Strict:
+		return fmt.Errorf("invalid file extension %q for host %s", record.FileExtensions, record.Host)
+	default:
+		log.Printf("[WARN] Replacing invalid file extension %q for host %s with that of the path", record.FileExtensions, record.Host)
+		record.FileExtensions = fromPath
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// EnableFastUnsafe turns off SQLite's durability for the rest of the import:
+// the databases are no longer synced to disk and their journals are kept in
+// memory instead of the WAL. A crash or power loss before the returned
+// function runs can corrupt the project. The returned function restores WAL
+// journaling and the previous synchronous setting, then checkpoints the WAL
+// so the project is complete on disk. Switching journal modes needs the only
+// connection to the databases, so this fails while Caido has the project
+// open.
+func (c *Converter) EnableFastUnsafe(ctx context.Context) (restore func() error, err error) {
+	schemas := c.schema.schemas()
+
+	synchronous := make(map[string]int, len(schemas))
+	for _, schema := range schemas {
+		var level int
+		if err := c.db.QueryRowContext(ctx, "PRAGMA "+schema+".synchronous").Scan(&level); err != nil {
+			return nil, fmt.Errorf("failed to read synchronous setting of %s: %w", schema, err)
+		}
+		synchronous[schema] = level
+	}
+
+	restore = func() error {
+		for _, schema := range schemas {
+			var mode string
+			if err := c.db.QueryRow("PRAGMA " + schema + ".journal_mode = WAL").Scan(&mode); err != nil {
+				return fmt.Errorf("failed to restore journal mode of %s: %w", schema, err)
+			}
+			if _, err := c.db.Exec(fmt.Sprintf("PRAGMA %s.synchronous = %d", schema, synchronous[schema])); err != nil {
+				return fmt.Errorf("failed to restore synchronous setting of %s: %w", schema, err)
+			}
+			if _, err := c.db.Exec("PRAGMA " + schema + ".wal_checkpoint(TRUNCATE)"); err != nil {
+				return fmt.Errorf("failed to checkpoint %s: %w", schema, err)
+			}
+		}
+		log.Println("[INFO] Restored WAL journaling and synchronous writes")
+		return nil
+	}
+
+	for _, schema := range schemas {
+		var mode string
+		if err := c.db.QueryRowContext(ctx, "PRAGMA "+schema+".journal_mode = MEMORY").Scan(&mode); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set journal mode of %s: %w", schema, err)
+		}
+		if mode != "memory" {
+			restore()
+			return nil, fmt.Errorf("could not leave WAL mode for %s (journal mode is %s); is the project open in Caido?", schema, mode)
+		}
+		if _, err := c.db.ExecContext(ctx, "PRAGMA "+schema+".synchronous = OFF"); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to turn off synchronous writes for %s: %w", schema, err)
+		}
+	}
+	log.Println("[WARN] -fast-unsafe: writes are not synced and the journal is in memory; the project may be corrupted if the import is interrupted")
+	return restore, nil
+}
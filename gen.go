@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Values synthetic rows are drawn from. The weights of methods and status
+// codes loosely follow typical proxy history.
+var (
+	genHosts    = []string{"example.com", "api.example.com", "static.example.net", "auth.example.org", "cdn.example.io", "shop.example.co.uk", "localhost", "10.0.0.12"}
+	genMethods  = []string{"GET", "GET", "GET", "GET", "POST", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
+	genPaths    = []string{"/", "/index.html", "/api/v1/users", "/api/v1/orders", "/login", "/static/app.js", "/static/style.css", "/images/logo.png", "/search", "/graphql"}
+	genStatuses = []int{200, 200, 200, 200, 201, 204, 301, 302, 304, 400, 401, 403, 404, 500}
+	genSources  = []string{"intercept", "intercept", "automate", "replay", "scanner"}
+)
+
+// genSeed seeds the generator, so that every run of -gen with the same
+// arguments writes the same file and benchmarks share one workload.
+const genSeed = 1
+
+// generateCSV writes n synthetic rows in the v1 layout, with a header row, to
+// w. Raw request bodies of POST, PUT and PATCH requests and every response
+// body are bodySize random bytes, which makes the raw columns binary.
+func generateCSV(w io.Writer, n, bodySize int) error {
+	rng := rand.New(rand.NewSource(genSeed))
+	out := csv.NewWriter(w)
+	if err := out.Write(csvColumns); err != nil {
+		return err
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	body := make([]byte, bodySize)
+	nullBool := func() string {
+		return []string{"", "true", "false"}[rng.Intn(3)]
+	}
+
+	for i := 1; i <= n; i++ {
+		host := genHosts[rng.Intn(len(genHosts))]
+		method := genMethods[rng.Intn(len(genMethods))]
+		path := genPaths[rng.Intn(len(genPaths))]
+		isTLS := rng.Intn(4) != 0
+		port := 80
+		if isTLS {
+			port = 443
+		}
+		query := ""
+		if rng.Intn(3) == 0 {
+			query = fmt.Sprintf("page=%d&q=%x", rng.Intn(100), rng.Int31())
+		}
+
+		target := path
+		if query != "" {
+			target += "?" + query
+		}
+		raw := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: caido-importer-gen\r\nAccept: */*\r\n", method, target, host)
+		var rawRequest []byte
+		switch method {
+		case "POST", "PUT", "PATCH":
+			rng.Read(body)
+			rawRequest = append([]byte(raw+"Content-Type: application/octet-stream\r\nContent-Length: "+strconv.Itoa(bodySize)+"\r\n\r\n"), body...)
+		default:
+			rawRequest = []byte(raw + "\r\n")
+		}
+
+		status := genStatuses[rng.Intn(len(genStatuses))]
+		rng.Read(body)
+		rawResponse := append([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", status, http.StatusText(status), bodySize)), body...)
+
+		createdAt := start + int64(i)*1000 + rng.Int63n(1000)
+		parentID := ""
+		if i > 1 && rng.Intn(10) == 0 {
+			parentID = strconv.Itoa(rng.Intn(i-1) + 1)
+		}
+
+		record := []string{
+			strconv.Itoa(i),
+			host,
+			method,
+			path,
+			strconv.Itoa(len(rawRequest)),
+			strconv.Itoa(port),
+			base64.StdEncoding.EncodeToString(rawRequest),
+			strconv.FormatBool(isTLS),
+			query,
+			"",
+			genSources[rng.Intn(len(genSources))],
+			"none",
+			nullBool(),
+			parentID,
+			strconv.FormatInt(createdAt, 10),
+			strconv.Itoa(i),
+			strconv.Itoa(status),
+			base64.StdEncoding.EncodeToString(rawResponse),
+			strconv.Itoa(len(rawResponse)),
+			"none",
+			nullBool(),
+			"",
+			strconv.FormatInt(createdAt+rng.Int63n(500), 10),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// runGenerate writes a synthetic CSV of n rows to path, or to stdout when
+// path is "-".
+func runGenerate(path string, n, bodySize int) {
+	w := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := generateCSV(w, n, bodySize); err != nil {
+		log.Fatalf("Failed to generate CSV: %v", err)
+	}
+	log.Printf("[INFO] Generated %d rows with %d-byte bodies.", n, bodySize)
+}
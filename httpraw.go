@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// httpHeader is a single header field of a raw HTTP message. Folded
+// continuation lines are kept as part of Value.
+type httpHeader struct {
+	Name  string
+	Value string
+}
+
+// httpMessage is a minimal, order-preserving view of a raw HTTP/1.x message.
+type httpMessage struct {
+	StartLine string
+	Headers   []httpHeader
+	Body      []byte
+	eol       string
+}
+
+// parseHTTPMessage splits a raw HTTP message into its start line, headers and
+// body. Both CRLF and bare LF line endings are accepted.
+func parseHTTPMessage(raw []byte) (*httpMessage, error) {
+	eol := "\r\n"
+	headEnd := bytes.Index(raw, []byte("\r\n\r\n"))
+	sepLen := 4
+	if lf := bytes.Index(raw, []byte("\n\n")); lf != -1 && (headEnd == -1 || lf < headEnd) {
+		eol, headEnd, sepLen = "\n", lf, 2
+	}
+	if headEnd == -1 {
+		// Head only, e.g. a bodiless request missing its final blank line.
+		headEnd, sepLen = len(raw), 0
+		if !bytes.Contains(raw, []byte("\r\n")) {
+			eol = "\n"
+		}
+	}
+
+	lines := strings.Split(string(raw[:headEnd]), eol)
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("missing start line")
+	}
+
+	msg := &httpMessage{StartLine: lines[0], Body: raw[headEnd+sepLen:], eol: eol}
+	for _, line := range lines[1:] {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(msg.Headers) > 0 {
+			msg.Headers[len(msg.Headers)-1].Value += eol + line
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed header line %q", line)
+		}
+		msg.Headers = append(msg.Headers, httpHeader{Name: name, Value: strings.TrimLeft(value, " \t")})
+	}
+	return msg, nil
+}
+
+// Header returns the value of the first header with the given name,
+// compared case-insensitively.
+func (m *httpMessage) Header(name string) (string, bool) {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetHeader replaces the value of the named header, or appends it if absent.
+func (m *httpMessage) SetHeader(name, value string) {
+	for i, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			m.Headers[i].Value = value
+			return
+		}
+	}
+	m.Headers = append(m.Headers, httpHeader{Name: name, Value: value})
+}
+
+// DelHeader removes every header with the given name.
+func (m *httpMessage) DelHeader(name string) {
+	kept := m.Headers[:0]
+	for _, h := range m.Headers {
+		if !strings.EqualFold(h.Name, name) {
+			kept = append(kept, h)
+		}
+	}
+	m.Headers = kept
+}
+
+// Bytes reassembles the message using its original line endings.
+func (m *httpMessage) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(m.StartLine)
+	buf.WriteString(m.eol)
+	for _, h := range m.Headers {
+		buf.WriteString(h.Name)
+		buf.WriteString(": ")
+		buf.WriteString(h.Value)
+		buf.WriteString(m.eol)
+	}
+	buf.WriteString(m.eol)
+	buf.Write(m.Body)
+	return buf.Bytes()
+}
+
+// parseRequestLine splits an HTTP request line into its method, request
+// target and protocol version.
+func parseRequestLine(line string) (method, target, proto string, err error) {
+	parts := strings.Fields(line)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return "", "", "", fmt.Errorf("malformed request line %q", line)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// knownMethods are the standard HTTP methods plus the WebDAV and other
+// registered extensions commonly seen in proxy history.
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true, "QUERY": true,
+	"PROPFIND": true, "PROPPATCH": true, "MKCOL": true, "COPY": true, "MOVE": true,
+	"LOCK": true, "UNLOCK": true, "SEARCH": true, "REPORT": true, "ACL": true,
+	"MKCALENDAR": true, "MKACTIVITY": true, "CHECKOUT": true, "CHECKIN": true,
+	"MERGE": true, "UPDATE": true, "LABEL": true, "BIND": true, "UNBIND": true,
+	"REBIND": true, "LINK": true, "UNLINK": true, "PURGE": true,
+}
+
+// requestTarget is the routing information carried by a request target.
+// Host is empty for origin-form targets ("/path?query"), where the
+// destination comes from the Host header instead.
+type requestTarget struct {
+	Host  string
+	Port  int
+	IsTLS bool
+	Path  string
+	Query string
+}
+
+// parseRequestTarget interprets a request target in origin-form, absolute-form
+// ("https://host/path") or, for CONNECT, authority-form ("host:443"). Ports
+// missing from an absolute-form target are filled from the scheme, and a
+// CONNECT to port 443 is assumed to tunnel TLS.
+func parseRequestTarget(method, target string) (requestTarget, error) {
+	if strings.EqualFold(method, "CONNECT") {
+		host, port := splitHostPort(target)
+		if host == "" || port == 0 {
+			return requestTarget{}, fmt.Errorf("malformed CONNECT authority %q", target)
+		}
+		return requestTarget{Host: host, Port: port, IsTLS: port == 443}, nil
+	}
+
+	if strings.HasPrefix(target, "/") || target == "*" {
+		// Fragments are not sent to servers, but clients that log the URL
+		// they were given may leave them in.
+		target, _, _ = strings.Cut(target, "#")
+		path, query, _ := strings.Cut(target, "?")
+		return requestTarget{Path: path, Query: query}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return requestTarget{}, fmt.Errorf("malformed request target %q", target)
+	}
+	rt := requestTarget{Path: u.EscapedPath(), Query: u.RawQuery}
+	if rt.Path == "" {
+		rt.Path = "/"
+	}
+	rt.Host, rt.Port = splitHostPort(u.Host)
+	switch strings.ToLower(u.Scheme) {
+	case "https", "wss":
+		rt.IsTLS = true
+		if rt.Port == 0 {
+			rt.Port = 443
+		}
+	case "http", "ws":
+		if rt.Port == 0 {
+			rt.Port = 80
+		}
+	default:
+		return requestTarget{}, fmt.Errorf("unsupported scheme %q in request target", u.Scheme)
+	}
+	return rt, nil
+}
+
+// parseStatusLine returns the status code from an HTTP status line.
+func parseStatusLine(line string) (int, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") {
+		return 0, fmt.Errorf("malformed status line %q", line)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil || code < 100 || code > 999 {
+		return 0, fmt.Errorf("malformed status code in %q", line)
+	}
+	return code, nil
+}
+
+// splitCombinedMessage separates a request and response stored together in
+// one blob. With the marker SplitRawBlank, the response starts at the first
+// status line that follows a blank line; otherwise the blob is split at the
+// first occurrence of marker.
+func splitCombinedMessage(raw []byte, marker string) (request, response []byte, err error) {
+	if marker != SplitRawBlank {
+		i := bytes.Index(raw, []byte(marker))
+		if i == -1 {
+			return nil, nil, fmt.Errorf("split marker %q not found", marker)
+		}
+		return raw[:i], raw[i+len(marker):], nil
+	}
+
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		i := bytes.Index(raw, []byte(sep+"HTTP/"))
+		if i == -1 {
+			continue
+		}
+		request, response = raw[:i+len(sep)], raw[i+len(sep):]
+		// When the request has a body, the blank line separates the body from
+		// the response and is not part of either message.
+		if headEnd := bytes.Index(raw, []byte(sep)); headEnd != i {
+			request = request[:i]
+		}
+		return request, response, nil
+	}
+	return nil, nil, fmt.Errorf("no response status line found after a blank line")
+}
+
+// compressHTTPMessage gzips the body of a raw HTTP message and declares it
+// with a Content-Encoding header, updating Content-Length when present.
+// Messages without a body, or that already declare a Content-Encoding or
+// Transfer-Encoding, are returned unchanged.
+func compressHTTPMessage(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	msg, err := parseHTTPMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Body) == 0 {
+		return raw, nil
+	}
+	if _, ok := msg.Header("Content-Encoding"); ok {
+		return raw, nil
+	}
+	if _, ok := msg.Header("Transfer-Encoding"); ok {
+		return raw, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(msg.Body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	msg.Body = buf.Bytes()
+	msg.SetHeader("Content-Encoding", "gzip")
+	if _, ok := msg.Header("Content-Length"); ok {
+		msg.SetHeader("Content-Length", strconv.Itoa(len(msg.Body)))
+	}
+	return msg.Bytes(), nil
+}
+
+// assembleHTTPMessage builds a raw HTTP message from a head given separately
+// from its body: the start line and header lines, with LF or CRLF line
+// endings. The message is written with CRLF line endings and the blank line
+// before the body. With Transfer-Encoding: chunked, a body that is not
+// chunk-encoded already is sent as a single chunk. Otherwise Content-Length
+// is added when the body is not empty, and must match the body when present.
+func assembleHTTPMessage(head string, body []byte) ([]byte, error) {
+	head = strings.TrimRight(strings.ReplaceAll(head, "\r\n", "\n"), "\n")
+	if head == "" {
+		return nil, fmt.Errorf("missing start line")
+	}
+	msg, err := parseHTTPMessage([]byte(strings.ReplaceAll(head, "\n", "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	msg.Body = body
+
+	if te, ok := msg.Header("Transfer-Encoding"); ok && isChunked(te) {
+		if !validChunkedBody(body) {
+			msg.Body = chunkBody(body)
+		}
+		return msg.Bytes(), nil
+	}
+	if cl, ok := msg.Header("Content-Length"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(cl))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-Length %q", cl)
+		}
+		if n != len(body) {
+			return nil, fmt.Errorf("Content-Length %d does not match the %d-byte body", n, len(body))
+		}
+	} else if len(body) > 0 {
+		msg.SetHeader("Content-Length", strconv.Itoa(len(body)))
+	}
+	return msg.Bytes(), nil
+}
+
+// isChunked reports whether a Transfer-Encoding value ends with chunked, the
+// coding that frames the body.
+func isChunked(te string) bool {
+	codings := strings.Split(te, ",")
+	return strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+}
+
+// validChunkedBody reports whether body is a complete chunked body.
+func validChunkedBody(body []byte) bool {
+	_, err := decodeChunkedBody(body)
+	return err == nil
+}
+
+// decodeChunkedBody returns the data encoded by a chunked body: chunks of a
+// hexadecimal size line and data, ending with a zero-size chunk, optional
+// trailer fields and a blank line. Chunk extensions are ignored. Lines may end
+// in bare LF, like the rest of a message read by parseHTTPMessage. The error
+// describes the first problem with the framing.
+func decodeChunkedBody(body []byte) ([]byte, error) {
+	decoded := []byte{}
+	for {
+		line, rest, ok := cutLine(body)
+		if !ok {
+			if len(body) == 0 {
+				return nil, fmt.Errorf("missing the last chunk")
+			}
+			return nil, fmt.Errorf("unterminated chunk size line %q", truncateForLog(body))
+		}
+		sizeLine, _, _ := strings.Cut(string(line), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeLine), 16, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunk size line %q", truncateForLog(line))
+		}
+		body = rest
+		if size == 0 {
+			break
+		}
+		if int64(len(body)) < size {
+			return nil, fmt.Errorf("%d-byte chunk is truncated to %d bytes", size, len(body))
+		}
+		decoded = append(decoded, body[:size]...)
+		if line, rest, ok = cutLine(body[size:]); !ok || len(line) > 0 {
+			return nil, fmt.Errorf("%d-byte chunk is not followed by a line ending", size)
+		}
+		body = rest
+	}
+	// Trailer fields, if any, end with a blank line.
+	for {
+		line, rest, ok := cutLine(body)
+		if !ok {
+			return nil, fmt.Errorf("missing the blank line after the last chunk")
+		}
+		body = rest
+		if len(line) == 0 {
+			break
+		}
+	}
+	if len(body) > 0 {
+		return nil, fmt.Errorf("%d bytes after the last chunk", len(body))
+	}
+	return decoded, nil
+}
+
+// cutLine splits b after its first line, ending in LF or CRLF, and returns the
+// line without its ending. It reports false if b has no line ending.
+func cutLine(b []byte) (line, rest []byte, ok bool) {
+	line, rest, ok = bytes.Cut(b, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), rest, ok
+}
+
+// chunkedBody returns the body of a raw HTTP message and whether it is sent
+// with Transfer-Encoding: chunked. Messages that cannot be parsed are
+// reported as not chunked.
+func chunkedBody(raw []byte) ([]byte, bool) {
+	if len(raw) == 0 {
+		return nil, false
+	}
+	msg, err := parseHTTPMessage(raw)
+	if err != nil {
+		return nil, false
+	}
+	te, ok := msg.Header("Transfer-Encoding")
+	return msg.Body, ok && isChunked(te)
+}
+
+// dechunkHTTPMessage replaces the chunked body of a raw HTTP message with the
+// data it encodes, declared with Content-Length. chunked is removed from
+// Transfer-Encoding, which is dropped if no other coding is left, and
+// trailer fields are discarded. Messages that are not chunked are returned
+// unchanged.
+func dechunkHTTPMessage(raw []byte) ([]byte, error) {
+	if _, ok := chunkedBody(raw); !ok {
+		return raw, nil
+	}
+	msg, err := parseHTTPMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Body, err = decodeChunkedBody(msg.Body); err != nil {
+		return nil, err
+	}
+	te, _ := msg.Header("Transfer-Encoding")
+	codings := strings.Split(te, ",")
+	if rest := strings.TrimSpace(strings.Join(codings[:len(codings)-1], ",")); rest != "" {
+		msg.SetHeader("Transfer-Encoding", rest)
+	} else {
+		msg.DelHeader("Transfer-Encoding")
+	}
+	msg.SetHeader("Content-Length", strconv.Itoa(len(msg.Body)))
+	return msg.Bytes(), nil
+}
+
+// dechunkedLength returns the size raw would have after dechunkHTTPMessage,
+// and false if it is not a validly chunked message.
+func dechunkedLength(raw []byte) (int64, bool) {
+	if _, ok := chunkedBody(raw); !ok {
+		return 0, false
+	}
+	dechunked, err := dechunkHTTPMessage(raw)
+	if err != nil {
+		return 0, false
+	}
+	return int64(len(dechunked)), true
+}
+
+// chunkBody frames body as a single chunk followed by the last chunk.
+func chunkBody(body []byte) []byte {
+	var buf bytes.Buffer
+	if len(body) > 0 {
+		fmt.Fprintf(&buf, "%x\r\n", len(body))
+		buf.Write(body)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("0\r\n\r\n")
+	return buf.Bytes()
+}
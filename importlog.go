@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// createImportLogSQL creates the table in which each import leaves a record
+// inside the project, so the history travels with it.
+const createImportLogSQL = `
+	CREATE TABLE IF NOT EXISTS csv_import_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		input_path TEXT NOT NULL,
+		input_sha256 TEXT NOT NULL,
+		rows_read INTEGER NOT NULL,
+		rows_inserted INTEGER NOT NULL,
+		rows_skipped INTEGER NOT NULL,
+		rows_failed INTEGER NOT NULL,
+		version TEXT NOT NULL
+	)`
+
+const insertImportLogSQL = `
+	INSERT INTO csv_import_log (started_at, finished_at, input_path, input_sha256, rows_read, rows_inserted, rows_skipped, rows_failed, version)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// createImportLogExtensionsSQL creates the table counting the requests of
+// each logged import by file extension, blank for requests without one.
+const createImportLogExtensionsSQL = `
+	CREATE TABLE IF NOT EXISTS csv_import_log_extensions (
+		log_id INTEGER NOT NULL REFERENCES csv_import_log(id) ON DELETE CASCADE,
+		extension TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		PRIMARY KEY (log_id, extension)
+	)`
+
+const insertImportLogExtensionSQL = "INSERT INTO csv_import_log_extensions (log_id, extension, requests) VALUES (?, ?, ?)"
+
+// LogImport records the finished import of inputPath in the project's
+// csv_import_log table, creating it if needed; inputPath is empty for
+// -promote. Times are stored as RFC 3339 in UTC. The requests inserted into
+// the project are counted by file extension in csv_import_log_extensions.
+func (c *Converter) LogImport(ctx context.Context, inputPath string, startedAt time.Time) error {
+	absInput, sum, err := describeInput(inputPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.db.ExecContext(ctx, createImportLogSQL); err != nil {
+		return fmt.Errorf("failed to create csv_import_log: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, createImportLogExtensionsSQL); err != nil {
+		return fmt.Errorf("failed to create csv_import_log_extensions: %w", err)
+	}
+	stats := c.Stats()
+	result, err := c.db.ExecContext(ctx, insertImportLogSQL,
+		startedAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), absInput, sum,
+		stats.RowsRead, stats.RowsInserted, stats.RowsSkipped, stats.RowsFailed, version)
+	if err != nil {
+		return fmt.Errorf("failed to insert into csv_import_log: %w", err)
+	}
+	logID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for ext, n := range c.stats.extensions {
+		if _, err := c.db.ExecContext(ctx, insertImportLogExtensionSQL, logID, ext, n); err != nil {
+			return fmt.Errorf("failed to insert into csv_import_log_extensions: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// jsonRecord is the JSON Lines representation of a CSVRecord. Field names
+// match the CSV column names, and raw and response_raw are base64 encoded.
+type jsonRecord struct {
+	ID                 int64  `json:"id"`
+	Host               string `json:"host"`
+	Method             string `json:"method"`
+	Path               string `json:"path"`
+	Length             int64  `json:"length"`
+	Port               int    `json:"port"`
+	Raw                []byte `json:"raw"`
+	IsTLS              bool   `json:"is_tls"`
+	Query              string `json:"query"`
+	FileExtensions     string `json:"file_extensions"`
+	Source             string `json:"source"`
+	Alteration         string `json:"alteration"`
+	Edited             *bool  `json:"edited"`
+	ParentID           *int64 `json:"parent_id"`
+	CreatedAt          int64  `json:"created_at"`
+	ResponseID         *int64 `json:"response_id"`
+	ResponseStatusCode int    `json:"response_status_code"`
+	ResponseRaw        []byte `json:"response_raw"`
+	ResponseLength     int64  `json:"response_length"`
+	ResponseAlteration string `json:"response_alteration"`
+	ResponseEdited     *bool  `json:"response_edited"`
+	ResponseParentID   *int64 `json:"response_parent_id"`
+	ResponseCreatedAt  int64  `json:"response_created_at"`
+	Intercept          *bool  `json:"intercept"`
+	InterceptPosition  *int64 `json:"intercept_position"`
+	RequestSentAt      *int64 `json:"request_sent_at"`
+	ResponseReceivedAt *int64 `json:"response_received_at"`
+	RoundtripTime      *int64 `json:"roundtrip_time"`
+}
+
+// toCSVRecord converts the decoded JSON object into a CSVRecord.
+func (j jsonRecord) toCSVRecord() CSVRecord {
+	nullInt := func(v *int64) sql.NullInt64 {
+		if v == nil {
+			return sql.NullInt64{}
+		}
+		return sql.NullInt64{Int64: *v, Valid: true}
+	}
+	nullBool := func(v *bool) sql.NullBool {
+		if v == nil {
+			return sql.NullBool{}
+		}
+		return sql.NullBool{Bool: *v, Valid: true}
+	}
+	return CSVRecord{
+		ID:                 j.ID,
+		Host:               j.Host,
+		Method:             j.Method,
+		Path:               j.Path,
+		Length:             j.Length,
+		Port:               j.Port,
+		Raw:                j.Raw,
+		IsTLS:              j.IsTLS,
+		Query:              j.Query,
+		FileExtensions:     j.FileExtensions,
+		Source:             j.Source,
+		Alteration:         j.Alteration,
+		Edited:             nullBool(j.Edited),
+		ParentID:           nullInt(j.ParentID),
+		CreatedAt:          j.CreatedAt,
+		ResponseID:         nullInt(j.ResponseID),
+		ResponseStatusCode: j.ResponseStatusCode,
+		ResponseRaw:        j.ResponseRaw,
+		ResponseLength:     j.ResponseLength,
+		ResponseAlteration: j.ResponseAlteration,
+		ResponseEdited:     nullBool(j.ResponseEdited),
+		ResponseParentID:   nullInt(j.ResponseParentID),
+		ResponseCreatedAt:  j.ResponseCreatedAt,
+		Intercept:          nullBool(j.Intercept),
+		InterceptPosition:  nullInt(j.InterceptPosition),
+		RequestSentAt:      nullInt(j.RequestSentAt),
+		ResponseReceivedAt: nullInt(j.ResponseReceivedAt),
+		RoundtripTime:      nullInt(j.RoundtripTime),
+	}
+}
+
+// ImportFromJSONL imports a file holding one JSON object per line. Unknown
+// fields are ignored and missing fields are filled in as for a v2 CSV
+// without those columns. Like ImportFromCSV, it returns the converter's
+// Stats.
+func (c *Converter) ImportFromJSONL(ctx context.Context, path string) (Stats, error) {
+	start := time.Now()
+	err := c.importJSONL(ctx, path)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importJSONL(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening JSONL file: %v", err)
+	}
+	defer f.Close()
+	return c.importJSONLReader(ctx, f)
+}
+
+// importJSONLReader imports JSON Lines read from r.
+func (c *Converter) importJSONLReader(ctx context.Context, r io.Reader) error {
+	release, err := c.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error reading JSONL file: %v", err)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			c.stats.rowsRead++
+			if !c.resumed(lineNum) {
+				if err := c.importJSONLine(ctx, line, lineNum); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return c.flushPending(ctx)
+		}
+	}
+}
+
+// importJSONLine decodes and imports the JSON object on line lineNum.
+func (c *Converter) importJSONLine(ctx context.Context, line []byte, lineNum int) error {
+	source := c.jsonSource(line)
+	defer c.recoverRow(lineNum, source)
+
+	var record jsonRecord
+	start := time.Now()
+	err := json.Unmarshal(line, &record)
+	c.stats.timings.Parse += time.Since(start)
+	if err != nil {
+		log.Printf("Error parsing JSONL record on line %d: %v", lineNum, err)
+		c.failRow(lineNum, source, withReason(reasonParse, err))
+		return nil
+	}
+	csvRecord := record.toCSVRecord()
+	csvRecord.source = source
+	if c.opts.RawPrecompressed != "" {
+		if err := gunzipRawColumns(&csvRecord); err != nil {
+			log.Printf("Error parsing JSONL record on line %d: %v", lineNum, err)
+			c.failRow(lineNum, source, withReason(reasonParse, err))
+			return nil
+		}
+	}
+	if err := fillMissingFields(&csvRecord, line); err != nil {
+		log.Printf("Error parsing JSONL record on line %d: %v", lineNum, err)
+		c.failRow(lineNum, source, withReason(reasonParse, err))
+		return nil
+	}
+	return c.submit(ctx, csvRecord, lineNum)
+}
+
+// fillMissingFields fills in the fields missing from the JSON object on line
+// like fillMissingColumns does for the columns missing from a v2 CSV, and
+// gives a missing raw or response_raw an empty message.
+func fillMissingFields(record *CSVRecord, line []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return err
+	}
+	// Like encoding/json, field names are matched case-insensitively.
+	layout := make(columnLayout, len(fields))
+	for name := range fields {
+		layout[strings.ToLower(name)] = 0
+	}
+	if record.Raw == nil {
+		record.Raw = []byte{}
+	}
+	if record.ResponseRaw == nil {
+		record.ResponseRaw = []byte{}
+	}
+	return fillMissingColumns(record, layout)
+}
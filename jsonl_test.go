@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// TestJSONLMissingFields imports JSON Lines objects without raw messages or
+// timestamps, which must be filled in as for a v2 CSV missing those columns.
+func TestJSONLMissingFields(t *testing.T) {
+	request := "GET /search?q=1 HTTP/1.1\r\nHost: example.com:8080\r\n\r\n"
+	lines := `{"raw": "` + base64.StdEncoding.EncodeToString([]byte(request)) + `"}
+{"host": "example.com", "method": "GET", "path": "/", "port": 443}
+`
+	project := newTestProject(t)
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	start := time.Now().UnixMilli()
+	stats, err := c.Import(context.Background(), writeTestFile(t, "missing.jsonl", lines), "jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowsInserted != 2 {
+		t.Fatalf("inserted %d rows, want 2 (failed %d: %v)", stats.RowsInserted, stats.RowsFailed, stats.FailReasons)
+	}
+
+	db := openTestDB(t, project, "database.caido")
+	rows, err := db.Query("SELECT host, method, path, query, port, length, created_at FROM requests ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := []struct {
+		host, method, path, query string
+		port, length              int64
+	}{
+		{"example.com", "GET", "/search", "q=1", 8080, int64(len(request))},
+		{"example.com", "GET", "/", "", 443, 0},
+	}
+	for i := 0; rows.Next(); i++ {
+		var host, method, path, query string
+		var port, length, createdAt int64
+		if err := rows.Scan(&host, &method, &path, &query, &port, &length, &createdAt); err != nil {
+			t.Fatal(err)
+		}
+		w := want[i]
+		if host != w.host || method != w.method || path != w.path || query != w.query || port != w.port || length != w.length {
+			t.Errorf("row %d is %s %s %s?%s port %d length %d, want %s %s %s?%s port %d length %d", i+1, method, host, path, query, port, length, w.method, w.host, w.path, w.query, w.port, w.length)
+		}
+		if createdAt < start {
+			t.Errorf("row %d was created at %d, want the time of the import", i+1, createdAt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, table := range []string{"requests_raw", "responses_raw"} {
+		var nulls int
+		if err := raw.QueryRow("SELECT count(*) FROM " + table + " WHERE data IS NULL").Scan(&nulls); err != nil {
+			t.Fatal(err)
+		}
+		if nulls > 0 {
+			t.Errorf("%s has %d NULL messages", table, nulls)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// logRotateBytes is the size beyond which -log moves an existing log file
+// aside instead of appending to it.
+const logRotateBytes = 10 << 20
+
+// openLogFile sends the log to the file at path, appending to it. A file
+// already larger than logRotateBytes is first renamed to path.1, replacing
+// any previous one, so a log written by every run of a scheduled import
+// cannot grow without bound. The returned file is closed by the caller.
+func openLogFile(path string) (*os.File, error) {
+	if info, err := os.Stat(path); err == nil && info.Size() > logRotateBytes {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	log.SetOutput(f)
+	return f, nil
+}
@@ -1,20 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/base64" // Added for Base64 decoding
 	"encoding/csv"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// version identifies this build of the importer. It can be overridden at
+// build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 // CSVRecord holds the data from a single row of the CSV file.
 type CSVRecord struct {
 	ID                  int64
@@ -29,274 +42,3073 @@ type CSVRecord struct {
 	FileExtensions      string
 	Source              string
 	Alteration          string
-	Edited              bool
+	Edited              sql.NullBool // NULL when blank or unknown
 	ParentID            sql.NullInt64
 	CreatedAt           int64
-	ResponseID          sql.NullInt64
+	ResponseID          sql.NullInt64 // Source id of this row's response; see README
 	ResponseStatusCode  int
 	ResponseRaw         []byte // Decoded data
 	ResponseLength      int64
 	ResponseAlteration  string
-	ResponseEdited      bool
+	ResponseEdited      sql.NullBool
 	ResponseParentID    sql.NullInt64
 	ResponseCreatedAt   int64
+	Intercept           sql.NullBool // Blank means true
+	InterceptPosition   sql.NullInt64 // Blank appends to the intercept queue
+	RequestSentAt       sql.NullInt64 // Milliseconds since the epoch
+	ResponseReceivedAt  sql.NullInt64
+	RoundtripTime       sql.NullInt64 // Milliseconds; see resolveRoundtrip
+
+	// source is the row the record was read from, kept for the error report
+	// when Options.ErrorReport is set.
+	source *rowSource
+	// input and line locate the row in the input when Options.TraceSource
+	// is set; see traceSource.
+	input string
+	line  int
+}
+
+// Options controls how CSV records are normalized before insertion.
+type Options struct {
+	// PortDefault is used for blank or zero ports. When 0, the port is
+	// derived from IsTLS (443 or 80).
+	PortDefault int
+	// Strict turns recoverable data problems into row errors.
+	Strict bool
+	// CompressRaw gzips raw request and response bodies before storage.
+	CompressRaw bool
+	// RawPrecompressed, when set, recognizes raw messages and bodies that
+	// the export already gzip-compressed: PrecompressedKeep or
+	// PrecompressedDecompress.
+	RawPrecompressed string
+	// MaxRawBytes limits the size of Raw and ResponseRaw. Zero means no limit.
+	MaxRawBytes int64
+	// MaxFieldBytes limits the size of each CSV field as read, before any
+	// decoding. Zero means no limit.
+	MaxFieldBytes int64
+	// OversizePolicy selects what happens to rows exceeding MaxRawBytes.
+	OversizePolicy string
+	// SplitRawMarker, when set, splits a combined request and response held
+	// in the raw request column. See splitCombinedMessage.
+	SplitRawMarker string
+	// ResponseOnly selects how rows with a response but no request are
+	// imported. Empty keeps the default of inserting them as-is.
+	ResponseOnly string
+	// SourceMap and AlterationMap translate Source and the alteration
+	// columns to the values Caido should store.
+	SourceMap     map[string]string
+	AlterationMap map[string]string
+	// UniqueID selects what happens to a row whose ID or ResponseID was
+	// already seen earlier in the same run. Empty only warns.
+	UniqueID string
+	// Verbose logs per-row diagnostics at debug level.
+	Verbose bool
+	// StoreExtensions writes FileExtensions to the requests table's
+	// file_extension column.
+	StoreExtensions bool
+	// ExtensionSource selects where FileExtensions comes from, as
+	// ExtensionsColumn (the default when empty) or ExtensionsPath.
+	ExtensionSource string
+	// Key decrypts SQLCipher-encrypted project databases.
+	Key string
+	// RawDatabases are attached in place of the project's raw database, to
+	// find requests_raw and responses_raw in.
+	RawDatabases rawDatabaseList
+	// Rate limits inserts to this many rows per second. Zero means no limit.
+	Rate float64
+	// SortBy, when set to SortByCreatedAt, buffers the whole input and
+	// inserts it in chronological order instead of file order.
+	SortBy string
+	// Mode selects which Caido views imported rows appear in. Empty or
+	// ModeFull writes every table; see ModeSitemapOnly.
+	Mode string
+	// Transforms rewrite host, path, query or port values before insertion.
+	Transforms []transform
+	// EditedDefault replaces blank edited and response_edited values when
+	// Valid. Otherwise blanks are stored as NULL where the schema allows it
+	// and as false where it does not.
+	EditedDefault sql.NullBool
+	// TolerateResponseErrors inserts a request with a NULL response_id when
+	// its response fails to insert, instead of failing the row.
+	TolerateResponseErrors bool
+	// CommitEvery groups inserts into transactions of this many rows. Zero
+	// commits each insert on its own.
+	CommitEvery int
+	// TxMode is how transactions begin, TxDeferred or TxImmediate. Blank
+	// leaves it to the driver, which defers.
+	TxMode string
+	// MethodPassthrough stores methods exactly as given. Otherwise they are
+	// uppercased and checked against knownMethods.
+	MethodPassthrough bool
+	// StrictMethod turns an unknown method into a row error instead of a
+	// warning.
+	StrictMethod bool
+	// Since and Until, when non-zero, skip rows whose CreatedAt is before
+	// Since or at or after Until.
+	Since time.Time
+	Until time.Time
+	// MinTime and MaxTime, when non-zero, are the range CreatedAt and
+	// ResponseCreatedAt are expected in; see checkTimes.
+	MinTime time.Time
+	MaxTime time.Time
+	// TrustStatus resolves a ResponseStatusCode that disagrees with the
+	// status line of ResponseRaw. Empty keeps the column and warns, or fails
+	// the row under Strict.
+	TrustStatus string
+	// CheckLengths, when set, compares non-zero Length and ResponseLength
+	// values with the size of the decoded raw messages: CheckLengthsReport
+	// fails mismatched rows and CheckLengthsFix stores the actual size.
+	CheckLengths string
+	// StrictAlteration rejects rows whose alteration values do not match
+	// alterationPattern instead of warning.
+	StrictAlteration bool
+	// RemapParents treats ParentID and ResponseParentID as references to the
+	// ID and ResponseID columns of other rows in the input. They are inserted
+	// as NULL and set by Converter.RemapParents once every row is imported.
+	RemapParents bool
+	// DeferParents inserts every ParentID and ResponseParentID as NULL and
+	// sets them with Converter.RemapParents once every row is imported,
+	// rather than only those not in the project yet; see parentFor.
+	DeferParents bool
+	// Tag, if set, labels every imported request; see prepareTag.
+	Tag string
+	// TraceSource records the input and line of every imported request in
+	// csv_import_sources; see prepareTraceSource.
+	TraceSource bool
+	// NormalizeHost lowercases the host column and strips trailing dots and
+	// default ports, so that hosts differing only in case share one sitemap
+	// entry.
+	NormalizeHost bool
+	// HostAliases, if set, replaces hosts with their canonical names after
+	// NormalizeHost; see canonical.go.
+	HostAliases hostAliases
+	// SelfTest reads back every inserted request and fails the row if any
+	// column differs from what was inserted; see runSelfTest.
+	SelfTest bool
+	// Session is the id of the session imported rows are stamped with, for
+	// projects that partition data by session. It defaults to the project's
+	// first session.
+	Session string
+	// RawEncodings is how the raw CSV columns are encoded, base64 by
+	// default.
+	RawEncodings rawEncodings
+	// Reopen is how many times the project may be reopened after an error
+	// of the database connection, such as a full disk, retrying the row
+	// each time. Errors caused by a row's data are never retried.
+	Reopen int
+	// ParallelRoutes imports the rows routed to each project other than the
+	// converter's own in a goroutine of its own, so the projects are
+	// written in parallel; see OpenRoutes.
+	ParallelRoutes bool
+	// LatestResponse keeps only the row with the latest ResponseCreatedAt
+	// among rows sharing an ID, for exports that list retries of a request
+	// as separate rows. The whole input is read before inserting.
+	LatestResponse bool
+	// PreserveIDs inserts requests and responses with their ID and
+	// ResponseID as primary keys instead of ids assigned by the project. The
+	// whole input is read and its ids checked before inserting; see
+	// checkPreservedIDs.
+	PreserveIDs bool
+	// ValidateRaw rejects rows whose raw request does not start with an
+	// HTTP request line or whose raw response does not start with "HTTP/".
+	ValidateRaw bool
+	// StrictColumns fails the import when a v2 header row names a column
+	// that is not known, instead of ignoring it.
+	StrictColumns bool
+	// Dechunk stores raw messages sent with Transfer-Encoding: chunked with
+	// the data of their chunks as a flat body; see dechunkHTTPMessage.
+	Dechunk bool
+	// Redact lists the headers, in lower case, whose values are replaced in
+	// the raw messages; see redactHeaders.
+	Redact []string
+	// Columns names the CSV columns in file order, overriding the header
+	// row and format version; see explicitLayout.
+	Columns []string
+	// NormalizeQuery re-encodes the query column consistently, keeping the
+	// order of parameters and repeated keys.
+	NormalizeQuery bool
+	// TrimCR strips trailing carriage returns from every CSV field, for
+	// files whose rows end in stray "\r"s. Numeric and boolean columns
+	// ignore them regardless.
+	TrimCR bool
+	// NoRaw stores empty raw messages, keeping only the request and
+	// response columns.
+	NoRaw bool
+	// TablePrefix, if set, inserts rows into staging copies of the tables
+	// named with this prefix instead of the live ones; see staging.go.
+	TablePrefix string
+	// Spec, if set, is checked against the header and every row of CSV
+	// input; see spec.go.
+	Spec csvSpec
+	// Insecure skips verifying the certificate of an https input URL.
+	Insecure bool
+	// MaxErrors, if positive, stops the import with an error once this many
+	// rows have failed.
+	MaxErrors int
+	// LimitHosts, if positive, stops the import with an error once rows for
+	// more than this many distinct hosts have been read.
+	LimitHosts int
+	// ErrorReport, if set, receives every failed row with its error as it
+	// fails; see errorreport.go.
+	ErrorReport *errorReport
+	// State, if set, skips rows whose id an earlier run imported and
+	// records the ids of the rows inserted; see state.go.
+	State *importState
+	// CheckpointEvery runs a passive WAL checkpoint every this many rows;
+	// see checkpoint.go.
+	CheckpointEvery int
+	// Dedup skips rows whose request is already in the project, or was
+	// imported earlier in the run, using a bloom filter sized for
+	// DedupExpected requests with a false positive rate of DedupFPRate;
+	// see dedup.go.
+	Dedup         bool
+	DedupExpected int
+	DedupFPRate   float64
+	// AllowSelfImport imports input exported from the project itself, which
+	// is otherwise refused; see checkSource.
+	AllowSelfImport bool
 }
 
+// Options.TrustStatus values.
+const (
+	TrustStatusColumn = "column"
+	TrustStatusRaw    = "raw"
+)
+
+// Options.CheckLengths values.
+const (
+	CheckLengthsReport = "report"
+	CheckLengthsFix    = "fix"
+)
+
+// SortByCreatedAt is the only supported Options.SortBy value.
+const SortByCreatedAt = "created_at"
+
+// Mode values. Caido's views are driven by these tables:
+//
+//   - sitemap: requests (host, port, path, query) joined to responses for
+//     the status shown on each node;
+//   - HTTP history: requests listed through intercept_entries, one entry per
+//     proxied request;
+//   - request and response bodies: raw.requests_raw and raw.responses_raw.
+//
+// ModeSitemapOnly keeps requests, responses and their raw bodies so the
+// sitemap tree can be browsed and replayed, but omits intercept_entries so
+// the rows do not show up as individual history entries.
+const (
+	ModeFull        = "full"
+	ModeSitemapOnly = "sitemap-only"
+)
+
+// Modes for handling duplicate IDs within a run.
+const (
+	UniqueIDSkip  = "skip"  // Skip later occurrences of an ID.
+	UniqueIDError = "error" // Abort the import on a duplicate ID.
+)
+
+// Modes for importing rows that carry only a response.
+const (
+	ResponseOnlySynthesize = "synthesize" // Insert a minimal GET request for the response.
+	ResponseOnlyStandalone = "standalone" // Insert the response without a request.
+)
+
+// SplitRawBlank is the SplitRawMarker value that splits a combined message at
+// the blank line preceding the response status line.
+const SplitRawBlank = "blank"
+
+// Values of Options.TxMode. A deferred transaction takes the write lock at
+// its first write, and an immediate one when it begins.
+const (
+	TxDeferred  = "deferred"
+	TxImmediate = "immediate"
+)
+
+// Policies for rows whose raw data exceeds Options.MaxRawBytes.
+const (
+	OversizeReject   = "reject"
+	OversizeTruncate = "truncate"
+)
+
 // Converter handles the database connection and data insertion.
 type Converter struct {
-	db *sql.DB
+	db    *sql.DB
+	opts  Options
+	stmts *statements
+	stats importStats
+	// throttle paces inserts when Options.Rate is set.
+	throttle *time.Ticker
+	// schema describes the project's databases; see projectschema.go.
+	schema projectSchema
+	// batch is the open transaction when Options.CommitEvery is set.
+	batch *batch
+	// pending holds parsed records awaiting insertion when sorting.
+	pending []pendingRecord
+	// validateOnly stops each record after normalization; see NewValidator.
+	validateOnly bool
+	// routes dispatches rows to other projects with -route; see route.go.
+	routes *router
+	// queueEnd is the last position in the intercept queue before the first
+	// entry with an explicit position was inserted, once read by
+	// interceptBase.
+	queueEnd sql.NullInt64
+	// warnedPosition is whether the missing position column was reported.
+	warnedPosition bool
+	// warnedTimeUnits records the columns and units of the timestamps
+	// converted by checkTime, and the columns of those it kept out of
+	// range, each reported once.
+	warnedTimeUnits map[string]bool
+	// seenHosts holds the hosts of the rows read, for Options.LimitHosts.
+	seenHosts map[string]bool
+	// existing holds the hashes of the project's requests when only
+	// comparing the input with them; see loadExistingHashes.
+	existing map[[sha256.Size]byte]bool
+	// dedup holds the hashes of the requests in the project, and those
+	// imported, for Options.Dedup; see dedup.go.
+	dedup *bloomFilter
+	// nullableEdited records, per table, whether its edited column accepts
+	// NULL.
+	nullableEdited map[string]bool
+	// session is the session imported rows are stamped with; see
+	// prepareSession.
+	session string
+	// projectPath is the project the converter opened, and reopens counts
+	// how often it was reopened; see reopen.
+	projectPath string
+	reopens     int
+	// metadataFailed is set once a requests_metadata insert has failed; see
+	// insertMetadata.
+	metadataFailed bool
+	// input is the input being imported, or the archive entry of a zip, as
+	// recorded by Options.TraceSource.
+	input string
+	// sinceCheckpoint counts the rows processed since the last
+	// Options.CheckpointEvery checkpoint.
+	sinceCheckpoint int
+	// sourceProject is the project identifier named by the input's format
+	// version line, for the manifest; see checkSource.
+	sourceProject string
+	// emit receives the statements of an -emit-sql dry run; see emit.go.
+	emit *sqlEmitter
+	// resume is where an import with -resume picks up; see
+	// resume.go.
+	resume *resumePoint
+}
+
+// importStats tracks what an import has done so far.
+type importStats struct {
+	rowsRead     int
+	rowsInserted int
+	rowsSkipped  int
+	rowsFailed   int
+	// rowsValid counts rows that passed validation in validate-only mode.
+	rowsValid int
+	// rowsNew and rowsPresent count the rows that are and are not already in
+	// the project when comparing; see loadExistingHashes.
+	rowsNew     int
+	rowsPresent int
+	// dedupSuspected counts the rows Options.Dedup looked up in the project.
+	dedupSuspected int
+	// headersRedacted counts the header values Options.Redact replaced.
+	headersRedacted int
+	// timesOutOfRange counts the timestamps outside Options.MinTime and
+	// MaxTime that checkTime kept.
+	timesOutOfRange int
+	// parentsDeferred counts the rows inserted without their parent, which
+	// was not in the project yet, for RemapParents to link.
+	parentsDeferred int
+	// rowsOutsideWindow counts rows skipped by Options.Since and Until; they
+	// are included in rowsSkipped.
+	rowsOutsideWindow int
+	// skipReasons and failReasons tally the skipped and failed rows by
+	// reason; see reasons.go.
+	skipReasons map[string]int
+	failReasons map[string]int
+	// responsesInserted includes standalone responses, and requestsInserted
+	// counts the inserted rows other than those.
+	responsesInserted int
+	requestsInserted  int
+	// duration is the time spent in the Import methods, and timings its
+	// breakdown.
+	duration time.Duration
+	timings  Timings
+	// seenIDs and seenResponseIDs map each external ID and ResponseID to
+	// the line it was first seen on.
+	seenIDs         map[int64]int
+	seenResponseIDs map[int64]int
+	// hosts is the set of hosts of the inserted rows.
+	hosts map[string]bool
+	// extensions counts the inserted requests by file extension.
+	extensions map[string]int
+	// ids holds the range of ids inserted into each table, keyed by table name.
+	ids map[string]*idRange
+}
+
+// Stats summarizes what a Converter has imported so far, across all of its
+// Import calls.
+type Stats struct {
+	RowsRead     int
+	RowsInserted int
+	RowsSkipped  int
+	RowsFailed   int
+	// RowsValid counts rows that passed validation; it is only set by a
+	// Converter from NewValidator, which inserts nothing.
+	RowsValid int
+	// RowsOutsideWindow counts the rows skipped by Options.Since and Until,
+	// which are also included in RowsSkipped.
+	RowsOutsideWindow int
+	// SkipReasons and FailReasons break RowsSkipped and RowsFailed down by
+	// reason, such as "duplicate id" or "parse error".
+	SkipReasons map[string]int
+	FailReasons map[string]int
+	// RowsNew and RowsPresent count the valid rows that are not and are
+	// already in the project, when only comparing with it.
+	RowsNew           int
+	RowsPresent       int
+	ResponsesInserted int
+	Duration          time.Duration
+	Timings           Timings
+	// FirstInsertedID and LastInsertedID bound the ids of the rows inserted
+	// into the requests table, or are 0 if none were inserted.
+	FirstInsertedID int64
+	LastInsertedID  int64
+}
+
+// Stats returns the counts of the imports run so far.
+func (c *Converter) Stats() Stats {
+	stats := Stats{
+		RowsRead:          c.stats.rowsRead,
+		RowsInserted:      c.stats.rowsInserted,
+		RowsSkipped:       c.stats.rowsSkipped,
+		RowsFailed:        c.stats.rowsFailed,
+		RowsValid:         c.stats.rowsValid,
+		RowsOutsideWindow: c.stats.rowsOutsideWindow,
+		RowsNew:           c.stats.rowsNew,
+		RowsPresent:       c.stats.rowsPresent,
+		ResponsesInserted: c.stats.responsesInserted,
+		Duration:          c.stats.duration,
+		Timings:           c.stats.timings,
+	}
+	if r, ok := c.stats.ids["requests"]; ok {
+		stats.FirstInsertedID, stats.LastInsertedID = r.First, r.Last
+	}
+	for reason, n := range c.stats.skipReasons {
+		tally(&stats.SkipReasons, reason, n)
+	}
+	for reason, n := range c.stats.failReasons {
+		tally(&stats.FailReasons, reason, n)
+	}
+	// Rows routed to other projects are counted in their converters.
+	for _, target := range c.routes.targets(c) {
+		stats.RowsInserted += target.stats.rowsInserted
+		stats.RowsFailed += target.stats.rowsFailed
+		for reason, n := range target.stats.failReasons {
+			tally(&stats.FailReasons, reason, n)
+		}
+		stats.ResponsesInserted += target.stats.responsesInserted
+	}
+	return stats
+}
+
+// idRange is the lowest and highest id inserted into a table, and the ids
+// themselves as runs of consecutive ids, so that ids inserted by others in
+// between are not taken for the import's.
+type idRange struct {
+	First int64   `json:"first"`
+	Last  int64   `json:"last"`
+	Runs  []idRun `json:"runs"`
+	// n counts the ids in Runs.
+	n int
+}
+
+// idRun is a run of consecutive ids, from the first to the last.
+type idRun [2]int64
+
+// add appends id to the runs, extending the last run if id follows it.
+func (r *idRange) add(id int64) {
+	if len(r.Runs) > 0 && r.Runs[len(r.Runs)-1][1] == id-1 {
+		r.Runs[len(r.Runs)-1][1] = id
+	} else {
+		r.Runs = append(r.Runs, idRun{id, id})
+	}
+	r.n++
+	r.First = min(r.First, id)
+	r.Last = max(r.Last, id)
+}
+
+// truncate forgets the ids added after the first n, and recomputes the
+// bounds from those left.
+func (r *idRange) truncate(n int) {
+	for r.n > n {
+		last := &r.Runs[len(r.Runs)-1]
+		if last[0] == last[1] {
+			r.Runs = r.Runs[:len(r.Runs)-1]
+		} else {
+			last[1]--
+		}
+		r.n--
+	}
+	if len(r.Runs) == 0 {
+		return
+	}
+	r.First, r.Last = r.Runs[0][0], r.Runs[0][1]
+	for _, run := range r.Runs {
+		r.First = min(r.First, run[0])
+		r.Last = max(r.Last, run[1])
+	}
+}
+
+// debugf logs a diagnostic message when Options.Verbose is set.
+func (c *Converter) debugf(format string, args ...any) {
+	if c.opts.Verbose {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
+
+// track records an id inserted into table.
+func (c *Converter) track(table string, id int64) {
+	c.debugf("Inserted %s id %d", table, id)
+	if c.stats.ids == nil {
+		c.stats.ids = make(map[string]*idRange)
+	}
+	r, ok := c.stats.ids[table]
+	if !ok {
+		r = &idRange{First: id, Last: id}
+		c.stats.ids[table] = r
+	}
+	r.add(id)
+}
+
+// tracked returns the number of ids tracked so far in each table, for
+// untrack to restore when the rows inserted since are rolled back.
+func (c *Converter) tracked() map[string]int {
+	counts := make(map[string]int, len(c.stats.ids))
+	for table, r := range c.stats.ids {
+		counts[table] = r.n
+	}
+	return counts
+}
+
+// untrack forgets the ids tracked since counts was taken by tracked.
+func (c *Converter) untrack(counts map[string]int) {
+	for table, r := range c.stats.ids {
+		if r.n == counts[table] {
+			continue
+		}
+		if counts[table] == 0 {
+			delete(c.stats.ids, table)
+			continue
+		}
+		r.truncate(counts[table])
+	}
+}
+
+// NewValidator returns a Converter without a database, which parses and
+// normalizes its input but inserts nothing.
+func NewValidator(opts Options) *Converter {
+	return &Converter{opts: opts, validateOnly: true}
 }
 
 // NewConverter establishes a connection to the Caido project database.
-func NewConverter(projectPath string) (*Converter, error) {
-	db, err := openDB(projectPath)
+func NewConverter(projectPath string, opts Options) (*Converter, error) {
+	db, schema, err := openDB(projectPath, opts.Key, opts.RawDatabases, opts.TxMode)
 	if err != nil {
 		return nil, err
 	}
-	return &Converter{db: db}, nil
+	return &Converter{db: db, opts: opts, schema: schema, projectPath: projectPath}, nil
+}
+
+// CheckWritable verifies that both databases can be written to by briefly
+// taking the write lock, so lock or permission problems surface before any
+// rows are processed.
+func (c *Converter) CheckWritable() error {
+	ctx := context.Background()
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("failed to acquire write lock: %w", err)
+	}
+	schemas := c.schema.schemas()
+	for _, schema := range schemas {
+		if _, err := conn.ExecContext(ctx, "CREATE TABLE "+schema+".csv_import_write_check (x)"); err != nil {
+			conn.ExecContext(ctx, "ROLLBACK")
+			return fmt.Errorf("%s database is not writable: %w", schema, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+		return fmt.Errorf("failed to release write lock: %w", err)
+	}
+	return nil
 }
 
 // Close terminates the database connection.
 func (c *Converter) Close() error {
-	return c.db.Close()
+	if c.routes != nil {
+		c.routes.close(c)
+		c.routes = nil
+	}
+	if c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// Import reads the file at path in the given input format ("csv", "jsonl",
+// "burp-xml" or "ws-csv") and imports its records. A CSV path ending in .zip is read as an
+// archive of CSV files.
+func (c *Converter) Import(ctx context.Context, path, format string) (Stats, error) {
+	c.input = path
+	if format == retryFormat {
+		return c.ImportFromErrorReport(ctx, path)
+	}
+	if isURL(path) {
+		return c.ImportFromURL(ctx, path, format)
+	}
+	if format == "jsonl" {
+		return c.ImportFromJSONL(ctx, path)
+	}
+	if format == burpFormat {
+		return c.ImportFromBurpXML(ctx, path)
+	}
+	if format == "ws-csv" {
+		return c.ImportFromWebSocketCSV(ctx, path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return c.ImportFromZip(ctx, path)
+	}
+	return c.ImportFromCSV(ctx, path)
+}
+
+// ImportFromCSV reads the CSV file and imports its data, returning the
+// converter's Stats. If ctx is cancelled or times out, the import stops after
+// the current row and reports how many rows were inserted.
+func (c *Converter) ImportFromCSV(ctx context.Context, path string) (Stats, error) {
+	start := time.Now()
+	err := c.importCSV(ctx, path)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+// ImportFromReader imports CSV data read from r, like ImportFromCSV.
+func (c *Converter) ImportFromReader(ctx context.Context, r io.Reader) (Stats, error) {
+	start := time.Now()
+	err := c.importCSVReader(ctx, r)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
 }
 
-// ImportFromCSV reads the CSV file and imports its data.
-func (c *Converter) ImportFromCSV(path string) error {
+func (c *Converter) importCSV(ctx context.Context, path string) error {
 	csvFile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("error opening CSV file: %v", err)
 	}
 	defer csvFile.Close()
+	return c.importCSVReader(ctx, csvFile)
+}
+
+func (c *Converter) importCSVReader(ctx context.Context, r io.Reader) error {
+	buffered := bufio.NewReader(r)
+	formatVersion, source, lineOffset, err := readFormatVersion(buffered)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSource(ctx, source); err != nil {
+		return err
+	}
 
-	reader := csv.NewReader(csvFile)
-	// Skip header row
-	if _, err := reader.Read(); err != nil {
-		return fmt.Errorf("error reading header from CSV: %v", err)
+	reader := csv.NewReader(buffered)
+	// Field counts are checked per record by parseCSVRecord, which can report
+	// the full line range of a record split by an unquoted newline.
+	reader.FieldsPerRecord = -1
+
+	var layout columnLayout
+	// names are the column names of the rows, for checking Options.Spec.
+	var names []string
+	// first and firstErr are the result of reading the first row while
+	// looking for a header, when it turned out to be data.
+	var first []string
+	var firstErr error
+	hasFirst := false
+	if len(c.opts.Columns) > 0 {
+		if layout, err = explicitLayout(c.opts.Columns); err != nil {
+			return fmt.Errorf("invalid -columns: %v", err)
+		}
+		names = c.opts.Columns
+		first, firstErr = reader.Read()
+		hasFirst = firstErr != nil || !isHeaderFor(first, c.opts.Columns)
+		log.Printf("[INFO] Reading CSV with the columns given by -columns")
+	} else {
+		header, err := reader.Read()
+		if err == io.EOF {
+			// Reported by the caller as an input without rows.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading header from CSV: %v", err)
+		}
+		// A v1 header is not read, as its columns are positional.
+		if c.opts.StrictColumns && formatVersion == formatV2 {
+			if unknown := unknownColumns(header); len(unknown) > 0 {
+				return fmt.Errorf("header has unknown columns: %s", strings.Join(unknown, ", "))
+			}
+		}
+		layout = layoutFor(formatVersion, header)
+		names = header
+		log.Printf("[INFO] Reading CSV format %s", formatVersion)
+	}
+	// reportColumns are the canonical names of the columns, which the error
+	// report records in place of names.
+	reportColumns := layout.names(len(names))
+	var spec *boundSpec
+	if c.opts.Spec != nil {
+		if spec, err = c.opts.Spec.bind(names); err != nil {
+			return fmt.Errorf("header does not match -spec: %v", err)
+		}
+	}
+
+	release, err := c.prepare(ctx)
+	if err != nil {
+		return err
 	}
+	defer release()
 
 	for {
-		record, err := reader.Read()
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+
+		// A row already read while looking for a header comes first; reader
+		// reports its field positions until the next Read.
+		record, err := first, firstErr
+		if hasFirst {
+			hasFirst = false
+		} else {
+			start := time.Now()
+			record, err = reader.Read()
+			c.stats.timings.Parse += time.Since(start)
+		}
 		if err == io.EOF {
 			break
 		}
+		c.stats.rowsRead++
 		if err != nil {
+			line := 0
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				parseErr.StartLine += lineOffset
+				parseErr.Line += lineOffset
+				line = parseErr.StartLine
+			}
+			if c.resumed(line) {
+				continue
+			}
 			log.Printf("Error reading record from CSV: %v", err)
+			c.failRow(line, nil, withReason(reasonParse, err))
 			continue // Skip to the next record
 		}
 
-		csvRecord, err := parseCSVRecord(record)
-		if err != nil {
-			log.Printf("Error parsing CSV record: %v", err)
-			continue
+		if c.opts.TrimCR {
+			for i := range record {
+				record[i] = trimCR(record[i])
+			}
 		}
 
-		if err := c.insertData(csvRecord); err != nil {
-			log.Printf("Error inserting data for host %s: %v", csvRecord.Host, err)
+		line, _ := reader.FieldPos(0)
+		endLine, _ := reader.FieldPos(len(record) - 1)
+		line += lineOffset
+		endLine += lineOffset
+		if c.resumed(line) {
+			continue
+		}
+		source := c.csvSource(reportColumns, record)
+		if field, err := c.checkFieldSizes(record, names); err != nil {
+			fieldLine, _ := reader.FieldPos(field)
+			log.Printf("Error reading CSV record on line %d: %v", fieldLine+lineOffset, err)
+			c.failRow(line, source, withReason(reasonOversize, err))
+			continue
+		}
+		if spec != nil {
+			if violations := spec.check(record); len(violations) > 0 {
+				var problems []string
+				for _, v := range violations {
+					field := min(v.field, len(record)-1)
+					fieldLine, column := reader.FieldPos(field)
+					log.Printf("Error validating CSV record on line %d, field %d at column %d: %v", fieldLine+lineOffset, v.field+1, column, v.err)
+					problems = append(problems, v.err.Error())
+				}
+				c.failRow(line, source, withReason(reasonSpec, fmt.Errorf("%s", strings.Join(problems, "; "))))
+				continue
+			}
+		}
+		if err := c.importCSVRow(ctx, record, source, layout, line, endLine); err != nil {
+			return err
 		}
 	}
-	return nil
+	return c.flushPending(ctx)
 }
 
-// parseCSVRecord converts a string slice from the CSV into a structured CSVRecord.
-// It now decodes the raw request and response data from Base64.
-func parseCSVRecord(record []string) (CSVRecord, error) {
-    // Helper function to parse boolean values
-	parseBool := func(s string) bool {
-		val, _ := strconv.ParseBool(s)
-		return val
-	}
-    
-    // Helper function to parse integers
-	parseInt := func(s string) int64 {
-		val, _ := strconv.ParseInt(s, 10, 64)
-		return val
+// checkFieldSizes enforces Options.MaxFieldBytes on a CSV row whose columns
+// are named by names, returning the index of the first field over the limit
+// with an error naming it.
+func (c *Converter) checkFieldSizes(record, names []string) (int, error) {
+	if c.opts.MaxFieldBytes <= 0 {
+		return 0, nil
 	}
-    
-    // Helper function to parse nullable integers
-	parseNullInt := func(s string) sql.NullInt64 {
-		if s == "" {
-			return sql.NullInt64{}
+	for i, field := range record {
+		if int64(len(field)) <= c.opts.MaxFieldBytes {
+			continue
 		}
-		val, err := strconv.ParseInt(s, 10, 64)
-		if err != nil {
-			return sql.NullInt64{}
+		column := fmt.Sprintf("field %d", i+1)
+		if i < len(names) {
+			column += fmt.Sprintf(" (%s)", names[i])
 		}
-		return sql.NullInt64{Int64: val, Valid: true}
+		return i, fmt.Errorf("%s is %d bytes, over the -max-field-bytes limit of %d", column, len(field), c.opts.MaxFieldBytes)
 	}
+	return 0, nil
+}
 
-	// **Decode raw request and response from Base64**
-	rawRequest, err := base64.StdEncoding.DecodeString(record[6])
-	if err != nil {
-		return CSVRecord{}, fmt.Errorf("failed to decode raw request: %w", err)
-	}
+// importCSVRow parses and imports the CSV row spanning line to endLine.
+func (c *Converter) importCSVRow(ctx context.Context, record []string, source *rowSource, layout columnLayout, line, endLine int) error {
+	defer c.recoverRow(line, source)
 
-	rawResponse, err := base64.StdEncoding.DecodeString(record[17])
+	start := time.Now()
+	csvRecord, err := parseCSVRecord(record, layout, c.opts.RawEncodings)
+	c.stats.timings.Parse += time.Since(start)
 	if err != nil {
-		return CSVRecord{}, fmt.Errorf("failed to decode raw response: %w", err)
+		if endLine > line {
+			log.Printf("Error parsing CSV record on lines %d-%d: %v", line, endLine, err)
+		} else {
+			log.Printf("Error parsing CSV record on line %d: %v", line, err)
+		}
+		c.failRow(line, source, withReason(reasonParse, err))
+		return nil
 	}
-
-
-	return CSVRecord{
-		ID:                 parseInt(record[0]),
-		Host:               record[1],
-		Method:             record[2],
-		Path:               record[3],
-		Length:             parseInt(record[4]),
-		Port:               int(parseInt(record[5])),
-		Raw:                rawRequest, // Use decoded data
-		IsTLS:              parseBool(record[7]),
-		Query:              record[8],
-		FileExtensions:     record[9],
-		Source:             record[10],
-		Alteration:         record[11],
-		Edited:             parseBool(record[12]),
-		ParentID:           parseNullInt(record[13]),
-		CreatedAt:          parseInt(record[14]),
-		ResponseID:         parseNullInt(record[15]),
-		ResponseStatusCode: int(parseInt(record[16])),
-		ResponseRaw:        rawResponse, // Use decoded data
-		ResponseLength:     parseInt(record[18]),
-		ResponseAlteration: record[19],
-		ResponseEdited:     parseBool(record[20]),
-		ResponseParentID:   parseNullInt(record[21]),
-		ResponseCreatedAt:  parseInt(record[22]),
-	}, nil
+	csvRecord.source = source
+	return c.submit(ctx, csvRecord, line)
 }
 
+// pendingRecord is a parsed record held back for sorting,
+// Options.LatestResponse or Options.PreserveIDs.
+type pendingRecord struct {
+	record CSVRecord
+	line   int
+}
 
-// insertData orchestrates the insertion of response and request data.
-func (c *Converter) insertData(record CSVRecord) error {
-	responseID, err := c.insertResponse(record)
-	if err != nil {
-		return err
+// submit imports a parsed record, or holds it until flushPending when the
+// input is being sorted, deduplicated or checked for preserved ids.
+func (c *Converter) submit(ctx context.Context, record CSVRecord, line int) error {
+	if c.opts.SortBy != "" || c.opts.LatestResponse || c.opts.PreserveIDs {
+		c.pending = append(c.pending, pendingRecord{record: record, line: line})
+		return nil
 	}
+	return c.importRecord(ctx, record, line)
+}
 
-	requestID, err := c.insertRequest(responseID, record)
-	if err != nil {
+// flushPending imports the records held by submit. With
+// Options.LatestResponse, only the latest of the records sharing an ID is
+// kept. When sorting, records are imported in CreatedAt order, breaking ties
+// by ResponseCreatedAt and then input order. With Options.PreserveIDs,
+// nothing is imported unless every record's ids can be kept. Finally, the
+// open -commit-every batches are committed.
+func (c *Converter) flushPending(ctx context.Context) error {
+	pending := c.pending
+	c.pending = nil
+	if c.opts.LatestResponse {
+		pending = c.latestResponses(pending)
+	}
+	if c.opts.SortBy != "" {
+		sort.SliceStable(pending, func(i, j int) bool {
+			a, b := pending[i].record, pending[j].record
+			if a.CreatedAt != b.CreatedAt {
+				return a.CreatedAt < b.CreatedAt
+			}
+			return a.ResponseCreatedAt < b.ResponseCreatedAt
+		})
+	}
+	if c.opts.PreserveIDs {
+		if err := c.checkPreservedIDs(ctx, pending); err != nil {
+			return err
+		}
+	}
+	for _, p := range pending {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+		if err := c.importRecord(ctx, p.record, p.line); err != nil {
+			return err
+		}
+	}
+	if err := c.routes.drain(); err != nil {
 		return err
 	}
-
-	_, err = c.insertIntercept(requestID)
-	if err != nil {
+	if err := c.checkMaxErrors(); err != nil {
 		return err
 	}
-
-	fmt.Printf("Successfully inserted request for host: %s\n", record.Host)
+	// The last batches are committed here rather than when the statements
+	// are released, so that a failed commit fails the import.
+	for _, target := range append([]*Converter{c}, c.routes.targets(c)...) {
+		if err := target.commitBatch(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// insertResponse inserts the HTTP response data into the database.
-func (c *Converter) insertResponse(record CSVRecord) (int64, error) {
-	var rawResponseID int64
-	err := c.db.QueryRow("INSERT INTO raw.responses_raw (data, source, alteration) VALUES (?, ?, ?) RETURNING id",
-		record.ResponseRaw, record.Source, record.ResponseAlteration).Scan(&rawResponseID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert into raw.responses_raw: %w", err)
+// checkMaxErrors fails the import once Options.MaxErrors rows have failed,
+// rolling back the open -commit-every batch.
+func (c *Converter) checkMaxErrors() error {
+	if c.opts.MaxErrors <= 0 {
+		return nil
 	}
-
-	var responseID int64
-	err = c.db.QueryRow(`
-		INSERT INTO responses (status_code, raw_id, length, alteration, edited, parent_id, created_at, roundtrip_time)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 0) RETURNING id`,
-		record.ResponseStatusCode, rawResponseID, record.ResponseLength, record.ResponseAlteration, record.ResponseEdited, record.ResponseParentID, record.ResponseCreatedAt,
-	).Scan(&responseID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert into responses: %w", err)
+	failed := c.rowsFailed()
+	if failed < c.opts.MaxErrors {
+		return nil
 	}
+	c.routes.drain()
+	err := fmt.Errorf("stopped after %d rows failed (-max-errors %d)", c.rowsFailed(), c.opts.MaxErrors)
+	c.rollbackAll()
+	return err
+}
 
-	return responseID, nil
+// checkHostLimit records the host of a normalized record and stops the
+// import once more distinct hosts than Options.LimitHosts have been seen,
+// which usually means a column holding something else is read as the host.
+func (c *Converter) checkHostLimit(record CSVRecord) error {
+	if c.opts.LimitHosts <= 0 || c.seenHosts[record.Host] {
+		return nil
+	}
+	if c.seenHosts == nil {
+		c.seenHosts = make(map[string]bool)
+	}
+	c.seenHosts[record.Host] = true
+	if len(c.seenHosts) <= c.opts.LimitHosts {
+		return nil
+	}
+	hosts := make([]string, 0, len(c.seenHosts))
+	for host := range c.seenHosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	c.routes.drain()
+	c.rollbackAll()
+	return fmt.Errorf("stopped after reading rows for %d distinct hosts (-limit-hosts %d): %s", len(hosts), c.opts.LimitHosts, strings.Join(hosts, ", "))
 }
 
-// insertRequest inserts the HTTP request data into the database.
-func (c *Converter) insertRequest(responseID int64, record CSVRecord) (int64, error) {
-	var rawRequestID int64
-	err := c.db.QueryRow("INSERT INTO raw.requests_raw (data, source, alteration) VALUES (?, ?, ?) RETURNING id",
-		record.Raw, record.Source, record.Alteration).Scan(&rawRequestID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert into raw.requests_raw: %w", err)
+// rollbackAll rolls back the open batches of the converter and of its routed
+// projects, when stopping the import. The routed projects' workers must be
+// drained first, so that their batches are idle.
+func (c *Converter) rollbackAll() {
+	c.rollbackBatch()
+	for _, target := range c.routes.targets(c) {
+		target.rollbackBatch()
 	}
+}
 
-	var metadataID int64
-	err = c.db.QueryRow("INSERT INTO requests_metadata DEFAULT VALUES RETURNING id").Scan(&metadataID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert into requests_metadata: %w", err)
+// latestResponses drops every record that shares its ID with a later
+// response: one with a greater ResponseCreatedAt, or an equal one further
+// down the input. Records without an ID are all kept. The kept records stay
+// in input order, and the dropped ones are counted as skipped.
+func (c *Converter) latestResponses(pending []pendingRecord) []pendingRecord {
+	latest := make(map[int64]int)
+	for i, p := range pending {
+		id := p.record.ID
+		if id == 0 {
+			continue
+		}
+		if j, ok := latest[id]; !ok || p.record.ResponseCreatedAt >= pending[j].record.ResponseCreatedAt {
+			latest[id] = i
+		}
 	}
 
-	var requestID int64
-	err = c.db.QueryRow(`
-		INSERT INTO requests (host, method, path, length, port, is_tls, raw_id, query, response_id, source, alteration, edited, parent_id, created_at, metadata_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
-		record.Host, record.Method, record.Path, record.Length, record.Port, record.IsTLS, rawRequestID, record.Query, responseID, record.Source, record.Alteration, record.Edited, record.ParentID, record.CreatedAt, metadataID,
-	).Scan(&requestID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert into requests: %w", err)
+	kept := pending[:0]
+	dropped := 0
+	for i, p := range pending {
+		if j, ok := latest[p.record.ID]; ok && j != i {
+			c.debugf("Dropping earlier response for ID %d on line %d", p.record.ID, p.line)
+			dropped++
+			continue
+		}
+		kept = append(kept, p)
 	}
+	if dropped > 0 {
+		log.Printf("[INFO] Dropped %d earlier responses to requests with a later response", dropped)
+		c.skipRows(reasonSuperseded, dropped)
+	}
+	return kept
+}
 
-	return requestID, nil
+// recoverRow turns a panic while handling the row on line into a logged row
+// failure, so a single malformed row cannot crash an otherwise good import.
+// It must be deferred directly by the per-row function.
+func (c *Converter) recoverRow(line int, source *rowSource) {
+	if r := recover(); r != nil {
+		log.Printf("Error processing record on line %d: unexpected panic: %v", line, r)
+		c.failRow(line, source, withReason(reasonPanic, fmt.Errorf("unexpected panic: %v", r)))
+	}
 }
 
-// insertIntercept adds the request to the intercept view.
-func (c *Converter) insertIntercept(requestID int64) (int64, error) {
-	var interceptID int64
-	err := c.db.QueryRow("INSERT INTO intercept_entries (request_id) VALUES (?) RETURNING id", requestID).Scan(&interceptID)
+// prepare readies the insert statements for an import. The returned function
+// releases them once the import is done.
+func (c *Converter) prepare(ctx context.Context) (func(), error) {
+	if c.validateOnly {
+		return func() {}, nil
+	}
+	stmts, err := c.prepareAll(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert into intercept_entries: %w", err)
+		return nil, err
 	}
-	return interceptID, nil
+	stmts.emit = c.emit
+	c.stmts = stmts
+	if c.opts.Dedup && c.dedup == nil {
+		if err := c.loadDedup(ctx); err != nil {
+			c.stmts.Close()
+			c.stmts = nil
+			return nil, err
+		}
+	}
+	if c.opts.Rate > 0 {
+		c.throttle = time.NewTicker(time.Duration(float64(time.Second) / c.opts.Rate))
+	}
+	release := func() {
+		if err := c.commitBatch(); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+		c.stmts.Close()
+		c.stmts = nil
+		if c.throttle != nil {
+			c.throttle.Stop()
+			c.throttle = nil
+		}
+	}
+	if c.routes == nil {
+		return release, nil
+	}
+	releaseRoutes, err := c.prepareRoutes(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		releaseRoutes()
+		release()
+	}, nil
 }
 
-// openDB connects to the main and raw Caido databases.
-func openDB(projectPath string) (*sql.DB, error) {
-	dbPath := projectPath + "/database.caido"
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("caido main database does not exist at %s", dbPath)
+// prepareAll prepares the insert statements and any optional ones the
+// options call for, and reads the column properties normalization depends
+// on.
+func (c *Converter) prepareAll(ctx context.Context) (*statements, error) {
+	if c.opts.TablePrefix != "" {
+		return c.prepareStaging(ctx)
 	}
-
-	db, err := sql.Open("sqlite3", dbPath)
+	stmts, err := prepareStatements(ctx, c.db, c.schema, "", c.opts.PreserveIDs)
 	if err != nil {
-		return nil, fmt.Errorf("error opening database.caido: %v", err)
+		return nil, err
 	}
-	log.Println("[INFO] Opened database.caido")
-
-	dbRawPath := projectPath + "/database_raw.caido"
-	if _, err := os.Stat(dbRawPath); os.IsNotExist(err) {
-		db.Close()
-		return nil, fmt.Errorf("caido raw database does not exist at %s", dbRawPath)
+	if c.opts.StoreExtensions {
+		columns, err := tableColumns(ctx, c.db, "requests")
+		if err == nil && !columns["file_extension"] {
+			err = fmt.Errorf("requests table has no file_extension column, so -store-extensions is not supported by this project")
+		}
+		if err == nil {
+			stmts.extension, err = stmts.prepare(ctx, c.db, updateExtensionSQL)
+		}
+		if err != nil {
+			stmts.Close()
+			return nil, err
+		}
 	}
+	if err := c.prepareSession(ctx, stmts); err != nil {
+		stmts.Close()
+		return nil, err
+	}
+	if err := c.prepareMetadata(ctx, stmts); err != nil {
+		stmts.Close()
+		return nil, err
+	}
+	if c.opts.Tag != "" {
+		if err := c.prepareTag(ctx, stmts); err != nil {
+			stmts.Close()
+			return nil, err
+		}
+	}
+	if c.opts.TraceSource {
+		if err := c.prepareTraceSource(ctx, stmts); err != nil {
+			stmts.Close()
+			return nil, err
+		}
+	}
+	if err := c.prepareRemap(ctx, stmts); err != nil {
+		stmts.Close()
+		return nil, err
+	}
+	if err := c.readNullableEdited(ctx); err != nil {
+		stmts.Close()
+		return nil, err
+	}
+	return stmts, nil
+}
 
-	_, err = db.Exec(fmt.Sprintf("ATTACH DATABASE '%s' AS raw", dbRawPath))
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("error attaching database_raw.caido: %v", err)
+// readNullableEdited records which tables accept NULL in their edited
+// column, for resolveEdited.
+func (c *Converter) readNullableEdited(ctx context.Context) error {
+	c.nullableEdited = make(map[string]bool)
+	for _, table := range []string{"requests", "responses"} {
+		nullable, err := columnNullable(ctx, c.db, table, "edited")
+		if err != nil {
+			return err
+		}
+		c.nullableEdited[table] = nullable
 	}
-	log.Println("[INFO] Attached database_raw.caido")
+	return nil
+}
 
-	return db, nil
+// wait blocks until the rate limit allows the next insert or ctx is done.
+func (c *Converter) wait(ctx context.Context) error {
+	if c.throttle == nil {
+		return nil
+	}
+	select {
+	case <-c.throttle.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func main() {
-	projectPath := flag.String("p", "", "Path to the Caido project directory")
-	csvPath := flag.String("f", "", "Path to the CSV file to import")
-	flag.Parse()
+// importRecord normalizes and inserts a single parsed record read from line,
+// recording the outcome in the import stats. Row-level failures are logged
+// and counted; only errors that must stop the import are returned.
+// Cancellation is left for the caller to report.
+func (c *Converter) importRecord(ctx context.Context, record CSVRecord, line int) error {
+	defer c.recoverRow(line, record.source)
+	if c.opts.TraceSource {
+		// Set here, as routed rows are stored by another converter.
+		record.input, record.line = c.input, line
+	}
 
-	if *projectPath == "" || *csvPath == "" {
-		log.Fatal("Both project path (-p) and CSV file path (-f) are required.")
+	if err := c.checkTimes(&record); err != nil {
+		log.Printf("Error normalizing record on line %d: %v", line, err)
+		c.failRow(line, record.source, withReason(reasonInvalid, err))
+		return nil
+	}
+	if !c.inWindow(record) {
+		c.skipRows(reasonOutsideWindow, 1)
+		c.stats.rowsOutsideWindow++
+		return nil
+	}
+	if skip, err := c.checkDuplicateID(record, line); err != nil || skip {
+		return err
+	}
+	if skip, err := c.checkState(record, line); err != nil || skip {
+		return err
 	}
 
-	converter, err := NewConverter(*projectPath)
+	start := time.Now()
+	err := c.normalizeRecord(&record)
+	c.stats.timings.Normalize += time.Since(start)
 	if err != nil {
-		log.Fatalf("Failed to initialize converter: %v", err)
+		log.Printf("Error normalizing record on line %d: %v", line, err)
+		c.failRow(line, record.source, withReason(reasonInvalid, err))
+		return nil
 	}
-	defer converter.Close()
-
-	log.Printf("[INFO] Starting import from %s", *csvPath)
+	if err := c.checkHostLimit(record); err != nil {
+		return err
+	}
+	c.debugf("Line %d: id=%d host=%s port=%d tls=%t method=%s path=%s length=%d response_length=%d status=%d source=%s alteration=%s",
+		line, record.ID, record.Host, record.Port, record.IsTLS, record.Method, record.Path,
+		record.Length, record.ResponseLength, record.ResponseStatusCode, record.Source, record.Alteration)
+
+	if c.validateOnly {
+		c.stats.rowsValid++
+		if c.existing != nil {
+			c.countDiff(record)
+		}
+		return nil
+	}
+
+	if skip, err := c.checkDedup(ctx, record, line); err != nil || skip {
+		return err
+	}
+
+	target, err := c.route(record.Host)
+	if err != nil {
+		log.Printf("Error routing record on line %d: %v", line, err)
+		c.failRow(line, record.source, withReason(reasonRejected, err))
+		return nil
+	}
+	return c.dispatch(ctx, target, record, line)
+}
+
+// storeRecord inserts a normalized record read from line, retrying it after
+// reopening the project when Options.Reopen allows, and records the outcome
+// in the import stats.
+func (c *Converter) storeRecord(ctx context.Context, record CSVRecord, line int) error {
+	if err := c.wait(ctx); err != nil {
+		return nil
+	}
+	if err := c.beginBatch(ctx); err != nil {
+		return err
+	}
+	insertErr := c.insertData(ctx, record)
+	for insertErr != nil && ctx.Err() == nil && isConnectionError(insertErr) && c.reopens < c.opts.Reopen {
+		c.reopens++
+		log.Printf("[WARN] Database error on line %d, reopening the project (attempt %d of %d): %v", line, c.reopens, c.opts.Reopen, insertErr)
+		if err := c.reopen(ctx); err != nil {
+			return fmt.Errorf("failed to reopen project: %w", err)
+		}
+		if err := c.beginBatch(ctx); err != nil {
+			return err
+		}
+		insertErr = c.insertData(ctx, record)
+	}
+	request := c.opts.ResponseOnly != ResponseOnlyStandalone || !isResponseOnly(record)
+	if c.batch != nil {
+		c.batch.lastLine = line
+	}
+	if err := c.countBatchRow(insertErr == nil, request); err != nil {
+		return err
+	}
+	c.checkpoint(ctx)
+	if err := insertErr; err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("Error inserting data for host %s on line %d: %v", record.Host, line, err)
+		c.failRow(line, record.source, withReason(insertReason(err), err))
+		return nil
+	}
+	c.stats.rowsInserted++
+	if request {
+		c.stats.requestsInserted++
+	}
+	if c.stats.hosts == nil {
+		c.stats.hosts = make(map[string]bool)
+	}
+	c.stats.hosts[record.Host] = true
+	if request {
+		tally(&c.stats.extensions, record.FileExtensions, 1)
+	}
+	return c.recordState(record)
+}
+
+// inWindow reports whether a record's CreatedAt, in milliseconds since the
+// epoch, falls within Options.Since and Until.
+func (c *Converter) inWindow(record CSVRecord) bool {
+	if !c.opts.Since.IsZero() && record.CreatedAt < c.opts.Since.UnixMilli() {
+		return false
+	}
+	if !c.opts.Until.IsZero() && record.CreatedAt >= c.opts.Until.UnixMilli() {
+		return false
+	}
+	return true
+}
+
+// checkDuplicateID reports a record whose ID or ResponseID already appeared
+// earlier in the run, and applies Options.UniqueID. Each row is imported
+// with a response of its own, so a repeated ResponseID is as inconsistent as
+// a repeated ID. Blank IDs are not checked. A row is only recorded as seen
+// once both of its ids pass, so a skipped row does not count as the first.
+func (c *Converter) checkDuplicateID(record CSVRecord, line int) (skip bool, err error) {
+	if c.stats.seenIDs == nil {
+		c.stats.seenIDs = make(map[int64]int)
+		c.stats.seenResponseIDs = make(map[int64]int)
+	}
+	ids := []struct {
+		name  string
+		id    int64
+		valid bool
+		seen  map[int64]int
+	}{
+		{"ID", record.ID, record.ID != 0, c.stats.seenIDs},
+		{"response_id", record.ResponseID.Int64, record.ResponseID.Valid, c.stats.seenResponseIDs},
+	}
+	for _, id := range ids {
+		if !id.valid {
+			continue
+		}
+		first, seen := id.seen[id.id]
+		if !seen {
+			continue
+		}
+		switch c.opts.UniqueID {
+		case UniqueIDError:
+			return false, fmt.Errorf("duplicate %s %d on line %d, first seen on line %d", id.name, id.id, line, first)
+		case UniqueIDSkip:
+			log.Printf("[WARN] Skipping duplicate %s %d on line %d, first seen on line %d", id.name, id.id, line, first)
+			c.skipRows(reasonDuplicateID, 1)
+			return true, nil
+		default:
+			log.Printf("[WARN] Duplicate %s %d on line %d, first seen on line %d", id.name, id.id, line, first)
+		}
+	}
+	for _, id := range ids {
+		if _, seen := id.seen[id.id]; id.valid && !seen {
+			id.seen[id.id] = line
+		}
+	}
+	return false, nil
+}
+
+// parseCSVRecord converts a string slice from the CSV into a structured CSVRecord,
+// locating each column through layout.
+// It now decodes the raw request and response data from Base64.
+func parseCSVRecord(record []string, layout columnLayout, enc rawEncodings) (CSVRecord, error) {
+	if width := layout.width(); len(record) < width {
+		return CSVRecord{}, fmt.Errorf("row has %d fields, expected at least %d", len(record), width)
+	}
+
+	field := func(name string) string {
+		i, ok := layout[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+
+    // Helper function to parse boolean values
+	parseBool := func(s string) bool {
+		val, _ := strconv.ParseBool(trimCR(s))
+		return val
+	}
+    
+	// Helper function to parse nullable booleans; blank or unrecognized
+	// values are unknown
+	parseNullBool := func(s string) sql.NullBool {
+		val, err := strconv.ParseBool(trimCR(s))
+		if err != nil {
+			return sql.NullBool{}
+		}
+		return sql.NullBool{Bool: val, Valid: true}
+	}
+
+    // Helper function to parse integers
+	parseInt := func(s string) int64 {
+		val, _ := strconv.ParseInt(trimCR(s), 10, 64)
+		return val
+	}
+    
+    // Helper function to parse nullable integers
+	parseNullInt := func(s string) sql.NullInt64 {
+		s = trimCR(s)
+		if s == "" {
+			return sql.NullInt64{}
+		}
+		val, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return sql.NullInt64{}
+		}
+		return sql.NullInt64{Int64: val, Valid: true}
+	}
+
+	// **Decode raw request and response, from Base64 unless configured otherwise**
+	rawRequest, err := decodeRaw(field("raw"), enc.Request)
+	if err != nil {
+		return CSVRecord{}, fmt.Errorf("failed to decode raw request: %w", err)
+	}
+
+	rawResponse, err := decodeRaw(field("response_raw"), enc.Response)
+	if err != nil {
+		return CSVRecord{}, fmt.Errorf("failed to decode raw response: %w", err)
+	}
+
+	// Messages given as separate header and body columns are assembled.
+	if rawRequest, err = messageFromColumns(rawRequest, field("request_headers"), field("request_body"), enc.Request, "request"); err != nil {
+		return CSVRecord{}, err
+	}
+	// A response_headers column may leave out the status line, and rows
+	// driven by a url column need no headers at all.
+	responseHead := field("response_headers")
+	if strings.TrimSpace(responseHead) != "" || (field("url") != "" && len(rawResponse) == 0) {
+		responseHead = withStatusLine(responseHead, int(parseInt(field("response_status_code"))))
+	}
+	if rawResponse, err = messageFromColumns(rawResponse, responseHead, field("response_body"), enc.Response, "response"); err != nil {
+		return CSVRecord{}, err
+	}
+
+
+	parsed := CSVRecord{
+		ID:                 parseInt(field("id")),
+		Host:               field("host"),
+		Method:             field("method"),
+		Path:               field("path"),
+		Length:             parseInt(field("length")),
+		Port:               int(parseInt(field("port"))),
+		Raw:                rawRequest, // Use decoded data
+		IsTLS:              parseBool(field("is_tls")),
+		Query:              field("query"),
+		FileExtensions:     field("file_extensions"),
+		Source:             field("source"),
+		Alteration:         field("alteration"),
+		Edited:             parseNullBool(field("edited")),
+		ParentID:           parseNullInt(field("parent_id")),
+		CreatedAt:          parseInt(field("created_at")),
+		ResponseID:         parseNullInt(field("response_id")),
+		ResponseStatusCode: int(parseInt(field("response_status_code"))),
+		ResponseRaw:        rawResponse, // Use decoded data
+		ResponseLength:     parseInt(field("response_length")),
+		ResponseAlteration: field("response_alteration"),
+		ResponseEdited:     parseNullBool(field("response_edited")),
+		ResponseParentID:   parseNullInt(field("response_parent_id")),
+		ResponseCreatedAt:  parseInt(field("response_created_at")),
+		Intercept:          parseNullBool(field("intercept")),
+		InterceptPosition:  parseNullInt(field("intercept_position")),
+		RequestSentAt:      parseNullInt(field("request_sent_at")),
+		ResponseReceivedAt: parseNullInt(field("response_received_at")),
+		RoundtripTime:      parseNullInt(field("roundtrip_time")),
+	}
+	if rawURL := field("url"); rawURL != "" {
+		if err := requestFromURL(&parsed, rawURL); err != nil {
+			return CSVRecord{}, err
+		}
+	}
+	if enc.Gunzip {
+		if err := gunzipRawColumns(&parsed); err != nil {
+			return CSVRecord{}, err
+		}
+	}
+	if err := fillMissingColumns(&parsed, layout); err != nil {
+		return CSVRecord{}, err
+	}
+	return parsed, nil
+}
+
+// trimCR removes trailing carriage returns, which encoding/csv leaves on the
+// last field of a row ending in "\r\r\n" and on fields of files with mixed
+// line endings.
+func trimCR(s string) string {
+	return strings.TrimRight(s, "\r")
+}
+
+// normalizeRecord sanity-checks a parsed record and fills in defaults so that
+// the inserted request can be replayed from Caido.
+func (c *Converter) normalizeRecord(record *CSVRecord) error {
+	if c.opts.SplitRawMarker != "" {
+		request, response, err := splitCombinedMessage(record.Raw, c.opts.SplitRawMarker)
+		if err != nil {
+			return fmt.Errorf("failed to split raw column for row %d: %w", record.ID, err)
+		}
+		record.Raw, record.ResponseRaw = request, response
+		if err := deriveFromRaw(record); err != nil {
+			return fmt.Errorf("failed to derive fields for row %d: %w", record.ID, err)
+		}
+	}
+
+	if err := c.checkPrecompressed(record); err != nil {
+		return err
+	}
+
+	if err := c.checkChunked(record); err != nil {
+		return err
+	}
+
+	if err := c.redactHeaders(record); err != nil {
+		return err
+	}
+
+	if err := c.checkLengths(record); err != nil {
+		return err
+	}
+
+	if err := c.checkRawSize(record); err != nil {
+		return err
+	}
+
+	if c.opts.ValidateRaw {
+		if err := validateRawMessages(record); err != nil {
+			return err
+		}
+	}
+
+	if err := c.normalizeMethod(record); err != nil {
+		return err
+	}
+
+	if err := c.resolveRoundtrip(record); err != nil {
+		return err
+	}
+
+	if err := c.checkStatusCode(record); err != nil {
+		return err
+	}
+
+	for _, t := range c.opts.Transforms {
+		if err := t.apply(record); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.NormalizeHost {
+		record.Host = normalizeHost(record.Host, record.IsTLS)
+	}
+	if c.opts.HostAliases != nil {
+		record.Host = c.opts.HostAliases.canonical(record.Host)
+	}
+
+	if c.opts.NormalizeQuery && record.Query != "" {
+		query, err := normalizeQuery(record.Query)
+		switch {
+		case err == nil:
+			record.Query = query
+		case c.opts.Strict:
+			return fmt.Errorf("malformed query for host %s: %w", record.Host, err)
+		default:
+			log.Printf("[WARN] Keeping malformed query for host %s as-is: %v", record.Host, err)
+		}
+	}
+
+	if err := c.resolveExtension(record); err != nil {
+		return err
+	}
+
+	record.Edited = c.resolveEdited(record.Edited, "requests")
+	record.ResponseEdited = c.resolveEdited(record.ResponseEdited, "responses")
+
+	record.Source = mapValue(c.opts.SourceMap, record.Source)
+	record.Alteration = mapValue(c.opts.AlterationMap, record.Alteration)
+	record.ResponseAlteration = mapValue(c.opts.AlterationMap, record.ResponseAlteration)
+	for _, alteration := range []string{record.Alteration, record.ResponseAlteration} {
+		if err := c.checkAlteration(alteration, record.Host); err != nil {
+			return err
+		}
+	}
+
+	if record.Port < 0 || record.Port > 65535 {
+		if c.opts.Strict {
+			return fmt.Errorf("port %d out of range for host %s", record.Port, record.Host)
+		}
+		log.Printf("[WARN] Port %d out of range for host %s, using default", record.Port, record.Host)
+		record.Port = 0
+	}
+	if record.Port == 0 {
+		record.Port = c.defaultPort(record.IsTLS)
+	}
+
+	if c.opts.NoRaw {
+		// Dropped last, so columns derived from the raw messages and their
+		// lengths are still filled in.
+		record.Raw, record.ResponseRaw = []byte{}, []byte{}
+		return nil
+	}
+	if c.opts.CompressRaw {
+		raw, err := compressHTTPMessage(record.Raw)
+		if err != nil {
+			return fmt.Errorf("failed to compress raw request: %w", err)
+		}
+		rawResponse, err := compressHTTPMessage(record.ResponseRaw)
+		if err != nil {
+			return fmt.Errorf("failed to compress raw response: %w", err)
+		}
+		record.Length = adjustLength(record.Length, record.Raw, raw)
+		record.ResponseLength = adjustLength(record.ResponseLength, record.ResponseRaw, rawResponse)
+		record.Raw, record.ResponseRaw = raw, rawResponse
+	}
+	return nil
+}
+
+// normalizeMethod uppercases the method column and reports methods that are
+// not known HTTP methods, unless Options.MethodPassthrough is set. The raw
+// request is left as-is.
+func (c *Converter) normalizeMethod(record *CSVRecord) error {
+	if c.opts.MethodPassthrough || record.Method == "" {
+		return nil
+	}
+	record.Method = strings.ToUpper(record.Method)
+	if knownMethods[record.Method] {
+		return nil
+	}
+	if c.opts.StrictMethod {
+		return fmt.Errorf("unknown method %q for host %s", record.Method, record.Host)
+	}
+	log.Printf("[WARN] Unknown method %q for host %s", record.Method, record.Host)
+	return nil
+}
+
+// alterationPattern is the grammar of alteration values: one or more
+// colon-separated segments of letters, digits, '_', '-' and '.', each
+// starting with a letter or digit, e.g. "none" or "match-replace:header".
+var alterationPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*(:[A-Za-z0-9][A-Za-z0-9_.-]*)*$`)
+
+// checkAlteration reports an alteration value that does not match
+// alterationPattern. Blank values are allowed.
+func (c *Converter) checkAlteration(alteration, host string) error {
+	if alteration == "" || alterationPattern.MatchString(alteration) {
+		return nil
+	}
+	if c.opts.StrictAlteration {
+		return fmt.Errorf("malformed alteration %q for host %s", alteration, host)
+	}
+	log.Printf("[WARN] Malformed alteration %q for host %s", alteration, host)
+	return nil
+}
+
+// checkStatusCode compares ResponseStatusCode with the status line of
+// ResponseRaw, applying Options.TrustStatus when they disagree. A blank (zero)
+// status code is filled in from the raw response. Raw responses without a
+// parseable status line are not checked.
+func (c *Converter) checkStatusCode(record *CSVRecord) error {
+	if len(record.ResponseRaw) == 0 {
+		return nil
+	}
+	line, _, _ := bytes.Cut(record.ResponseRaw, []byte("\n"))
+	rawCode, err := parseStatusLine(strings.TrimRight(string(line), "\r"))
+	if err != nil {
+		c.debugf("Not checking status code for host %s: %v", record.Host, err)
+		return nil
+	}
+	if record.ResponseStatusCode == 0 {
+		record.ResponseStatusCode = rawCode
+		return nil
+	}
+	if record.ResponseStatusCode == rawCode {
+		return nil
+	}
+
+	switch c.opts.TrustStatus {
+	case TrustStatusRaw:
+		log.Printf("[WARN] Status code %d for host %s disagrees with raw response, using %d", record.ResponseStatusCode, record.Host, rawCode)
+		record.ResponseStatusCode = rawCode
+	case TrustStatusColumn:
+		log.Printf("[WARN] Status code %d for host %s disagrees with raw response (%d), keeping %d", record.ResponseStatusCode, record.Host, rawCode, record.ResponseStatusCode)
+	default:
+		if c.opts.Strict {
+			return fmt.Errorf("status code %d for host %s disagrees with raw response (%d)", record.ResponseStatusCode, record.Host, rawCode)
+		}
+		log.Printf("[WARN] Status code %d for host %s disagrees with raw response (%d)", record.ResponseStatusCode, record.Host, rawCode)
+	}
+	return nil
+}
+
+// checkLengths applies Options.CheckLengths to the length columns of a
+// record. Lengths are compared with the raw messages as decoded, before they
+// are truncated or compressed; blank (zero) lengths are not checked.
+func (c *Converter) checkLengths(record *CSVRecord) error {
+	if c.opts.CheckLengths == "" {
+		return nil
+	}
+	for _, field := range []struct {
+		column string
+		raw    []byte
+		length *int64
+	}{
+		{"length", record.Raw, &record.Length},
+		{"response_length", record.ResponseRaw, &record.ResponseLength},
+	} {
+		actual := int64(len(field.raw))
+		if *field.length == 0 || *field.length == actual {
+			continue
+		}
+		// Some tools record the size of a chunked message after decoding.
+		hint := ""
+		if n, ok := dechunkedLength(field.raw); ok && n == *field.length {
+			hint = " (it is the size of the message de-chunked; see -dechunk)"
+		}
+		if c.opts.CheckLengths == CheckLengthsReport {
+			return fmt.Errorf("%s %d for host %s disagrees with the %d-byte raw message%s", field.column, *field.length, record.Host, actual, hint)
+		}
+		log.Printf("[WARN] %s %d for host %s disagrees with the %d-byte raw message, using %d%s", field.column, *field.length, record.Host, actual, actual, hint)
+		*field.length = actual
+	}
+	return nil
+}
+
+// checkChunked checks the framing of raw messages sent with
+// Transfer-Encoding: chunked and, with Options.Dechunk, replaces them with
+// dechunkHTTPMessage, adjusting lengths that were the size of the chunked
+// message. Broken framing fails the row with Options.Dechunk, ValidateRaw or
+// Strict, and is logged otherwise.
+func (c *Converter) checkChunked(record *CSVRecord) error {
+	for _, m := range []struct {
+		kind   string
+		raw    *[]byte
+		length *int64
+	}{
+		{"request", &record.Raw, &record.Length},
+		{"response", &record.ResponseRaw, &record.ResponseLength},
+	} {
+		body, ok := chunkedBody(*m.raw)
+		if !ok {
+			continue
+		}
+		if _, err := decodeChunkedBody(body); err != nil {
+			if c.opts.Dechunk || c.opts.ValidateRaw || c.opts.Strict {
+				return fmt.Errorf("raw %s for host %s has invalid chunked framing: %v", m.kind, record.Host, err)
+			}
+			log.Printf("[WARN] Raw %s for host %s has invalid chunked framing: %v", m.kind, record.Host, err)
+			continue
+		}
+		if !c.opts.Dechunk {
+			continue
+		}
+		raw, err := dechunkHTTPMessage(*m.raw)
+		if err != nil {
+			return fmt.Errorf("failed to de-chunk raw %s: %w", m.kind, err)
+		}
+		*m.length = adjustLength(*m.length, *m.raw, raw)
+		*m.raw = raw
+	}
+	return nil
+}
+
+// resolveRoundtrip sets RoundtripTime to the time between RequestSentAt and
+// ResponseReceivedAt when both are given, and otherwise keeps the
+// roundtrip_time column. Negative durations and a single timestamp are
+// anomalies: they fail the row under Strict, and are otherwise logged and
+// fall back to the next source, ending with 0.
+func (c *Converter) resolveRoundtrip(record *CSVRecord) error {
+	anomaly := func(format string, args ...any) error {
+		msg := fmt.Sprintf(format, args...)
+		if c.opts.Strict {
+			return fmt.Errorf("%s for host %s", msg, record.Host)
+		}
+		log.Printf("[WARN] %s for host %s, ignoring it", msg, record.Host)
+		return nil
+	}
+
+	sent, received := record.RequestSentAt, record.ResponseReceivedAt
+	switch {
+	case sent.Valid && received.Valid:
+		d := received.Int64 - sent.Int64
+		if d >= 0 {
+			record.RoundtripTime = sql.NullInt64{Int64: d, Valid: true}
+			return nil
+		}
+		if err := anomaly("response_received_at is %d ms before request_sent_at", -d); err != nil {
+			return err
+		}
+	case sent.Valid || received.Valid:
+		if err := anomaly("request_sent_at and response_received_at must be given together"); err != nil {
+			return err
+		}
+	}
+	if record.RoundtripTime.Int64 < 0 {
+		if err := anomaly("negative roundtrip_time %d", record.RoundtripTime.Int64); err != nil {
+			return err
+		}
+		record.RoundtripTime = sql.NullInt64{}
+	}
+	return nil
+}
+
+// resolveEdited fills in an unknown edited value for table from
+// Options.EditedDefault, or with false when the column is NOT NULL.
+func (c *Converter) resolveEdited(edited sql.NullBool, table string) sql.NullBool {
+	if edited.Valid {
+		return edited
+	}
+	if c.opts.EditedDefault.Valid {
+		return c.opts.EditedDefault
+	}
+	if c.nullableEdited[table] {
+		return edited
+	}
+	return sql.NullBool{Valid: true}
+}
+
+// deriveFromRaw fills in blank request and response fields from the raw
+// messages: method, host, path and query from the request line and Host
+// header (or from an absolute-form or CONNECT target, which also sets the
+// port and TLS), the status code from the status line, and both lengths.
+func deriveFromRaw(record *CSVRecord) error {
+	if len(record.Raw) > 0 {
+		msg, err := parseHTTPMessage(record.Raw)
+		if err != nil {
+			return fmt.Errorf("raw request: %w", err)
+		}
+		method, target, _, err := parseRequestLine(msg.StartLine)
+		if err != nil {
+			return fmt.Errorf("raw request: %w", err)
+		}
+		if record.Method == "" {
+			record.Method = method
+		}
+		rt, err := parseRequestTarget(method, target)
+		if err != nil {
+			return fmt.Errorf("raw request: %w", err)
+		}
+		if record.Path == "" {
+			record.Path = rt.Path
+		}
+		if record.Query == "" {
+			record.Query = rt.Query
+		}
+		// An absolute-form or CONNECT target names the destination itself and
+		// takes precedence over the Host header.
+		if rt.Host != "" && record.Host == "" {
+			record.Host = rt.Host
+			if record.Port == 0 {
+				record.Port = rt.Port
+			}
+			record.IsTLS = record.IsTLS || rt.IsTLS
+		}
+		if hostHeader, ok := msg.Header("Host"); ok && record.Host == "" {
+			host, port := splitHostPort(strings.TrimSpace(hostHeader))
+			record.Host = host
+			if record.Port == 0 {
+				record.Port = port
+			}
+		}
+		if record.Length == 0 {
+			record.Length = int64(len(record.Raw))
+		}
+	}
+
+	if len(record.ResponseRaw) > 0 {
+		msg, err := parseHTTPMessage(record.ResponseRaw)
+		if err != nil {
+			return fmt.Errorf("raw response: %w", err)
+		}
+		code, err := parseStatusLine(msg.StartLine)
+		if err != nil {
+			return fmt.Errorf("raw response: %w", err)
+		}
+		if record.ResponseStatusCode == 0 {
+			record.ResponseStatusCode = code
+		}
+		if record.ResponseLength == 0 {
+			record.ResponseLength = int64(len(record.ResponseRaw))
+		}
+	}
+	return nil
+}
+
+// splitHostPort splits an optional port from a host, returning 0 when no
+// valid port is present.
+func splitHostPort(hostport string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.Trim(hostport, "[]"), 0
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, 0
+	}
+	return host, port
+}
+
+// requestLinePattern matches a request line: a method token, a target and an
+// HTTP version, separated by single spaces.
+var requestLinePattern = regexp.MustCompile(`^[!#$%&'*+\-.^_\x60|~0-9A-Za-z]+ [^ ]+ HTTP/[0-9](\.[0-9])?$`)
+
+// validateRawMessages checks that a non-empty raw request starts with a
+// request line and a non-empty raw response with "HTTP/", which Caido needs
+// to replay and display them.
+func validateRawMessages(record *CSVRecord) error {
+	if len(record.Raw) > 0 {
+		line, _, _ := bytes.Cut(record.Raw, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if !requestLinePattern.Match(line) {
+			return fmt.Errorf("raw request for host %s does not start with a request line: %q", record.Host, truncateForLog(line))
+		}
+	}
+	if len(record.ResponseRaw) > 0 && !bytes.HasPrefix(record.ResponseRaw, []byte("HTTP/")) {
+		line, _, _ := bytes.Cut(record.ResponseRaw, []byte("\n"))
+		return fmt.Errorf("raw response for host %s does not start with HTTP/: %q", record.Host, truncateForLog(line))
+	}
+	return nil
+}
+
+// truncateForLog shortens b to a length suitable for an error message.
+func truncateForLog(b []byte) []byte {
+	const limit = 60
+	if len(b) > limit {
+		return b[:limit]
+	}
+	return b
+}
+
+// normalizeQuery decodes each parameter of a query string and encodes it
+// again with url.QueryEscape, so equivalent queries are stored the same way:
+// "a=x y&b=%7e" becomes "a=x+y&b=~". Parameter order, repeated keys and
+// parameters without "=" are kept; empty parameters are dropped. Invalid
+// percent-encoding is an error.
+func normalizeQuery(query string) (string, error) {
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(param, "=")
+		k, err := url.QueryUnescape(key)
+		if err != nil {
+			return "", fmt.Errorf("parameter %q: %w", param, err)
+		}
+		normalized := url.QueryEscape(k)
+		if hasValue {
+			v, err := url.QueryUnescape(value)
+			if err != nil {
+				return "", fmt.Errorf("parameter %q: %w", param, err)
+			}
+			normalized += "=" + url.QueryEscape(v)
+		}
+		params = append(params, normalized)
+	}
+	return strings.Join(params, "&"), nil
+}
+
+// normalizeHost lowercases host and removes trailing dots and a port that is
+// the default for the scheme (443 with TLS, 80 without). Other ports are
+// kept.
+func normalizeHost(host string, isTLS bool) string {
+	host = strings.ToLower(host)
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return strings.TrimRight(host, ".")
+	}
+	h = strings.TrimRight(h, ".")
+	if (isTLS && port == "443") || (!isTLS && port == "80") {
+		return h
+	}
+	return net.JoinHostPort(h, port)
+}
+
+// checkRawSize enforces Options.MaxRawBytes on the raw request and response.
+func (c *Converter) checkRawSize(record *CSVRecord) error {
+	limit := c.opts.MaxRawBytes
+	if limit <= 0 {
+		return nil
+	}
+	for _, field := range []struct {
+		name   string
+		raw    *[]byte
+		length *int64
+	}{
+		{"raw request", &record.Raw, &record.Length},
+		{"raw response", &record.ResponseRaw, &record.ResponseLength},
+	} {
+		size := int64(len(*field.raw))
+		if size <= limit {
+			continue
+		}
+		if c.opts.OversizePolicy != OversizeTruncate {
+			return withReason(reasonOversize, fmt.Errorf("%s for host %s is %d bytes, exceeding limit of %d", field.name, record.Host, size, limit))
+		}
+		log.Printf("[WARN] Truncating %s for host %s from %d to %d bytes", field.name, record.Host, size, limit)
+		truncated := (*field.raw)[:limit]
+		*field.length = adjustLength(*field.length, *field.raw, truncated)
+		*field.raw = truncated
+	}
+	return nil
+}
+
+// adjustLength keeps a stored length in step with a rewritten raw message when
+// it previously described the original bytes.
+func adjustLength(length int64, before, after []byte) int64 {
+	if length == int64(len(before)) {
+		return int64(len(after))
+	}
+	return length
+}
+
+// defaultPort returns the port used when a record does not specify one.
+func (c *Converter) defaultPort(isTLS bool) int {
+	if c.opts.PortDefault != 0 {
+		return c.opts.PortDefault
+	}
+	if isTLS {
+		return 443
+	}
+	return 80
+}
+
+// insertData orchestrates the insertion of response and request data.
+func (c *Converter) insertData(ctx context.Context, record CSVRecord) error {
+	responseOnly := c.opts.ResponseOnly != "" && isResponseOnly(record)
+	if responseOnly && c.opts.ResponseOnly == ResponseOnlySynthesize {
+		synthesizeRequest(&record)
+	}
+
+	return c.withSavepoint(ctx, "csv_import_row", func() error {
+		return c.insertRecord(ctx, record, responseOnly)
+	})
+}
+
+// insertRecord performs insertData's inserts for one record.
+func (c *Converter) insertRecord(ctx context.Context, record CSVRecord, responseOnly bool) error {
+	var responseID sql.NullInt64
+	var id int64
+	// The response has a savepoint of its own so that a failure tolerated
+	// by -tolerate-response-errors does not leave its raw row behind.
+	err := c.withSavepoint(ctx, "csv_import_response", func() (err error) {
+		id, err = c.insertResponse(ctx, record)
+		return err
+	})
+	switch {
+	case err == nil:
+		responseID = sql.NullInt64{Int64: id, Valid: true}
+	case c.opts.TolerateResponseErrors && !responseOnly:
+		log.Printf("[WARN] Inserting request for host %s without its response: %v", record.Host, err)
+	default:
+		return err
+	}
+
+	if responseOnly && c.opts.ResponseOnly == ResponseOnlyStandalone {
+		if c.opts.Verbose {
+			fmt.Printf("Successfully inserted standalone response for host: %s\n", record.Host)
+		}
+		return nil
+	}
+
+	requestID, err := c.insertRequest(ctx, responseID, record)
+	if err != nil {
+		return err
+	}
+
+	// A row's intercept column can only turn the entry off.
+	if c.opts.Mode != ModeSitemapOnly && (!record.Intercept.Valid || record.Intercept.Bool) {
+		_, err = c.insertIntercept(ctx, requestID, record.InterceptPosition)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.opts.SelfTest {
+		if err := c.verifyRecord(ctx, requestID, responseID, record); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.Verbose {
+		fmt.Printf("Successfully inserted request for host: %s\n", record.Host)
+	}
+	return nil
+}
+
+// isResponseOnly reports whether a record has a response but no request.
+func isResponseOnly(record CSVRecord) bool {
+	return len(record.Raw) == 0 && record.Method == "" && len(record.ResponseRaw) > 0
+}
+
+// synthesizeRequest fills in a minimal GET request for a response-only
+// record, using its host, path and query columns.
+func synthesizeRequest(record *CSVRecord) {
+	record.Method = "GET"
+	if record.Path == "" {
+		record.Path = "/"
+	}
+	target := record.Path
+	if record.Query != "" {
+		target += "?" + record.Query
+	}
+	record.Raw = []byte(fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, record.Host))
+	record.Length = int64(len(record.Raw))
+}
+
+// insertResponse inserts the HTTP response data into the database.
+func (c *Converter) insertResponse(ctx context.Context, record CSVRecord) (int64, error) {
+	defer addSince(&c.stats.timings.Responses, time.Now())
+	parentID, err := c.parentFor(ctx, "responses", record.ResponseParentID)
+	if err != nil {
+		return 0, err
+	}
+
+	rawResponseID, err := c.stmts.insert(ctx, c.stmts.rawResponse,
+		record.ResponseRaw, record.Source, record.ResponseAlteration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into raw.responses_raw: %w", err)
+	}
+	c.track("raw.responses_raw", rawResponseID)
+
+	args := []any{record.ResponseStatusCode, rawResponseID, record.ResponseLength, record.ResponseAlteration, record.ResponseEdited, parentID, record.ResponseCreatedAt, record.RoundtripTime.Int64}
+	if c.stmts.explicitIDs {
+		args = append([]any{record.ResponseID}, args...)
+	}
+	responseID, err := c.stmts.insert(ctx, c.stmts.response, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into responses: %w", err)
+	}
+	c.track("responses", responseID)
+	c.stats.responsesInserted++
+
+	if err := c.stampSession(ctx, c.stmts.responseSession, "responses", responseID); err != nil {
+		return 0, err
+	}
+
+	if err := c.recordIDs(ctx, "responses", responseID, record.ResponseID.Int64, record.ResponseParentID, parentID); err != nil {
+		return 0, err
+	}
+
+	return responseID, nil
+}
+
+// insertRequest inserts the HTTP request data into the database.
+func (c *Converter) insertRequest(ctx context.Context, responseID sql.NullInt64, record CSVRecord) (int64, error) {
+	defer addSince(&c.stats.timings.Requests, time.Now())
+	parentID, err := c.parentFor(ctx, "requests", record.ParentID)
+	if err != nil {
+		return 0, err
+	}
+
+	rawRequestID, err := c.stmts.insert(ctx, c.stmts.rawRequest,
+		record.Raw, record.Source, record.Alteration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into raw.requests_raw: %w", err)
+	}
+	c.track("raw.requests_raw", rawRequestID)
+
+	metadataID, err := c.insertMetadata(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	args := []any{record.Host, record.Method, record.Path, record.Length, record.Port, record.IsTLS, rawRequestID, record.Query, responseID, record.Source, record.Alteration, record.Edited, parentID, record.CreatedAt, metadataID}
+	if c.stmts.explicitIDs {
+		args = append([]any{record.ID}, args...)
+	}
+	requestID, err := c.stmts.insert(ctx, c.stmts.request, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into requests: %w", err)
+	}
+	c.track("requests", requestID)
+
+	if err := c.recordIDs(ctx, "requests", requestID, record.ID, record.ParentID, parentID); err != nil {
+		return 0, err
+	}
+
+	if err := c.stampSession(ctx, c.stmts.requestSession, "requests", requestID); err != nil {
+		return 0, err
+	}
+
+	if c.stmts.tag != nil {
+		if err := c.stmts.exec(ctx, c.stmts.tag, requestID, c.opts.Tag); err != nil {
+			return 0, fmt.Errorf("failed to insert into csv_import_tags: %w", err)
+		}
+		c.track("csv_import_tags", requestID)
+	}
+
+	if err := c.traceSource(ctx, requestID, record); err != nil {
+		return 0, err
+	}
+
+	if c.stmts.extension != nil {
+		if err := c.stmts.exec(ctx, c.stmts.extension, record.FileExtensions, requestID); err != nil {
+			return 0, fmt.Errorf("failed to store file extension: %w", err)
+		}
+	}
+
+	return requestID, nil
+}
+
+// insertIntercept adds the request to the intercept view. When the queue is
+// ordered, the entry goes to position, counted from the end of the queue as
+// it was before the import, or after the last entry if position is NULL.
+func (c *Converter) insertIntercept(ctx context.Context, requestID int64, position sql.NullInt64) (int64, error) {
+	defer addSince(&c.stats.timings.Intercepts, time.Now())
+	args := []any{requestID}
+	if c.stmts.interceptPositioned {
+		if position.Valid {
+			base, err := c.interceptBase(ctx)
+			if err != nil {
+				return 0, err
+			}
+			position.Int64 += base
+		}
+		args = append(args, position)
+	} else if position.Valid && !c.warnedPosition {
+		log.Println("[WARN] intercept_entries has no position column; ignoring intercept_position")
+		c.warnedPosition = true
+	}
+	interceptID, err := c.stmts.insert(ctx, c.stmts.intercept, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into intercept_entries: %w", err)
+	}
+	c.track("intercept_entries", interceptID)
+	return interceptID, nil
+}
+
+// interceptBase returns the last position in the intercept queue before the
+// import's first explicit position, reading it the first time.
+func (c *Converter) interceptBase(ctx context.Context) (int64, error) {
+	if !c.queueEnd.Valid {
+		table := c.stagedTable("intercept_entries", c.opts.TablePrefix)
+		if err := c.conn().QueryRowContext(ctx, "SELECT coalesce(max(position), 0) FROM "+table).Scan(&c.queueEnd.Int64); err != nil {
+			return 0, fmt.Errorf("failed to read the end of the intercept queue: %w", err)
+		}
+		c.queueEnd.Valid = true
+	}
+	return c.queueEnd.Int64, nil
+}
+
+// openDB connects to the main and raw Caido databases. A non-empty key opens
+// them as SQLCipher-encrypted databases. It returns what the project's schema
+// supports, including the schema name under which the raw tables are found;
+// see detectSchema and attachRawDatabase. A non-empty txMode sets how its
+// transactions begin.
+func openDB(projectPath, key string, rawDBs rawDatabaseList, txMode string) (*sql.DB, projectSchema, error) {
+	dbPath := projectPath + "/database.caido"
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil, projectSchema{}, fmt.Errorf("caido main database does not exist at %s", dbPath)
+	}
+
+	var txLock string
+	if txMode != "" {
+		txLock = "_txlock=" + txMode
+	}
+	var db *sql.DB
+	var err error
+	if key != "" {
+		if txLock != "" {
+			txLock = "?" + txLock
+		}
+		db, err = openKeyedDB(dbPath+txLock, key)
+	} else {
+		if txLock != "" {
+			txLock = "&" + txLock
+		}
+		db, err = sql.Open(sqliteDriver, dbPath+dsnParams+txLock)
+	}
+	if err != nil {
+		return nil, projectSchema{}, fmt.Errorf("error opening database.caido: %v", err)
+	}
+	// ATTACH and PRAGMAs only apply to the connection they run on.
+	db.SetMaxOpenConns(1)
+	log.Println("[INFO] Opened database.caido")
+
+	requestRaw, responseRaw, err := attachRawDatabase(db, projectPath, key, rawDBs)
+	if err != nil {
+		db.Close()
+		return nil, projectSchema{}, err
+	}
+	schema, err := detectSchema(db, requestRaw, responseRaw)
+	if err != nil {
+		db.Close()
+		return nil, projectSchema{}, err
+	}
+	return db, schema, nil
+}
+
+func main() {
+	projectPath := flag.String("p", "", "Path to the Caido project directory (default $"+projectEnv+")")
+	csvPath := flag.String("f", "", "Path or http(s) URL of the CSV file to import (default $"+csvEnv+")")
+	insecure := flag.Bool("insecure", false, "Do not verify the TLS certificate of an https -f URL")
+	format := flag.String("format", "csv", "Input format: csv, jsonl, burp-xml (Burp Suite's Save items), or ws-csv for WebSocket frames")
+	portDefault := flag.Int("port-default", 0, "Port used for blank or zero ports (default: 443 for TLS, 80 otherwise)")
+	errorsPath := flag.String("errors", "", "Write each failed row, with its error and original fields, to this file as a JSON line as soon as it fails")
+	statePath := flag.String("state", "", "Skip rows whose id is recorded in this SQLite file by an earlier run, and record the ids of the rows imported")
+	retryPath := flag.String("retry", "", "Import the rows of an -errors report, after correcting them, instead of -f")
+	maxErrors := flag.Int("max-errors", 0, "Stop the import with an error once this many rows have failed (0 for no limit)")
+	limitHosts := flag.Int("limit-hosts", 0, "Stop the import with an error once rows for more than this many distinct hosts have been read (0 for no limit)")
+	strict := flag.Bool("strict", false, "Reject rows with invalid data instead of correcting them")
+	noRaw := flag.Bool("no-raw", false, "Store empty raw requests and responses, importing only their columns for a quick overview")
+	compressRaw := flag.Bool("compress-raw", false, "Gzip raw request/response bodies and set Content-Encoding before storing")
+	rawPrecompressed := flag.String("raw-precompressed", "", "Check raw messages and bodies the export already gzipped, and store gzip bodies as they are (keep) or decompressed (decompress)")
+	dechunk := flag.Bool("dechunk", false, "Store chunked raw messages with a flat body and Content-Length instead of their chunks")
+	redact := flag.String("redact", "", "Replace the values of these comma-separated headers in the raw messages with REDACTED; \"default\" stands for Authorization, Cookie, Set-Cookie and other credentials")
+	maxRawBytes := flag.Int64("max-raw-bytes", 0, "Maximum size of a raw request or response in bytes (0 for no limit)")
+	maxFieldBytes := flag.Int64("max-field-bytes", 0, "Maximum size of a CSV field in bytes as read, before decoding; larger fields fail their row (0 for no limit)")
+	oversizePolicy := flag.String("oversize-policy", OversizeReject, "What to do with rows over -max-raw-bytes: reject or truncate")
+	splitRaw := flag.String("split-raw", "", "Split a combined request+response in the raw column at this marker (\"blank\" for the blank line before the status line)")
+	responseOnly := flag.String("response-only", "", "Import rows without a request as \"synthesize\" (minimal GET request) or \"standalone\" (response only)")
+	var transforms transformList
+	flag.Var(&transforms, "transform", "Rewrite a field before insertion with a `rule` such as host=s/^staging-// (repeatable)")
+	mapSource := flag.String("map-source", "", "File of key=value lines translating the source column")
+	mapAlteration := flag.String("map-alteration", "", "File of key=value lines translating the alteration columns")
+	uniqueID := flag.String("unique-id", "", "Handle ids and response_ids repeated within the file: skip later rows or error to abort (default: warn only)")
+	logPath := flag.String("log", "", "Append log messages to this file instead of standard error")
+	failOnMismatch := flag.Bool("fail-on-mismatch", false, "Exit with an error when the requests found in the project after the import differ from the count inserted")
+	failOnEmpty := flag.Bool("fail-on-empty", false, "Exit with an error when the input has no data rows, such as an empty or header-only file")
+	verbose := flag.Bool("verbose", false, "Print every inserted row, with its normalized values and inserted ids")
+	storeExtensions := flag.Bool("store-extensions", false, "Store the file extension in the requests table's file_extension column")
+	extensionSource := flag.String("extension-source", ExtensionsColumn, "Where the file extension of each request comes from: column (the file_extensions column, or the path when blank) or path")
+	manifestPath := flag.String("manifest", "", "Write a JSON manifest describing the import to this file")
+	timeout := flag.Duration("timeout", 0, "Abort the import after this long, e.g. 30m (0 for no limit)")
+	timings := flag.Bool("timings", false, "Print how long the import spent parsing, normalizing, inserting each kind of row, committing and checkpointing")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the import to this file")
+	memProfile := flag.String("memprofile", "", "Write a heap profile taken after the import to this file")
+	initProj := flag.Bool("init", false, "Create the project databases before importing")
+	force := flag.Bool("force", false, "Allow -init to import into a project that already has databases, -safe into one that appears open, -replace to delete rows, and importing an export of the project into itself")
+	tablePrefix := flag.String("table-prefix", "", "Insert rows into staging copies of the tables named with this prefix (e.g. import_), to review before -promote")
+	promote := flag.Bool("promote", false, "Move the rows staged with -table-prefix into the live tables instead of importing -f")
+	fixSequences := flag.Bool("fix-sequences", false, "After importing, raise each table's id sequence to at least its largest id, so ids are never reused")
+	routePath := flag.String("route", "", "File of host=project lines sending each row to the project its host matches (*.example.com for subdomains, - to reject); other rows go to -p")
+	routeParallel := flag.Bool("route-parallel", false, "Write each -route project from a worker of its own, in parallel with the others")
+	replace := flag.String("replace", "", "Comma-separated hosts whose existing requests are deleted before importing; requires -force and -atomic")
+	var rawDBs rawDatabaseList
+	flag.Var(&rawDBs, "raw-db", "Attach the database at `name=path` (relative to the project) to find requests_raw and responses_raw in, instead of database_raw.caido (repeatable)")
+	keySpec := flag.String("key", "", "Key for encrypted projects, read from env:NAME or file:PATH")
+	rate := flag.Float64("rate", 0, "Limit inserts to this many rows per second (0 for no limit)")
+	updateScope := flag.Bool("update-scope", false, "Add imported hosts to the project's \"CSV Import\" scope")
+	mode := flag.String("mode", ModeFull, "Which Caido views to populate (full or sitemap-only)")
+	sortBy := flag.String("sort-by", "", "Insert rows sorted by this column (created_at); buffers the whole input in memory")
+	readonlyCheck := flag.Bool("readonly-check", false, "Verify write access to the project before importing")
+	validateSchemaOnly := flag.Bool("validate-schema-only", false, "Only check that -p is a writable project whose schema can be imported into, without reading -f")
+	undoPath := flag.String("undo", "", "Delete the rows recorded in this import manifest instead of importing")
+	editedDefault := flag.String("edited-default", "", "Value stored for blank edited columns: true or false (default: NULL where the schema allows, else false)")
+	tolerateResponseErrors := flag.Bool("tolerate-response-errors", false, "Insert the request without its response when the response fails to insert")
+	columns := flag.String("columns", "", "Comma-separated column names in file order, for CSVs without a header or in another order (e.g. host,method,path,raw)")
+	specPath := flag.String("spec", "", "Check the CSV header and rows against the column names, types and required columns declared in this file")
+	validateRaw := flag.Bool("validate-raw", false, "Reject rows whose raw request does not start with a request line or whose raw response does not start with HTTP/")
+	preserveIDs := flag.Bool("preserve-ids", false, "Insert requests and responses with the id and response_id of the input instead of new ids; refuses to import if any is missing, repeated or in use")
+	latestResponse := flag.Bool("latest-response", false, "Of rows sharing an id, import only the one with the latest response_created_at")
+	fastUnsafe := flag.Bool("fast-unsafe", false, "Turn off syncing and the WAL during the import for speed; a crash mid-import can corrupt the project")
+	reopen := flag.Int("reopen", 0, "Reopen the project up to this many times after database connection errors, retrying the failed row")
+	checkpointEvery := flag.Int("checkpoint-every", 0, "Checkpoint the WAL into the databases every this many rows, to keep it small during long imports (0 to leave it to SQLite)")
+	dedup := flag.Bool("dedup", false, "Skip rows whose request is already in the project or earlier in the input, using a bloom filter and a lookup to confirm")
+	dedupExpected := flag.Int("dedup-expected", defaultDedupExpected, "Number of requests, in the project and the input, to size the -dedup bloom filter for")
+	dedupFPRate := flag.Float64("dedup-fp-rate", defaultDedupFPRate, "False positive rate of the -dedup bloom filter; each false positive costs a lookup in the project")
+	commitEvery := flag.Int("commit-every", 0, "Insert rows in transactions of this many rows (0 to commit every insert)")
+	resume := flag.Bool("resume", false, "Record the input line each -commit-every batch reaches in the project's csv_import_progress table, in the batch's transaction, and skip the rows up to it when an interrupted import of the same file is run again")
+	traceSource := flag.Bool("trace-source", false, "Record the input file and line of every imported request in csv_import_sources")
+	txMode := flag.String("tx-mode", TxImmediate, "How -commit-every and other transactions begin: immediate takes the write lock up front, deferred at the first write")
+	strictMethod := flag.Bool("strict-method", false, "Reject rows whose method is not a known HTTP method instead of warning")
+	methodPassthrough := flag.Bool("method-passthrough", false, "Store methods as given, without uppercasing or checking them")
+	since := flag.String("since", "", "Skip rows created before this time (RFC 3339 or unix timestamp)")
+	until := flag.String("until", "", "Skip rows created at or after this time (RFC 3339 or unix timestamp)")
+	minTime := flag.String("min-time", defaultMinTime, "Warn about created_at values before this time, or convert them from seconds or other units that fit (\"none\" to turn off)")
+	maxTime := flag.String("max-time", "", "Warn about created_at values after this time, or convert them from seconds or other units that fit (default: a day from now; \"none\" to turn off)")
+	export := flag.Bool("export", false, "Write the project's requests as CSV to -f (\"-\" for stdout) instead of importing")
+	checkLengths := flag.String("check-lengths", "", "Compare non-zero length and response_length columns with the raw messages, and \"report\" mismatches as row errors or \"fix\" them")
+	trustStatus := flag.String("trust-status", "", "Resolve status codes that disagree with the raw response using the \"column\" or the \"raw\" status line (default: warn only)")
+	safe := flag.Bool("safe", false, "Refuse to import into a project that appears to be open in Caido")
+	strictAlteration := flag.Bool("strict-alteration", false, "Reject rows with malformed alteration values instead of warning")
+	diff := flag.Bool("diff", false, "Report how many input rows are new or already in the project, without importing")
+	rawEncoding := flag.String("raw-encoding", "", "Encoding of the raw columns: base64 (default), hex or text, or per column as raw=hex,response_raw=base64")
+	session := flag.String("session", "", "Session id to import into, for projects that partition data by session (default: the first session)")
+	strictColumns := flag.Bool("strict-columns", false, "Refuse to import a v2 CSV whose header names unknown columns, such as misspelled ones, instead of ignoring them")
+	trimCRFlag := flag.Bool("trim-cr", false, "Strip trailing carriage returns from every CSV field, for files with stray \\r line endings")
+	normalizeQuery := flag.Bool("normalize-query", false, "Re-encode query strings consistently, keeping parameter order and repeated keys")
+	canonicalHost := flag.String("canonical-host", "", "Store hosts under canonical names, from comma-separated alias=canonical rules (e.g. www.example.com=example.com,*.example.com=example.com) or a file of such lines")
+	normalizeHostFlag := flag.Bool("normalize-host", false, "Lowercase hosts and strip trailing dots and default ports")
+	tag := flag.String("tag", "", "Label every imported request with this text, to find the batch in Caido later")
+	deferParentsFlag := flag.Bool("defer-parents", false, "Insert rows without parent ids and link them after the import, leaving out parents that are not in the project")
+	remapParents := flag.Bool("remap-parents", false, "Treat parent_id and response_parent_id as ids of other rows in the input and link the imported rows")
+	atomic := flag.Bool("atomic", false, "Import into a copy of the project and swap it in only on success")
+	validate := flag.Bool("validate", false, "Only parse and validate the input, without opening a project")
+	printFieldsFlag := flag.Bool("print-fields", false, "Print the input columns with their types, positions, fields and descriptions, and exit")
+	genRows := flag.Int("gen", 0, "Write a synthetic CSV of this many rows to -f instead of importing, for benchmarks")
+	genBodySize := flag.Int("gen-body-size", 512, "Size in bytes of the bodies in -gen rows")
+	selfTest := flag.Bool("selftest", false, "Import the input into a temporary project and check that every row reads back unchanged")
+	emitSQL := flag.String("emit-sql", "", "Write the SQL each row's inserts would run to this file, as a script to review or apply, without changing the project")
+	flag.Usage = usage
+	flag.Parse()
+	if *logPath != "" {
+		f, err := openLogFile(*logPath)
+		if err != nil {
+			log.Fatalf("Failed to open -log file: %v", err)
+		}
+		defer f.Close()
+		// Separates the runs appended to the same file.
+		log.Printf("[INFO] caido-importer %s started", version)
+	}
+
+	if *printFieldsFlag {
+		if err := printFields(os.Stdout); err != nil {
+			log.Fatalf("Failed to print fields: %v", err)
+		}
+		return
+	}
+	if *undoPath != "" {
+		runUndo(*projectPath, *undoPath, mustReadKey(*keySpec), rawDBs)
+		return
+	}
+	// -undo defaults to the manifest's project, so the environment is only
+	// read after it.
+	*projectPath = flagOrEnv(*projectPath, projectEnv)
+	if *validateSchemaOnly {
+		if *projectPath == "" {
+			log.Fatal("Project path (-p or $" + projectEnv + ") is required.")
+		}
+		runSchemaCheck(*projectPath, mustReadKey(*keySpec), rawDBs)
+		return
+	}
+	if *retryPath != "" {
+		if *csvPath != "" || *promote || *export {
+			log.Fatal("-retry imports the rows of the error report instead of -f, -promote or -export.")
+		}
+		*csvPath = *retryPath
+	}
+	*csvPath = flagOrEnv(*csvPath, csvEnv)
+
+	if *promote && *tablePrefix == "" {
+		log.Fatal("-promote needs the -table-prefix the rows were staged with.")
+	}
+	if *csvPath == "" && !*promote {
+		log.Fatal("CSV file path (-f or $" + csvEnv + ") is required.")
+	}
+	if *genRows > 0 {
+		runGenerate(*csvPath, *genRows, *genBodySize)
+		return
+	}
+	if !*validate && !*selfTest && *projectPath == "" {
+		log.Fatal("Both project path (-p or $" + projectEnv + ") and CSV file path (-f or $" + csvEnv + ") are required.")
+	}
+	if *export {
+		runExport(*projectPath, *csvPath, mustReadKey(*keySpec), rawDBs)
+		return
+	}
+	if *format != "csv" && *format != "jsonl" && *format != burpFormat && *format != "ws-csv" {
+		log.Fatalf("Invalid -format %q: must be csv, jsonl, burp-xml or ws-csv.", *format)
+	}
+	if *retryPath != "" {
+		errorsAbs, _ := filepath.Abs(*errorsPath)
+		retryAbs, _ := filepath.Abs(*retryPath)
+		if *errorsPath != "" && errorsAbs == retryAbs {
+			log.Fatal("-errors would overwrite the -retry report; write the remaining failures to another file.")
+		}
+		*format = retryFormat
+	}
+	if *format == "ws-csv" && (isURL(*csvPath) || strings.EqualFold(filepath.Ext(*csvPath), ".zip")) {
+		log.Fatal("-format ws-csv reads a local CSV file, not a URL or zip archive.")
+	}
+	if *format == burpFormat && strings.EqualFold(filepath.Ext(*csvPath), ".zip") {
+		log.Fatal("-format burp-xml reads an XML file, not a zip archive.")
+	}
+	if *portDefault < 0 || *portDefault > 65535 {
+		log.Fatalf("Invalid -port-default %d: must be between 1 and 65535.", *portDefault)
+	}
+	if *responseOnly != "" && *responseOnly != ResponseOnlySynthesize && *responseOnly != ResponseOnlyStandalone {
+		log.Fatalf("Invalid -response-only %q: must be %q or %q.", *responseOnly, ResponseOnlySynthesize, ResponseOnlyStandalone)
+	}
+	if *uniqueID != "" && *uniqueID != UniqueIDSkip && *uniqueID != UniqueIDError {
+		log.Fatalf("Invalid -unique-id %q: must be %q or %q.", *uniqueID, UniqueIDSkip, UniqueIDError)
+	}
+	if *sortBy != "" && *sortBy != SortByCreatedAt {
+		log.Fatalf("Invalid -sort-by %q: only %q is supported.", *sortBy, SortByCreatedAt)
+	}
+	if *extensionSource != ExtensionsColumn && *extensionSource != ExtensionsPath {
+		log.Fatalf("Invalid -extension-source %q: must be %q or %q.", *extensionSource, ExtensionsColumn, ExtensionsPath)
+	}
+	if *mode != ModeFull && *mode != ModeSitemapOnly {
+		log.Fatalf("Invalid -mode %q: must be %q or %q.", *mode, ModeFull, ModeSitemapOnly)
+	}
+	if *strictMethod && *methodPassthrough {
+		log.Fatal("-strict-method and -method-passthrough cannot be used together.")
+	}
+	if *checkLengths != "" && *checkLengths != CheckLengthsReport && *checkLengths != CheckLengthsFix {
+		log.Fatalf("Invalid -check-lengths %q: must be %q or %q.", *checkLengths, CheckLengthsReport, CheckLengthsFix)
+	}
+	if *trustStatus != "" && *trustStatus != TrustStatusColumn && *trustStatus != TrustStatusRaw {
+		log.Fatalf("Invalid -trust-status %q: must be %q or %q.", *trustStatus, TrustStatusColumn, TrustStatusRaw)
+	}
+	if *commitEvery < 0 {
+		log.Fatalf("Invalid -commit-every %d: must not be negative.", *commitEvery)
+	}
+	if *maxErrors < 0 {
+		log.Fatalf("Invalid -max-errors %d: must not be negative.", *maxErrors)
+	}
+	if *limitHosts < 0 {
+		log.Fatalf("Invalid -limit-hosts %d: must not be negative.", *limitHosts)
+	}
+	if *checkpointEvery < 0 {
+		log.Fatalf("Invalid -checkpoint-every %d: must not be negative.", *checkpointEvery)
+	}
+	if *reopen < 0 {
+		log.Fatalf("Invalid -reopen %d: must not be negative.", *reopen)
+	}
+	if *maxFieldBytes < 0 {
+		log.Fatalf("Invalid -max-field-bytes %d: must not be negative.", *maxFieldBytes)
+	}
+	if *txMode != TxDeferred && *txMode != TxImmediate {
+		log.Fatalf("Invalid -tx-mode %q: must be %q or %q.", *txMode, TxDeferred, TxImmediate)
+	}
+	switch *rawPrecompressed {
+	case "", PrecompressedKeep, PrecompressedDecompress:
+	default:
+		log.Fatalf("Invalid -raw-precompressed %q: must be %q or %q.", *rawPrecompressed, PrecompressedKeep, PrecompressedDecompress)
+	}
+	if *oversizePolicy != OversizeReject && *oversizePolicy != OversizeTruncate {
+		log.Fatalf("Invalid -oversize-policy %q: must be %q or %q.", *oversizePolicy, OversizeReject, OversizeTruncate)
+	}
+
+	opts := Options{
+		PortDefault:            *portDefault,
+		Strict:                 *strict,
+		CompressRaw:            *compressRaw,
+		RawPrecompressed:       *rawPrecompressed,
+		MaxRawBytes:            *maxRawBytes,
+		MaxFieldBytes:          *maxFieldBytes,
+		OversizePolicy:         *oversizePolicy,
+		SplitRawMarker:         *splitRaw,
+		ResponseOnly:           *responseOnly,
+		UniqueID:               *uniqueID,
+		Verbose:                *verbose,
+		StoreExtensions:        *storeExtensions,
+		ExtensionSource:        *extensionSource,
+		Rate:                   *rate,
+		SortBy:                 *sortBy,
+		Mode:                   *mode,
+		Transforms:             transforms,
+		TolerateResponseErrors: *tolerateResponseErrors,
+		CommitEvery:            *commitEvery,
+		TxMode:                 *txMode,
+		CheckpointEvery:        *checkpointEvery,
+		Dedup:                  *dedup,
+		DedupExpected:          *dedupExpected,
+		DedupFPRate:            *dedupFPRate,
+		MaxErrors:              *maxErrors,
+		LimitHosts:             *limitHosts,
+		StrictColumns:          *strictColumns,
+		Dechunk:                *dechunk,
+		AllowSelfImport:        *force,
+		Insecure:               *insecure,
+		Reopen:                 *reopen,
+		ParallelRoutes:         *routeParallel,
+		LatestResponse:         *latestResponse,
+		PreserveIDs:            *preserveIDs,
+		ValidateRaw:            *validateRaw,
+		MethodPassthrough:      *methodPassthrough,
+		StrictMethod:           *strictMethod,
+		TrustStatus:            *trustStatus,
+		CheckLengths:           *checkLengths,
+		StrictAlteration:       *strictAlteration,
+		RemapParents:           *remapParents,
+		DeferParents:           *deferParentsFlag,
+		Tag:                    *tag,
+		TraceSource:            *traceSource,
+		NormalizeHost:          *normalizeHostFlag,
+		NormalizeQuery:         *normalizeQuery,
+		TrimCR:                 *trimCRFlag,
+		NoRaw:                  *noRaw,
+		Session:                *session,
+	}
+	opts.Key = mustReadKey(*keySpec)
+	opts.RawDatabases = rawDBs
+	for _, bound := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"since", *since, &opts.Since},
+		{"until", *until, &opts.Until},
+		{"min-time", *minTime, &opts.MinTime},
+		{"max-time", *maxTime, &opts.MaxTime},
+	} {
+		if bound.value == "" || bound.value == timeRangeNone {
+			continue
+		}
+		t, err := parseTimeFlag(bound.value)
+		if err != nil {
+			log.Fatalf("Invalid -%s %q: %v", bound.name, bound.value, err)
+		}
+		*bound.dst = t
+	}
+	if *maxTime == "" {
+		opts.MaxTime = time.Now().Add(maxTimeAhead)
+	}
+	if !opts.MinTime.IsZero() && !opts.MaxTime.IsZero() && !opts.MinTime.Before(opts.MaxTime) {
+		log.Fatalf("Invalid -min-time %q: must be before -max-time.", *minTime)
+	}
+	if *editedDefault != "" {
+		value, err := strconv.ParseBool(*editedDefault)
+		if err != nil {
+			log.Fatalf("Invalid -edited-default %q: must be true or false.", *editedDefault)
+		}
+		opts.EditedDefault = sql.NullBool{Bool: value, Valid: true}
+	}
+	rawEncodings, err := parseRawEncodings(*rawEncoding)
+	if err != nil {
+		log.Fatalf("Invalid -raw-encoding %q: %v", *rawEncoding, err)
+	}
+	rawEncodings.Gunzip = *rawPrecompressed != ""
+	opts.RawEncodings = rawEncodings
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+		if _, err := explicitLayout(opts.Columns); err != nil {
+			log.Fatalf("Invalid -columns %q: %v", *columns, err)
+		}
+	}
+	if *statePath != "" && *tablePrefix != "" {
+		log.Fatal("-state cannot be used with -table-prefix or -promote, as staged rows do not keep their external ids.")
+	}
+	if *traceSource && *tablePrefix != "" {
+		log.Fatal("-trace-source cannot be used with -table-prefix or -promote, as staged rows do not keep their input lines.")
+	}
+	if *tablePrefix != "" {
+		if !tablePrefixPattern.MatchString(*tablePrefix) {
+			log.Fatalf("Invalid -table-prefix %q: must be letters, digits and underscores, not starting with a digit", *tablePrefix)
+		}
+		if !*promote {
+			// These act on live rows, so they are given with -promote.
+			flag.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "tag", "session", "store-extensions", "dedup", "remap-parents", "defer-parents", "preserve-ids", "update-scope", "replace", "manifest", "selftest":
+					log.Fatalf("-%s cannot be used when staging rows with -table-prefix; give it with -promote instead", f.Name)
+				}
+			})
+			opts.TablePrefix = *tablePrefix
+		}
+	}
+	var replaceHosts []string
+	if *replace != "" {
+		for _, host := range strings.Split(*replace, ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				log.Fatalf("Invalid -replace %q: empty host", *replace)
+			}
+			replaceHosts = append(replaceHosts, host)
+		}
+		if !*force {
+			log.Fatalf("-replace deletes the existing requests to %s; add -force to confirm", strings.Join(replaceHosts, ", "))
+		}
+		if !*atomic {
+			log.Fatal("-replace needs -atomic, so that the deleted requests are restored if the import fails.")
+		}
+	}
+	if *canonicalHost != "" {
+		aliases, err := parseHostAliases(*canonicalHost)
+		if err != nil {
+			log.Fatalf("Invalid -canonical-host %q: %v", *canonicalHost, err)
+		}
+		opts.HostAliases = aliases
+	}
+	if *emitSQL != "" {
+		if *format == "ws-csv" {
+			log.Fatal("-emit-sql does not support -format ws-csv.")
+		}
+		// These change the project outside the inserts of each row, or
+		// would need it to.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "route", "table-prefix", "promote", "remap-parents", "defer-parents", "update-scope", "replace", "fix-sequences", "manifest", "atomic", "fast-unsafe", "init", "reopen", "commit-every", "selftest", "diff", "validate", "state", "dedup":
+				log.Fatalf("-%s cannot be used with -emit-sql", f.Name)
+			}
+		})
+	}
+	if *routeParallel && *routePath == "" {
+		log.Fatal("-route-parallel needs -route.")
+	}
+	var routes map[string]string
+	if *routePath != "" {
+		// These act on the -p project only, or need every row in one.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "remap-parents", "defer-parents", "preserve-ids", "update-scope", "replace", "manifest", "atomic", "fast-unsafe", "fix-sequences", "table-prefix", "promote", "selftest", "diff", "dedup":
+				log.Fatalf("-%s cannot be used with -route", f.Name)
+			}
+		})
+		var err error
+		if routes, err = readRoutes(*routePath); err != nil {
+			log.Fatalf("Failed to read -route: %v", err)
+		}
+	}
+	if *redact != "" {
+		headers, err := parseRedactHeaders(*redact)
+		if err != nil {
+			log.Fatalf("Invalid -redact %q: %v", *redact, err)
+		}
+		opts.Redact = headers
+	}
+	if *specPath != "" {
+		spec, err := readSpec(*specPath)
+		if err != nil {
+			log.Fatalf("Failed to read -spec: %v", err)
+		}
+		opts.Spec = spec
+	}
+	if *mapSource != "" {
+		mapping, err := readMapping(*mapSource)
+		if err != nil {
+			log.Fatalf("Failed to read -map-source: %v", err)
+		}
+		opts.SourceMap = mapping
+	}
+	if *mapAlteration != "" {
+		mapping, err := readMapping(*mapAlteration)
+		if err != nil {
+			log.Fatalf("Failed to read -map-alteration: %v", err)
+		}
+		opts.AlterationMap = mapping
+	}
+
+	if *errorsPath != "" {
+		report, err := createErrorReport(*errorsPath)
+		if err != nil {
+			log.Fatalf("Failed to create -errors file: %v", err)
+		}
+		defer report.Close()
+		opts.ErrorReport = report
+	}
+	if *resume {
+		if *commitEvery <= 0 {
+			log.Fatal("-resume needs -commit-every, as progress is recorded with each committed batch.")
+		}
+		if *retryPath != "" || (*format != "csv" && *format != "jsonl") || strings.EqualFold(filepath.Ext(*csvPath), ".zip") {
+			log.Fatal("-resume only supports CSV and JSON Lines files, whose rows are numbered by line.")
+		}
+		if isURL(*csvPath) {
+			log.Fatal("-resume cannot be used with a URL, which may serve different content on the next run; download it first.")
+		}
+		// These reorder the rows, commit them elsewhere, or import nothing.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "route", "sort-by", "latest-response", "preserve-ids", "atomic", "promote", "emit-sql", "selftest", "validate", "diff":
+				log.Fatalf("-%s cannot be used with -resume", f.Name)
+			}
+		})
+	}
+	if *dedup && (*selfTest || *validate || *diff) {
+		log.Fatal("-dedup cannot be used with -selftest, -validate or -diff, which import nothing.")
+	}
+	if *dedup && *noRaw {
+		log.Fatal("-dedup cannot be used with -no-raw, as requests are told apart by their raw bytes.")
+	}
+	if *dedupExpected <= 0 {
+		log.Fatalf("Invalid -dedup-expected %d: must be positive", *dedupExpected)
+	}
+	if *dedupFPRate <= 0 || *dedupFPRate >= 1 {
+		log.Fatalf("Invalid -dedup-fp-rate %g: must be between 0 and 1", *dedupFPRate)
+	}
+	if *statePath != "" && (*selfTest || *validate || *diff) {
+		log.Fatal("-state cannot be used with -selftest, -validate or -diff, which import nothing.")
+	}
+	if *statePath != "" {
+		state, err := openImportState(*statePath)
+		if err != nil {
+			log.Fatalf("Failed to open -state: %v", err)
+		}
+		defer state.Close()
+		// With -atomic, rows are only imported once the staged project is
+		// swapped in.
+		state.deferred = *atomic
+		opts.State = state
+	}
+
+	if *selfTest {
+		runSelfTest(*csvPath, *format, opts)
+		return
+	}
+	if *validate {
+		runValidate(*csvPath, *format, opts, *failOnEmpty)
+		return
+	}
+
+	if *diff {
+		runDiff(*projectPath, *csvPath, *format, opts)
+		return
+	}
+	if *emitSQL != "" {
+		runEmitSQL(*projectPath, *csvPath, *format, *emitSQL, opts)
+		return
+	}
+
+	if *initProj {
+		if err := initProject(*projectPath, *force, opts.Key); err != nil {
+			log.Fatalf("Failed to initialize project: %v", err)
+		}
+	}
+
+	if *safe && !*force {
+		sidecars, err := openSidecars(*projectPath)
+		if err != nil {
+			log.Fatalf("Failed to check whether the project is open: %v", err)
+		}
+		if len(sidecars) > 0 {
+			log.Fatalf("Project appears to be open in Caido (found %s). Close the project in Caido first, or use -force to import anyway.", strings.Join(sidecars, ", "))
+		}
+	}
+
+	// With -atomic, the import writes to a staged copy of the project, which
+	// replaces the original only once everything has succeeded. fatalf
+	// discards the copy before exiting.
+	importPath := *projectPath
+	var stage *stagedProject
+	fatalf := func(format string, args ...interface{}) {
+		if stage != nil {
+			stage.Discard()
+		}
+		log.Fatalf(format, args...)
+	}
+	if *atomic {
+		for _, d := range rawDBs {
+			if filepath.Base(d.path) != d.path || filepath.Ext(d.path) != ".caido" {
+				log.Fatalf("-atomic only stages the *.caido files in the project directory, not -raw-db %s=%s", d.name, d.path)
+			}
+		}
+		var err error
+		stage, err = stageProject(*projectPath)
+		if err != nil {
+			log.Fatalf("Failed to stage project: %v", err)
+		}
+		importPath = stage.dir
+	}
+
+	converter, err := NewConverter(importPath, opts)
+	if err != nil {
+		fatalf("Failed to initialize converter: %v", err)
+	}
+	defer converter.Close()
+	if routes != nil {
+		if err := converter.OpenRoutes(routes); err != nil {
+			fatalf("Failed to open -route projects: %v", err)
+		}
+	}
+
+	if *readonlyCheck {
+		if err := converter.CheckWritable(); err != nil {
+			fatalf("Write access check failed: %v", err)
+		}
+		log.Println("[INFO] Verified write access to the project")
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fatalf("Failed to create CPU profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatalf("Failed to start CPU profile: %v", err)
+		}
+	}
+
+	// -replace requires -atomic, so the deletion is discarded along with the
+	// staged copy if the import fails.
+	if len(replaceHosts) > 0 {
+		if _, err := converter.DeleteHosts(ctx, replaceHosts); err != nil {
+			fatalf("Failed to delete requests for -replace: %v", err)
+		}
+	}
+
+	restoreDurability := func() error { return nil }
+	if *fastUnsafe {
+		restoreDurability, err = converter.EnableFastUnsafe(ctx)
+		if err != nil {
+			fatalf("Failed to enable -fast-unsafe: %v", err)
+		}
+	}
+
+	// inputPath is the file recorded in csv_import_log and the manifest,
+	// which a promotion does not have.
+	inputPath, source := *csvPath, *csvPath
+	if *promote {
+		inputPath, source = "", fmt.Sprintf("the %s staging tables", *tablePrefix)
+	}
+	if *resume {
+		if err := converter.LoadProgress(ctx, *csvPath); err != nil {
+			fatalf("Failed to read the progress for -resume: %v", err)
+		}
+	}
+	log.Printf("[INFO] Starting import from %s", source)
 	startTime := time.Now()
 
-	if err := converter.ImportFromCSV(*csvPath); err != nil {
-		log.Fatalf("Failed to import data: %v", err)
+	var stats Stats
+	var importErr error
+	if *promote {
+		stats, importErr = converter.Promote(ctx, *tablePrefix)
+	} else {
+		stats, importErr = converter.Import(ctx, *csvPath, *format)
+	}
+	if err := restoreDurability(); err != nil {
+		fatalf("Failed to restore safe database settings: %v", err)
+	}
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if *memProfile != "" {
+		if err := writeHeapProfile(*memProfile); err != nil {
+			log.Printf("[WARN] Failed to write memory profile: %v", err)
+		}
+	}
+	if importErr != nil {
+		fatalf("Failed to import data: %v", importErr)
+	}
+	if err := converter.FinishProgress(context.WithoutCancel(ctx)); err != nil {
+		log.Printf("[WARN] %v; the next -resume will skip the rows imported", err)
+	}
+	if !*promote {
+		checkEmpty(stats, source, *failOnEmpty, fatalf)
+	}
+
+	log.Printf("[INFO] Import completed successfully in %v: %d rows read, %d inserted, %d skipped, %d failed.",
+		stats.Duration, stats.RowsRead, stats.RowsInserted, stats.RowsSkipped, stats.RowsFailed)
+	if routes != nil {
+		converter.logRoutes()
+	}
+	if opts.ErrorReport != nil && opts.ErrorReport.written > 0 {
+		log.Printf("[INFO] Wrote %d failed rows to %s", opts.ErrorReport.written, *errorsPath)
+	}
+	logReasons(stats)
+	converter.logDedup()
+	converter.logRedacted()
+	converter.logTimeRange()
+	if *timings {
+		logTimings(stats)
+	}
+	if err := converter.VerifyCount(context.WithoutCancel(ctx)); err != nil {
+		if *failOnMismatch {
+			fatalf("Import verification failed: %v", err)
+		}
+		log.Printf("[WARN] Import verification failed: %v", err)
+	}
+	if opts.TablePrefix != "" {
+		log.Printf("[INFO] Rows were staged in the %s tables; run again with -promote -table-prefix %s to move them into the project.", opts.TablePrefix, opts.TablePrefix)
+	}
+
+	if err := converter.RemapParents(ctx); err != nil {
+		fatalf("Failed to link parent ids: %v", err)
+	}
+
+	if *fixSequences {
+		if err := converter.ReconcileSequences(ctx); err != nil {
+			fatalf("Failed to reconcile id sequences: %v", err)
+		}
+	}
+
+	if *updateScope {
+		if err := converter.UpdateScope(ctx); err != nil {
+			log.Printf("[WARN] Failed to update scope: %v", err)
+		}
+	}
+
+	if err := converter.LogImport(context.WithoutCancel(ctx), inputPath, startTime); err != nil {
+		log.Printf("[WARN] Failed to record the import in csv_import_log: %v", err)
+	}
+
+	if stage != nil {
+		if err := converter.Close(); err != nil {
+			fatalf("Failed to close staged project: %v", err)
+		}
+		backupDir, err := stage.Commit()
+		if err != nil {
+			fatalf("Failed to swap in the imported project: %v", err)
+		}
+		log.Printf("[INFO] Replaced project databases; originals backed up to %s", backupDir)
+	}
+	if opts.State != nil {
+		if err := opts.State.flush(); err != nil {
+			log.Fatalf("Failed to write -state: %v", err)
+		}
+		log.Printf("[INFO] Recorded %d imported ids in %s", opts.State.recorded, *statePath)
+	}
+
+	if *manifestPath != "" {
+		manifest, err := converter.Manifest(*projectPath, inputPath, startTime, time.Now())
+		if err != nil {
+			log.Fatalf("Failed to build manifest: %v", err)
+		}
+		if err := manifest.Write(*manifestPath); err != nil {
+			log.Fatalf("Failed to write manifest: %v", err)
+		}
+		log.Printf("[INFO] Wrote manifest to %s", *manifestPath)
+	}
+}
+
+// parseTimeFlag parses an RFC 3339 time or a unix timestamp. Timestamps of
+// more than 11 digits are taken to be in milliseconds, like the created_at
+// column, and shorter ones in seconds.
+func parseTimeFlag(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if len(strings.TrimPrefix(value, "-")) > 11 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be an RFC 3339 time or a unix timestamp")
+	}
+	return t, nil
+}
+
+// Environment variables read in place of -p and -f when they are not given.
+const (
+	projectEnv = "CAIDO_PROJECT"
+	csvEnv     = "CAIDO_CSV"
+)
+
+// flagOrEnv returns value, or the environment variable name if value is
+// empty, so that flags given on the command line take precedence.
+func flagOrEnv(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// mustReadKey resolves the -key flag, returning "" when it is unset.
+func mustReadKey(spec string) string {
+	if spec == "" {
+		return ""
+	}
+	key, err := readKey(spec)
+	if err != nil {
+		log.Fatalf("Failed to read -key: %v", err)
+	}
+	return key
+}
+
+// writeHeapProfile writes a heap profile reflecting the memory still in use.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
+
+// runValidate parses and normalizes the input without touching a project,
+// then reports whether every row was valid. It exits non-zero on failure.
+func runValidate(path, format string, opts Options, failOnEmpty bool) {
+	validator := NewValidator(opts)
+	log.Printf("[INFO] Validating %s", path)
+	stats, err := validator.Import(context.Background(), path, format)
+	if err != nil {
+		log.Fatalf("Validation failed: %v", err)
 	}
+	checkEmpty(stats, path, failOnEmpty, log.Fatalf)
+	if stats.RowsFailed > 0 {
+		logReasons(stats)
+		log.Fatalf("Validation FAILED: %d of %d rows invalid (%d valid, %d skipped).", stats.RowsFailed, stats.RowsRead, stats.RowsValid, stats.RowsSkipped)
+	}
+	logReasons(stats)
+	log.Printf("[INFO] Validation passed: %d of %d rows valid (%d skipped).", stats.RowsValid, stats.RowsRead, stats.RowsSkipped)
+}
+
+// checkEmpty warns when the input had no data rows, such as an empty or
+// header-only file from a broken export, which would otherwise pass as a
+// successful import of nothing. With fail, it exits through fatalf instead.
+func checkEmpty(stats Stats, source string, fail bool, fatalf func(string, ...interface{})) {
+	if stats.RowsRead > 0 {
+		return
+	}
+	if fail {
+		fatalf("%s has no data rows (-fail-on-empty).", source)
+	}
+	log.Printf("[WARN] %s has no data rows; check that it was exported correctly", source)
+}
+
+// runUndo reverts the import described by the manifest at manifestPath. The
+// project path defaults to the one recorded in the manifest.
+func runUndo(projectPath, manifestPath, key string, rawDBs rawDatabaseList) {
+	manifest, err := ReadManifest(manifestPath)
+	if err != nil {
+		log.Fatalf("Failed to read manifest: %v", err)
+	}
+	if projectPath == "" {
+		projectPath = manifest.ProjectPath
+	} else if abs, err := filepath.Abs(projectPath); err == nil && abs != manifest.ProjectPath {
+		log.Printf("[WARN] Manifest was written for project %s, undoing in %s", manifest.ProjectPath, abs)
+	}
+
+	converter, err := NewConverter(projectPath, Options{Key: key, RawDatabases: rawDBs})
+	if err != nil {
+		log.Fatalf("Failed to initialize converter: %v", err)
+	}
+	defer converter.Close()
 
-	duration := time.Since(startTime)
-	log.Printf("[INFO] Import completed successfully in %v.", duration)
+	log.Printf("[INFO] Undoing import of %s from %s", manifest.InputPath, manifest.StartedAt.Format(time.RFC3339))
+	if err := converter.Undo(manifest); err != nil {
+		log.Fatalf("Failed to undo import: %v", err)
+	}
+	log.Println("[INFO] Undo completed successfully.")
 }
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestProject creates a project with the -init schema in a temporary
+// directory and returns its path.
+func newTestProject(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "project")
+	if err := initProject(dir, false, ""); err != nil {
+		t.Fatalf("initProject: %v", err)
+	}
+	return dir
+}
+
+// writeTestFile writes content to name in a temporary directory and returns
+// its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// importTestCSV imports the CSV at path into the project with opts and
+// returns the stats, failing the test if the import fails.
+func importTestCSV(t *testing.T, project, path string, opts Options) Stats {
+	t.Helper()
+	c, err := NewConverter(project, opts)
+	if err != nil {
+		t.Fatalf("NewConverter: %v", err)
+	}
+	defer c.Close()
+	stats, err := c.Import(context.Background(), path, "csv")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	return stats
+}
+
+// openTestDB opens one of the project's databases for checking what an
+// import stored.
+func openTestDB(t *testing.T, project, name string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(sqliteDriver, filepath.Join(project, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// rawBlobs returns the data column of a raw table in id order.
+func rawBlobs(t *testing.T, db *sql.DB, table string) [][]byte {
+	t.Helper()
+	rows, err := db.Query("SELECT data FROM " + table + " ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var blobs [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, data)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+// testRow is a row of a CSV built by testCSV, whose ids are left blank when
+// 0. parentID is used for both parent_id and response_parent_id.
+type testRow struct {
+	id, responseID, parentID int64
+}
+
+// testCSV returns a v2 CSV with a row for each of rows: a GET of /n from
+// example.com, where n is the row's id or else its position from 1, and a
+// 200 response whose body is n.
+func testCSV(rows ...testRow) string {
+	blank := func(id int64) string {
+		if id == 0 {
+			return ""
+		}
+		return fmt.Sprint(id)
+	}
+	var b strings.Builder
+	b.WriteString("#caido-csv v2\nid,host,method,path,port,raw,parent_id,response_id,response_status_code,response_raw,response_parent_id\n")
+	for i, row := range rows {
+		n := row.id
+		if n == 0 {
+			n = int64(i + 1)
+		}
+		body := fmt.Sprint(n)
+		request := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.com\r\n\r\n", n)))
+		response := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)))
+		fmt.Fprintf(&b, "%s,example.com,GET,/%d,443,%s,%s,%s,200,%s,%s\n", blank(row.id), n, request, blank(row.parentID), blank(row.responseID), response, blank(row.parentID))
+	}
+	return b.String()
+}
+
+// allBytes holds every byte value, so that NULs, CRs, LFs and bytes that are
+// not valid UTF-8 all appear in a message.
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestRawByteFidelity(t *testing.T) {
+	body := append([]byte("\x00\r\n\r\n\xff\xfe\x80\x00"), allBytes()...)
+	request := append([]byte(fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: example.com\r\nX-Bin: \x80\xff\r\nContent-Length: %d\r\n\r\n", len(body))), body...)
+	response := append([]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(body))), body...)
+
+	for _, encoding := range []string{RawEncodingBase64, RawEncodingHex} {
+		t.Run(encoding, func(t *testing.T) {
+			encode := base64.StdEncoding.EncodeToString
+			if encoding == RawEncodingHex {
+				encode = hex.EncodeToString
+			}
+			csv := "#caido-csv v2\nhost,method,path,port,raw,response_status_code,response_raw\n" +
+				fmt.Sprintf("example.com,POST,/upload,443,%s,200,%s\n", encode(request), encode(response))
+			project := newTestProject(t)
+			stats := importTestCSV(t, project, writeTestFile(t, "bytes.csv", csv), Options{
+				RawEncodings: rawEncodings{Request: encoding, Response: encoding},
+			})
+			if stats.RowsInserted != 1 {
+				t.Fatalf("inserted %d rows, want 1 (failed %d)", stats.RowsInserted, stats.RowsFailed)
+			}
+
+			raw := openTestDB(t, project, "database_raw.caido")
+			for _, c := range []struct {
+				table string
+				want  []byte
+			}{
+				{"requests_raw", request},
+				{"responses_raw", response},
+			} {
+				blobs := rawBlobs(t, raw, c.table)
+				if len(blobs) != 1 {
+					t.Fatalf("%s has %d rows, want 1", c.table, len(blobs))
+				}
+				if !bytes.Equal(blobs[0], c.want) {
+					t.Errorf("%s data differs from the input:\n got %q\nwant %q", c.table, blobs[0], c.want)
+				}
+			}
+
+			db := openTestDB(t, project, "database.caido")
+			var length int
+			if err := db.QueryRow("SELECT length FROM requests").Scan(&length); err != nil {
+				t.Fatal(err)
+			}
+			if length != len(request) {
+				t.Errorf("requests.length = %d, want %d", length, len(request))
+			}
+		})
+	}
+}
+
+// TestCRLFFixtures imports CSVs with Windows line endings. The CSV reader
+// drops the carriage return of each CRLF, including those inside quoted
+// multi-line fields; rows ending in "\r\r\n" keep one on their last field,
+// which numeric columns ignore and -trim-cr strips from text columns.
+func TestCRLFFixtures(t *testing.T) {
+	for _, c := range []struct {
+		file   string
+		trimCR bool
+	}{
+		{"crlf.csv", false},
+		{"crcrlf.csv", false},
+		{"crcrlf-text.csv", true},
+	} {
+		t.Run(c.file, func(t *testing.T) {
+			project := newTestProject(t)
+			stats := importTestCSV(t, project, filepath.Join("testdata", c.file), Options{
+				RawEncodings: rawEncodings{Request: RawEncodingText, Response: RawEncodingText},
+				TrimCR:       c.trimCR,
+			})
+			if stats.RowsInserted != 2 {
+				t.Fatalf("inserted %d rows, want 2 (failed %d)", stats.RowsInserted, stats.RowsFailed)
+			}
+
+			db := openTestDB(t, project, "database.caido")
+			rows, err := db.Query("SELECT alteration, created_at FROM responses ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var alteration string
+				var createdAt int64
+				if err := rows.Scan(&alteration, &createdAt); err != nil {
+					t.Fatal(err)
+				}
+				if alteration != "none" {
+					t.Errorf("response_alteration = %q, want %q", alteration, "none")
+				}
+				if c.file != "crlf.csv" && createdAt != 1700000000000 {
+					t.Errorf("response_created_at = %d, want 1700000000000", createdAt)
+				}
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			raw := openTestDB(t, project, "database_raw.caido")
+			for i, blob := range rawBlobs(t, raw, "requests_raw") {
+				want := fmt.Sprintf("GET /%c HTTP/1.1\nHost: example.com\n\n", 'a'+i)
+				if string(blob) != want {
+					t.Errorf("raw request %d = %q, want %q", i+1, blob, want)
+				}
+			}
+		})
+	}
+}
+
+// TestDuplicateResponseID imports rows sharing a response_id, which each
+// get a response of their own and are subject to -unique-id like repeated
+// ids.
+func TestDuplicateResponseID(t *testing.T) {
+	csv := testCSV(testRow{id: 1, responseID: 10}, testRow{id: 2, responseID: 10}, testRow{id: 3, responseID: 11})
+	for _, c := range []struct {
+		uniqueID string
+		paths    []string
+	}{
+		{"", []string{"/1", "/2", "/3"}},
+		{UniqueIDSkip, []string{"/1", "/3"}},
+	} {
+		t.Run("unique-id="+c.uniqueID, func(t *testing.T) {
+			project := newTestProject(t)
+			stats := importTestCSV(t, project, writeTestFile(t, "responses.csv", csv), Options{UniqueID: c.uniqueID})
+			if stats.RowsInserted != len(c.paths) {
+				t.Fatalf("inserted %d rows, want %d", stats.RowsInserted, len(c.paths))
+			}
+			if skipped := 3 - len(c.paths); stats.SkipReasons[reasonDuplicateID] != skipped {
+				t.Errorf("skipped %v, want %d %s", stats.SkipReasons, skipped, reasonDuplicateID)
+			}
+
+			// Every request links to the response of its own row.
+			db := openTestDB(t, project, "database.caido")
+			db.SetMaxOpenConns(1)
+			if _, err := db.Exec("ATTACH DATABASE ? AS raw", filepath.Join(project, "database_raw.caido")); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.Query(`
+				SELECT r.path, rr.data FROM requests r
+				JOIN responses s ON s.id = r.response_id
+				JOIN raw.responses_raw rr ON rr.id = s.raw_id
+				ORDER BY r.id`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var paths []string
+			for rows.Next() {
+				var path string
+				var data []byte
+				if err := rows.Scan(&path, &data); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.HasSuffix(data, []byte(path[1:])) {
+					t.Errorf("request %s links to response %q", path, data)
+				}
+				paths = append(paths, path)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(paths, " ") != strings.Join(c.paths, " ") {
+				t.Errorf("imported %v, want %v", paths, c.paths)
+			}
+		})
+	}
+
+	t.Run("unique-id=error", func(t *testing.T) {
+		project := newTestProject(t)
+		c, err := NewConverter(project, Options{UniqueID: UniqueIDError})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		_, err = c.Import(context.Background(), writeTestFile(t, "responses.csv", csv), "csv")
+		if err == nil || !strings.Contains(err.Error(), "duplicate response_id 10") {
+			t.Errorf("Import: got %v, want a duplicate response_id error", err)
+		}
+	})
+}
+
+// TestStrictColumns checks -strict-columns against a v2 header with a
+// misspelled column and a v1 file with Caido's header, whose columns are
+// positional and must be accepted.
+func TestStrictColumns(t *testing.T) {
+	v2 := strings.Replace(preservedCSV(1), ",host,", ",hsot,", 1)
+	for _, c := range []struct {
+		name, csv string
+		ok        bool
+	}{
+		{"v1", v1RetryCSV(v1RetryResponse), true},
+		{"v2", preservedCSV(1), true},
+		{"v2 misspelled", v2, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			conv, err := NewConverter(newTestProject(t), Options{StrictColumns: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conv.Close()
+			_, err = conv.Import(context.Background(), writeTestFile(t, "strict.csv", c.csv), "csv")
+			if c.ok && err != nil {
+				t.Errorf("Import: %v", err)
+			}
+			if !c.ok && (err == nil || !strings.Contains(err.Error(), "hsot")) {
+				t.Errorf("Import: got %v, want an error naming hsot", err)
+			}
+		})
+	}
+}
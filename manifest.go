@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest is a machine-readable record of a completed import. The ids it
+// holds identify exactly which rows the import added to each table.
+// SourceProjectID is the ProjectID of the project the input was exported
+// from, if it names one.
+type Manifest struct {
+	Version         string              `json:"version"`
+	ProjectPath     string              `json:"project_path"`
+	InputPath       string              `json:"input_path"`
+	InputSHA256     string              `json:"input_sha256"`
+	SourceProjectID string              `json:"source_project_id,omitempty"`
+	RowsRead        int                 `json:"rows_read"`
+	RowsInserted    int                 `json:"rows_inserted"`
+	RowsSkipped     int                 `json:"rows_skipped"`
+	RowsFailed      int                 `json:"rows_failed"`
+	IDs             map[string]*idRange `json:"ids"`
+	StartedAt       time.Time           `json:"started_at"`
+	FinishedAt      time.Time           `json:"finished_at"`
+}
+
+// Manifest describes the import performed by this converter.
+// inputPath is empty for imports not read from a file, such as -promote.
+func (c *Converter) Manifest(projectPath, inputPath string, startedAt, finishedAt time.Time) (*Manifest, error) {
+	absInput, sum, err := describeInput(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	absProject, err := filepath.Abs(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := c.Stats()
+	ids := c.stats.ids
+	if ids == nil {
+		ids = map[string]*idRange{}
+	}
+	return &Manifest{
+		Version:         version,
+		ProjectPath:     absProject,
+		InputPath:       absInput,
+		InputSHA256:     sum,
+		SourceProjectID: c.sourceProject,
+		RowsRead:        stats.RowsRead,
+		RowsInserted:    stats.RowsInserted,
+		RowsSkipped:     stats.RowsSkipped,
+		RowsFailed:      stats.RowsFailed,
+		IDs:             ids,
+		StartedAt:       startedAt.UTC(),
+		FinishedAt:      finishedAt.UTC(),
+	}, nil
+}
+
+// Write saves the manifest as indented JSON.
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadManifest loads a manifest previously written by Manifest.Write.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// undoOrder lists the tables an import writes to, ordered so that rows are
+// deleted before the rows they reference.
+var undoOrder = []string{
+	"intercept_entries",
+	wsMessagesTable,
+	wsStreamsTable,
+	"raw." + wsRawTable,
+	"csv_import_tags",
+	"csv_import_sources",
+	"requests",
+	"responses",
+	"raw.requests_raw",
+	"raw.responses_raw",
+	"requests_metadata",
+}
+
+// Undo deletes the rows whose ids the manifest records in a single
+// transaction. Rows inserted by others while the import was running, or
+// present before it with -preserve-ids, are left alone. Manifests of older
+// versions, which only record the range of ids, are refused.
+func (c *Converter) Undo(m *Manifest) error {
+	for table, r := range m.IDs {
+		if r.Runs == nil {
+			return fmt.Errorf("manifest records the range of ids inserted into %s but not the ids themselves; it was written by an older version and cannot be undone safely", table)
+		}
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range undoOrder {
+		r, ok := m.IDs[table]
+		if !ok {
+			continue
+		}
+		var deleted int64
+		for _, run := range r.Runs {
+			res, err := tx.Exec("DELETE FROM "+c.rawTable(table)+" WHERE id BETWEEN ? AND ?", run[0], run[1])
+			if err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			deleted += n
+		}
+		log.Printf("[INFO] Deleted %d rows from %s (ids %d-%d)", deleted, table, r.First, r.Last)
+	}
+	return tx.Commit()
+}
+
+// describeInput returns the absolute path and SHA-256 of an input file, or
+// empty strings if path is empty. URLs are returned without their password
+// or a hash, since hashing would download them again.
+func describeInput(path string) (abs, sum string, err error) {
+	if path == "" {
+		return "", "", nil
+	}
+	if isURL(path) {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Redacted()
+		}
+		return path, "", nil
+	}
+	if sum, err = hashFile(path); err != nil {
+		return "", "", fmt.Errorf("error hashing input file: %v", err)
+	}
+	abs, err = filepath.Abs(path)
+	return abs, sum, err
+}
+
+// hashFile returns the hex-encoded SHA-256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
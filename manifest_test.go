@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+// preservedCSV returns a v2 CSV with a row for each id, using it as both
+// the id and the response_id.
+func preservedCSV(ids ...int64) string {
+	rows := make([]testRow, len(ids))
+	for i, id := range ids {
+		rows[i] = testRow{id: id, responseID: id}
+	}
+	return testCSV(rows...)
+}
+
+// tableIDs returns the ids of a table in order.
+func tableIDs(t *testing.T, db *sql.DB, table string) []int64 {
+	t.Helper()
+	rows, err := db.Query("SELECT id FROM " + table + " ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// TestUndoKeepsInterleavedRows undoes an import whose ids surround a row it
+// did not insert, which must survive.
+func TestUndoKeepsInterleavedRows(t *testing.T) {
+	project := newTestProject(t)
+	opts := Options{PreserveIDs: true}
+	importTestCSV(t, project, writeTestFile(t, "other.csv", preservedCSV(11)), opts)
+
+	c, err := NewConverter(project, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := c.Import(context.Background(), writeTestFile(t, "undone.csv", preservedCSV(10, 12)), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowsInserted != 2 {
+		t.Fatalf("inserted %d rows, want 2", stats.RowsInserted)
+	}
+	m, err := c.Manifest(project, "", time.Now(), time.Now())
+	c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.IDs["requests"].Runs, []idRun{{10, 10}, {12, 12}}; !slices.Equal(got, want) {
+		t.Fatalf("manifest records requests %v, want %v", got, want)
+	}
+
+	u, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	if err := u.Undo(m); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	db := openTestDB(t, project, "database.caido")
+	for _, table := range []string{"requests", "responses"} {
+		if got := tableIDs(t, db, table); !slices.Equal(got, []int64{11}) {
+			t.Errorf("%s ids after undo are %v, want [11]", table, got)
+		}
+	}
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, table := range []string{"requests_raw", "responses_raw"} {
+		if got := tableIDs(t, raw, table); len(got) != 1 {
+			t.Errorf("%s has %d rows after undo, want 1", table, len(got))
+		}
+	}
+}
+
+// TestUndoRefusesRangeOnlyManifest refuses a manifest of an older version,
+// which records the bounds of the ids but not the ids.
+func TestUndoRefusesRangeOnlyManifest(t *testing.T) {
+	project := newTestProject(t)
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	m := &Manifest{IDs: map[string]*idRange{"requests": {First: 1, Last: 5}}}
+	if err := c.Undo(m); err == nil {
+		t.Fatal("Undo accepted a manifest without ids")
+	}
+}
+
+func TestIDRangeTruncate(t *testing.T) {
+	var r idRange
+	for _, id := range []int64{5, 6, 7, 9, 10, 3} {
+		r.add(id)
+	}
+	if want := []idRun{{5, 7}, {9, 10}, {3, 3}}; !slices.Equal(r.Runs, want) {
+		t.Fatalf("runs %v, want %v", r.Runs, want)
+	}
+	r.truncate(4)
+	if want := []idRun{{5, 7}, {9, 9}}; !slices.Equal(r.Runs, want) {
+		t.Fatalf("runs after truncate %v, want %v", r.Runs, want)
+	}
+	if r.First != 5 || r.Last != 9 {
+		t.Errorf("bounds after truncate %d-%d, want 5-9", r.First, r.Last)
+	}
+}
+
+// TestUndoWebSocketFrames undoes a ws-csv import, which must remove the
+// stream and frames it added and leave the request alone.
+func TestUndoWebSocketFrames(t *testing.T) {
+	project := newTestProject(t)
+	importTestCSV(t, project, writeTestFile(t, "request.csv", preservedCSV(1)), Options{})
+
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := "request_id,direction,opcode,payload\n1,client,text,aGVsbG8=\n1,server,text,d29ybGQ=\n"
+	if _, err := c.Import(context.Background(), writeTestFile(t, "frames.csv", frames), "ws-csv"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.Manifest(project, "", time.Now(), time.Now())
+	c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	if err := u.Undo(m); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	db := openTestDB(t, project, "database.caido")
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, c := range []struct {
+		db    *sql.DB
+		table string
+		want  int
+	}{
+		{db, "requests", 1},
+		{db, wsStreamsTable, 0},
+		{db, wsMessagesTable, 0},
+		{raw, wsRawTable, 0},
+	} {
+		if got := len(tableIDs(t, c.db, c.table)); got != c.want {
+			t.Errorf("%s has %d rows after undo, want %d", c.table, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readMapping loads a lookup table from a file of key=value lines. Blank
+// lines and lines starting with # are ignored, and whitespace around keys
+// and values is trimmed.
+func readMapping(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mapping := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key=value, got %q", path, lineNum, line)
+		}
+		mapping[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// mapValue translates value through mapping, passing unmapped values through.
+func mapValue(mapping map[string]string, value string) string {
+	if mapped, ok := mapping[value]; ok {
+		return mapped
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// requiredColumnsSQL lists the columns of a table that must be given a value
+// on insert: NOT NULL, without a default, and not the rowid primary key. The
+// arguments are the table and its schema.
+const requiredColumnsSQL = `
+	SELECT name, type FROM pragma_table_info(?, ?)
+	WHERE "notnull" AND dflt_value IS NULL AND NOT (pk AND upper(type) = 'INTEGER')`
+
+// prepareMetadata prepares the insert of each request's requests_metadata
+// row. Schemas differ between Caido versions, so columns that cannot be left
+// to their defaults are given empty values, and with Options.Tag the tag is
+// written to the label column when there is one. Without a requests_metadata
+// table, requests are inserted with no metadata, and stmts.metadata is nil.
+func (c *Converter) prepareMetadata(ctx context.Context, stmts *statements) error {
+	columns, err := tableColumns(ctx, c.db, "requests_metadata")
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		log.Println("[WARN] Project has no requests_metadata table; inserting requests without metadata")
+		return nil
+	}
+
+	rows, err := c.db.QueryContext(ctx, requiredColumnsSQL, "requests_metadata", "main")
+	if err != nil {
+		return fmt.Errorf("error reading columns of requests_metadata: %v", err)
+	}
+	var names, values []string
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, quoteIdentifier(name))
+		values = append(values, zeroValueFor(typ))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		log.Printf("[INFO] requests_metadata requires %s; inserting empty values", strings.Join(names, ", "))
+	}
+
+	if c.opts.Tag != "" && columns["label"] {
+		stmts.metadataTagged = true
+		for i, name := range names {
+			if name == quoteIdentifier("label") {
+				names, values = append(names[:i], names[i+1:]...), append(values[:i], values[i+1:]...)
+				break
+			}
+		}
+		names, values = append(names, "label"), append(values, "?")
+	}
+
+	query := "INSERT INTO requests_metadata DEFAULT VALUES RETURNING id"
+	if len(names) > 0 {
+		query = fmt.Sprintf("INSERT INTO requests_metadata (%s) VALUES (%s) RETURNING id", strings.Join(names, ", "), strings.Join(values, ", "))
+	}
+	if !c.schema.returning {
+		query = strings.TrimSuffix(query, " RETURNING id")
+	}
+	if stmts.metadata, err = stmts.prepare(ctx, c.db, query); err != nil {
+		return fmt.Errorf("failed to prepare statement %q: %w", query, err)
+	}
+	return nil
+}
+
+// zeroValueFor returns an SQL literal of the empty value for a column of
+// the declared type, following SQLite's type affinity rules.
+func zeroValueFor(typ string) string {
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.Contains(typ, "INT"), strings.Contains(typ, "REAL"), strings.Contains(typ, "FLOA"),
+		strings.Contains(typ, "DOUB"), strings.Contains(typ, "NUM"), strings.Contains(typ, "BOOL"):
+		return "0"
+	case strings.Contains(typ, "BLOB"):
+		return "X''"
+	default:
+		return "''"
+	}
+}
+
+// quoteIdentifier quotes name as an SQL identifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// insertMetadata inserts a request's requests_metadata row and returns its
+// id, or NULL if the project has no metadata table or rejects the insert.
+// Rejections are logged once rather than for every row.
+func (c *Converter) insertMetadata(ctx context.Context) (sql.NullInt64, error) {
+	if c.stmts.metadata == nil {
+		return sql.NullInt64{}, nil
+	}
+	var args []any
+	if c.stmts.metadataTagged {
+		args = append(args, c.opts.Tag)
+	}
+	id, err := c.stmts.insert(ctx, c.stmts.metadata, args...)
+	if err != nil {
+		if isConnectionError(err) {
+			return sql.NullInt64{}, fmt.Errorf("failed to insert into requests_metadata: %w", err)
+		}
+		if !c.metadataFailed {
+			c.metadataFailed = true
+			log.Printf("[WARN] Inserting requests without metadata, since requests_metadata rejected an insert: %v", err)
+		}
+		return sql.NullInt64{}, nil
+	}
+	c.track("requests_metadata", id)
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
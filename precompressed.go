@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Values of Options.RawPrecompressed, for exports holding gzip-compressed raw
+// messages or bodies.
+const (
+	// PrecompressedKeep stores gzip bodies as they are, declared with
+	// Content-Encoding: gzip.
+	PrecompressedKeep = "keep"
+	// PrecompressedDecompress stores gzip bodies decompressed.
+	PrecompressedDecompress = "decompress"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzip decompresses data, reading it to the end so that a truncated stream
+// or a bad checksum is reported rather than ignored.
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// gzipCoding reports whether a Content-Encoding value names gzip alone.
+func gzipCoding(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "gzip" || value == "x-gzip"
+}
+
+// gunzipRawColumns replaces raw columns that are a gzip stream as a whole
+// with the message they hold. Such a column is no HTTP message, so with
+// Options.RawPrecompressed it is decompressed whatever the mode, as soon as it
+// is decoded and before anything is derived from it.
+func gunzipRawColumns(record *CSVRecord) error {
+	for _, m := range []struct {
+		kind   string
+		raw    *[]byte
+		length *int64
+	}{
+		{"request", &record.Raw, &record.Length},
+		{"response", &record.ResponseRaw, &record.ResponseLength},
+	} {
+		if !bytes.HasPrefix(*m.raw, gzipMagic) {
+			continue
+		}
+		raw, err := gunzip(*m.raw)
+		if err != nil {
+			return fmt.Errorf("raw %s is corrupt gzip: %v", m.kind, err)
+		}
+		*m.length = adjustLength(*m.length, *m.raw, raw)
+		*m.raw = raw
+	}
+	return nil
+}
+
+// checkPrecompressed checks raw messages whose body is a gzip stream, when
+// Options.RawPrecompressed is set. The stream is read to the end, and a
+// corrupt one fails the row. PrecompressedKeep stores the body as it is,
+// adding Content-Encoding: gzip if the message does not declare it, and
+// PrecompressedDecompress stores it decompressed without the header.
+// Messages declaring another Content-Encoding, or a Transfer-Encoding, are
+// left alone.
+func (c *Converter) checkPrecompressed(record *CSVRecord) error {
+	if c.opts.RawPrecompressed == "" {
+		return nil
+	}
+	for _, m := range []struct {
+		kind   string
+		raw    *[]byte
+		length *int64
+	}{
+		{"request", &record.Raw, &record.Length},
+		{"response", &record.ResponseRaw, &record.ResponseLength},
+	} {
+		if len(*m.raw) == 0 {
+			continue
+		}
+		msg, err := parseHTTPMessage(*m.raw)
+		if err != nil || !bytes.HasPrefix(msg.Body, gzipMagic) {
+			continue
+		}
+		if _, ok := msg.Header("Transfer-Encoding"); ok {
+			continue
+		}
+		coding, declared := msg.Header("Content-Encoding")
+		if declared && !gzipCoding(coding) {
+			continue
+		}
+		body, err := gunzip(msg.Body)
+		if err != nil {
+			return fmt.Errorf("raw %s body for host %s is corrupt gzip: %v", m.kind, record.Host, err)
+		}
+
+		switch c.opts.RawPrecompressed {
+		case PrecompressedKeep:
+			if declared {
+				continue
+			}
+			msg.SetHeader("Content-Encoding", "gzip")
+		case PrecompressedDecompress:
+			msg.Body = body
+			msg.DelHeader("Content-Encoding")
+			if _, ok := msg.Header("Content-Length"); ok {
+				msg.SetHeader("Content-Length", strconv.Itoa(len(msg.Body)))
+			}
+		}
+		raw := msg.Bytes()
+		*m.length = adjustLength(*m.length, *m.raw, raw)
+		*m.raw = raw
+	}
+	return nil
+}
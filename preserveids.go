@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxIDProblems is how many problems checkPreservedIDs lists before
+// summarizing the rest.
+const maxIDProblems = 10
+
+// checkPreservedIDs verifies, before anything is inserted with
+// Options.PreserveIDs, that every record can keep its ID and ResponseID: each
+// must be given, appear once in the input and not be in use in the project.
+// It lists the problems found in a single error.
+func (c *Converter) checkPreservedIDs(ctx context.Context, pending []pendingRecord) error {
+	var problems []string
+	for _, kind := range []struct {
+		table, column string
+		id            func(CSVRecord) (int64, bool)
+	}{
+		{"requests", "id", func(r CSVRecord) (int64, bool) { return r.ID, r.ID != 0 }},
+		{"responses", "response_id", func(r CSVRecord) (int64, bool) { return r.ResponseID.Int64, r.ResponseID.Valid }},
+	} {
+		query := fmt.Sprintf("SELECT count(*) FROM %s WHERE id = ?", kind.table)
+		seen := make(map[int64]int, len(pending))
+		for _, p := range pending {
+			id, ok := kind.id(p.record)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("line %d has no %s", p.line, kind.column))
+				continue
+			}
+			if line, ok := seen[id]; ok {
+				problems = append(problems, fmt.Sprintf("%s %d on line %d is also on line %d", kind.column, id, p.line, line))
+				continue
+			}
+			seen[id] = p.line
+			var n int
+			if err := c.conn().QueryRowContext(ctx, query, id).Scan(&n); err != nil {
+				return fmt.Errorf("error checking %s ids: %v", kind.table, err)
+			}
+			if n > 0 {
+				problems = append(problems, fmt.Sprintf("%s %d on line %d is already in %s", kind.column, id, p.line, kind.table))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	more := ""
+	if len(problems) > maxIDProblems {
+		more = fmt.Sprintf("; and %d more", len(problems)-maxIDProblems)
+		problems = problems[:maxIDProblems]
+	}
+	return fmt.Errorf("cannot preserve ids, nothing was imported: %s%s", strings.Join(problems, "; "), more)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Schemas used by -init to create an empty project.
+var (
+	//go:embed schema/main.sql
+	mainSchema string
+	//go:embed schema/raw.sql
+	rawSchema string
+)
+
+// initProject creates the project directory and its databases with the
+// bundled schema, encrypted with key unless it is empty. It refuses to touch
+// a project that already has data unless force is set, in which case only
+// missing tables are created.
+func initProject(projectPath string, force bool, key string) error {
+	databases := []struct {
+		name   string
+		schema string
+	}{
+		{"database.caido", mainSchema},
+		{"database_raw.caido", rawSchema},
+	}
+
+	for _, d := range databases {
+		info, err := os.Stat(filepath.Join(projectPath, d.name))
+		if err == nil && info.Size() > 0 && !force {
+			return fmt.Errorf("%s already exists in %s; use -force to import into it", d.name, projectPath)
+		}
+	}
+
+	if err := os.MkdirAll(projectPath, 0o755); err != nil {
+		return fmt.Errorf("error creating project directory: %v", err)
+	}
+	for _, d := range databases {
+		if err := applySchema(filepath.Join(projectPath, d.name), d.schema, key); err != nil {
+			return fmt.Errorf("error initializing %s: %v", d.name, err)
+		}
+		log.Printf("[INFO] Initialized %s", d.name)
+	}
+	return nil
+}
+
+// tableColumns returns the set of column names of table, which may be
+// qualified with a schema name such as "raw.requests_raw".
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	schema, name := "main", table
+	if i := strings.IndexByte(table, '.'); i != -1 {
+		schema, name = table[:i], table[i+1:]
+	}
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?, ?)", name, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns[column] = true
+	}
+	return columns, rows.Err()
+}
+
+// tableInfo is a table the importer writes to whose columns differ between
+// projects, with the columns it has and those that must be given a value on
+// insert, mapped to an empty value of their type.
+type tableInfo struct {
+	name     string
+	columns  map[string]bool
+	required map[string]string
+}
+
+// readTableInfo reads the columns of table, which may be qualified with a
+// schema name. It returns nil if the table does not exist.
+func readTableInfo(ctx context.Context, db *sql.DB, table string) (*tableInfo, error) {
+	columns, err := tableColumns(ctx, db, table)
+	if err != nil || len(columns) == 0 {
+		return nil, err
+	}
+	schema, name := "main", table
+	if i := strings.IndexByte(table, '.'); i != -1 {
+		schema, name = table[:i], table[i+1:]
+	}
+	rows, err := db.QueryContext(ctx, requiredColumnsSQL, name, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+	t := &tableInfo{name: table, columns: columns, required: make(map[string]string)}
+	for rows.Next() {
+		var column, typ string
+		if err := rows.Scan(&column, &typ); err != nil {
+			return nil, err
+		}
+		t.required[column] = zeroValueFor(typ)
+	}
+	return t, rows.Err()
+}
+
+// columnNullable reports whether column of table accepts NULL. A missing
+// column is reported as not nullable.
+func columnNullable(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var notNull bool
+	err := db.QueryRowContext(ctx, `SELECT "notnull" FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&notNull)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+	return !notNull, nil
+}
+
+// applySchema creates the database at path if needed, encrypted with key
+// unless it is empty, and runs schema on it.
+func applySchema(path, schema, key string) error {
+	var db *sql.DB
+	var err error
+	if key != "" {
+		db, err = openKeyedDB(path, key)
+	} else {
+		db, err = sql.Open(sqliteDriver, path)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(schema)
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestInitProjectSchema checks that -init creates the tables of the
+// features beyond the HTTP history, and that WebSocket frames can be
+// imported into a new project.
+func TestInitProjectSchema(t *testing.T) {
+	project := newTestProject(t)
+	db := openTestDB(t, project, "database.caido")
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, c := range []struct {
+		db    *sql.DB
+		table string
+	}{
+		{db, "scopes"},
+		{db, "findings"},
+		{db, wsStreamsTable},
+		{db, wsMessagesTable},
+		{raw, wsRawTable},
+	} {
+		var n int
+		if err := c.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", c.table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("-init did not create %s", c.table)
+		}
+	}
+
+	importTestCSV(t, project, writeTestFile(t, "request.csv", preservedCSV(1)), Options{})
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	frames := "request_id,direction,opcode,payload\n1,client,text,aGVsbG8=\n1,server,text,d29ybGQ=\n"
+	stats, err := c.Import(context.Background(), writeTestFile(t, "frames.csv", frames), "ws-csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowsInserted != 2 {
+		t.Fatalf("inserted %d frames, want 2 (failed %d)", stats.RowsInserted, stats.RowsFailed)
+	}
+	var messages int
+	if err := db.QueryRow("SELECT count(*) FROM " + wsMessagesTable).Scan(&messages); err != nil {
+		t.Fatal(err)
+	}
+	if messages != 2 {
+		t.Errorf("%s has %d rows, want 2", wsMessagesTable, messages)
+	}
+}
+
+// TestInitProjectKey checks that -init -key never leaves an unencrypted
+// project behind: either the build supports SQLCipher and the databases
+// cannot be read without the key, or it refuses.
+func TestInitProjectKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "project")
+	err := initProject(dir, false, "secret")
+	if err != nil {
+		if !strings.Contains(err.Error(), "encrypted") {
+			t.Fatalf("initProject: %v", err)
+		}
+		t.Skipf("this build cannot create encrypted projects: %v", err)
+	}
+	for _, name := range []string{"database.caido", "database_raw.caido"} {
+		db := openTestDB(t, dir, name)
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err == nil {
+			t.Errorf("%s can be read without the key", name)
+		}
+	}
+}
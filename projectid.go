@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// createProjectIDSQL creates the table holding the identifier -export writes
+// into its output, so an export imported back into the project it came from
+// can be recognized.
+const createProjectIDSQL = `CREATE TABLE IF NOT EXISTS csv_project_id (id TEXT NOT NULL)`
+
+// sourceAttribute is the attribute of the format version line naming the
+// project a CSV was exported from, e.g. "#caido-csv v1 source=3f2a...".
+const sourceAttribute = "source"
+
+// ProjectID returns the identifier of the project, or "" if it has none. With
+// create, a project without one is given a new random identifier.
+func (c *Converter) ProjectID(ctx context.Context, create bool) (string, error) {
+	columns, err := tableColumns(ctx, c.db, "csv_project_id")
+	if err != nil {
+		return "", err
+	}
+	if len(columns) > 0 {
+		var id string
+		err := c.db.QueryRowContext(ctx, "SELECT id FROM csv_project_id LIMIT 1").Scan(&id)
+		if err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return id, err
+		}
+	}
+	if !create {
+		return "", nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	if _, err := c.db.ExecContext(ctx, createProjectIDSQL); err != nil {
+		return "", fmt.Errorf("failed to create csv_project_id: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "INSERT INTO csv_project_id (id) VALUES (?)", id); err != nil {
+		return "", fmt.Errorf("failed to record project id: %w", err)
+	}
+	return id, nil
+}
+
+// checkSource refuses input exported from the converter's own project, which
+// would duplicate every row, unless Options.AllowSelfImport is set. source is
+// the project identifier from the input's format version line.
+func (c *Converter) checkSource(ctx context.Context, source string) error {
+	if source == "" {
+		return nil
+	}
+	c.sourceProject = source
+	own, err := c.ProjectID(ctx, false)
+	if err != nil {
+		return err
+	}
+	if own != source {
+		return nil
+	}
+	if !c.opts.AllowSelfImport {
+		return fmt.Errorf("the input was exported from this project and importing it would duplicate its rows; use -force to import it anyway")
+	}
+	log.Printf("[WARN] The input was exported from this project; importing it again duplicates its rows")
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// projectSchema describes what an opened project's databases support. It is
+// detected once by openDB, and the SQL of an import is chosen from it rather
+// than from checks scattered over the code.
+type projectSchema struct {
+	// version is database.caido's PRAGMA user_version, the schema version
+	// Caido's migrations record. It is 0 when unset.
+	version int
+	// rawSchema is the schema holding requests_raw, and the other raw
+	// tables such as stream_ws_messages_raw: "raw" when attached from a
+	// separate file, a name given with -raw-db, or "main".
+	rawSchema string
+	// responseRawSchema is the schema holding responses_raw, which is
+	// rawSchema unless -raw-db attached them from different databases.
+	responseRawSchema string
+	// returning is whether SQLite supports INSERT ... RETURNING.
+	returning bool
+	// interceptPosition is whether intercept_entries has a position column
+	// ordering the intercept queue.
+	interceptPosition bool
+}
+
+// detectSchema reads the schema version of the project opened in db and the
+// features its version-dependent SQL relies on, and logs them.
+func detectSchema(db *sql.DB, rawSchema, responseRawSchema string) (projectSchema, error) {
+	s := projectSchema{rawSchema: rawSchema, responseRawSchema: responseRawSchema, returning: supportsReturning(db)}
+	if err := db.QueryRow("PRAGMA user_version").Scan(&s.version); err != nil {
+		return s, fmt.Errorf("error reading schema version: %v", err)
+	}
+	columns, err := tableColumns(context.Background(), db, "intercept_entries")
+	if err != nil {
+		return s, err
+	}
+	s.interceptPosition = columns["position"]
+
+	if s.version == 0 {
+		log.Println("[INFO] Project schema version is not recorded")
+	} else {
+		log.Printf("[INFO] Project schema version %d", s.version)
+	}
+	if !s.returning {
+		log.Println("[INFO] SQLite does not support RETURNING, falling back to last_insert_rowid")
+	}
+	if s.interceptPosition {
+		log.Println("[INFO] intercept_entries has a position column; queueing intercept entries in input order")
+	}
+	return s, nil
+}
+
+// schemas returns "main" and the attached schemas the raw tables are in, each
+// once.
+func (s projectSchema) schemas() []string {
+	schemas := []string{"main"}
+	for _, schema := range []string{s.rawSchema, s.responseRawSchema} {
+		if !slices.Contains(schemas, schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+// ProjectVersion returns the schema version of the project, as recorded in
+// database.caido's user_version, or 0 if it is not recorded.
+func (c *Converter) ProjectVersion() int {
+	return c.schema.version
+}
+
+// CheckSchema reports the problems that would stop an import into the
+// project: insert statements its tables do not accept, and databases that
+// cannot be written to. It returns nil for a compatible, writable project.
+func (c *Converter) CheckSchema(ctx context.Context) []error {
+	var problems []error
+	stmts, err := prepareStatements(ctx, c.db, c.schema, "", false)
+	if err != nil {
+		// The error without the statement, which names the table or column
+		// at fault.
+		if cause := errors.Unwrap(err); cause != nil {
+			err = cause
+		}
+		problems = append(problems, fmt.Errorf("schema is not compatible: %w", err))
+	} else {
+		stmts.Close()
+	}
+	if err := c.CheckWritable(); err != nil {
+		problems = append(problems, fmt.Errorf("write access check failed: %w", err))
+	}
+	return problems
+}
+
+// runSchemaCheck opens the project and checks that it can be imported into,
+// without reading any input, for -validate-schema-only. It exits with an
+// error listing the problems found, if any.
+func runSchemaCheck(projectPath, key string, rawDBs rawDatabaseList) {
+	converter, err := NewConverter(projectPath, Options{Key: key, RawDatabases: rawDBs})
+	if err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	defer converter.Close()
+
+	problems := converter.CheckSchema(context.Background())
+	for _, problem := range problems {
+		log.Printf("[WARN] %v", problem)
+	}
+	if len(problems) > 0 {
+		converter.Close()
+		log.Fatal("Schema check failed.")
+	}
+	log.Printf("[INFO] Schema check passed: the project is compatible and writable.")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultRawDatabase is the file holding raw messages in current Caido
+// projects. Other *.caido files in the project are tried after it.
+const defaultRawDatabase = "database_raw.caido"
+
+// rawDatabase is a database given with -raw-db, attached under name.
+type rawDatabase struct {
+	name, path string
+}
+
+// rawDatabaseList collects repeated -raw-db flags.
+type rawDatabaseList []rawDatabase
+
+func (l *rawDatabaseList) String() string {
+	if l == nil || len(*l) == 0 {
+		return ""
+	}
+	names := make([]string, len(*l))
+	for i, d := range *l {
+		names[i] = d.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (l *rawDatabaseList) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("must be name=path")
+	}
+	// The name is used unquoted in SQL, like -table-prefix.
+	if !tablePrefixPattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q: must be letters, digits and underscores, not starting with a digit", name)
+	}
+	if strings.EqualFold(name, "main") || strings.EqualFold(name, "temp") {
+		return fmt.Errorf("name %q is reserved by SQLite", name)
+	}
+	for _, d := range *l {
+		if strings.EqualFold(d.name, name) {
+			return fmt.Errorf("name %q is given twice", name)
+		}
+	}
+	*l = append(*l, rawDatabase{name: name, path: path})
+	return nil
+}
+
+// attachRawDatabase locates the requests_raw and responses_raw tables and
+// returns the schemas to insert raw requests and raw responses into.
+// Databases given in rawDBs are attached under their names and searched for
+// each table; see attachRawDatabases. Otherwise, projects that keep both
+// tables in database.caido use "main", and database_raw.caido, then every
+// other *.caido file in the project, is attached as "raw" until one holding
+// both tables is found.
+func attachRawDatabase(db *sql.DB, projectPath, key string, rawDBs rawDatabaseList) (requests, responses string, err error) {
+	if len(rawDBs) > 0 {
+		return attachRawDatabases(db, projectPath, key, rawDBs)
+	}
+	if hasRawTables(db, "main") {
+		log.Println("[INFO] Raw tables found in database.caido")
+		return "main", "main", nil
+	}
+
+	candidates := []string{defaultRawDatabase}
+	matches, err := filepath.Glob(filepath.Join(projectPath, "*.caido"))
+	if err != nil {
+		return "", "", err
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		name := filepath.Base(m)
+		if name != "database.caido" && name != defaultRawDatabase {
+			candidates = append(candidates, name)
+		}
+	}
+
+	for _, name := range candidates {
+		path := filepath.Join(projectPath, name)
+		// ATTACH would create a missing file.
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		// The path is bound rather than spliced into the SQL, so quotes and
+		// other characters in project directories need no escaping.
+		attach, args := "ATTACH DATABASE ? AS raw", []any{path}
+		if key != "" {
+			attach, args = attach+" KEY ?", append(args, key)
+		}
+		if _, err := db.Exec(attach, args...); err != nil {
+			log.Printf("[WARN] Failed to attach %s: %v", name, err)
+			continue
+		}
+		if !hasRawTables(db, "raw") {
+			db.Exec("DETACH DATABASE raw")
+			continue
+		}
+		if _, err := db.Exec("PRAGMA raw.journal_mode=WAL"); err != nil {
+			return "", "", fmt.Errorf("error setting journal mode on %s: %v", name, err)
+		}
+		log.Printf("[INFO] Attached %s", name)
+		return "raw", "raw", nil
+	}
+	return "", "", fmt.Errorf("no database with requests_raw and responses_raw tables found in %s (tried database.caido, %s); use -raw-db to name the databases holding each", projectPath, strings.Join(candidates, ", "))
+}
+
+// attachRawDatabases attaches each of rawDBs under its name, with relative
+// paths taken from the project directory, and returns the schemas holding
+// requests_raw and responses_raw, which may differ. Each table is looked for
+// in the databases in the order given, then in database.caido.
+func attachRawDatabases(db *sql.DB, projectPath, key string, rawDBs rawDatabaseList) (requests, responses string, err error) {
+	var schemas []string
+	for _, d := range rawDBs {
+		path := d.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectPath, path)
+		}
+		// ATTACH would create a missing file.
+		if _, err := os.Stat(path); err != nil {
+			return "", "", fmt.Errorf("raw database %s: %v", d.name, err)
+		}
+		attach, args := "ATTACH DATABASE ? AS "+d.name, []any{path}
+		if key != "" {
+			attach, args = attach+" KEY ?", append(args, key)
+		}
+		if _, err := db.Exec(attach, args...); err != nil {
+			return "", "", fmt.Errorf("error attaching %s as %s: %v", path, d.name, err)
+		}
+		if _, err := db.Exec("PRAGMA " + d.name + ".journal_mode=WAL"); err != nil {
+			return "", "", fmt.Errorf("error setting journal mode on %s: %v", path, err)
+		}
+		log.Printf("[INFO] Attached %s as %s", path, d.name)
+		schemas = append(schemas, d.name)
+	}
+	schemas = append(schemas, "main")
+
+	find := func(table string) (string, error) {
+		for _, schema := range schemas {
+			if hasTable(db, schema, table) {
+				log.Printf("[INFO] %s found in %s", table, schema)
+				return schema, nil
+			}
+		}
+		return "", fmt.Errorf("no %s table found in %s", table, strings.Join(schemas, ", "))
+	}
+	if requests, err = find("requests_raw"); err != nil {
+		return "", "", err
+	}
+	if responses, err = find("responses_raw"); err != nil {
+		return "", "", err
+	}
+	return requests, responses, nil
+}
+
+// hasTable reports whether schema contains table.
+func hasTable(db *sql.DB, schema, table string) bool {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM "+schema+".sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return err == nil && n == 1
+}
+
+// hasRawTables reports whether schema contains both raw tables. Errors, such
+// as an attached file that is not a database, count as not found.
+func hasRawTables(db *sql.DB, schema string) bool {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM " + schema + ".sqlite_master WHERE type = 'table' AND name IN ('requests_raw', 'responses_raw')").Scan(&n)
+	return err == nil && n == 2
+}
+
+// rawTable maps a table name as recorded in manifests, such as
+// "raw.requests_raw", to the schema the table was found in.
+func (c *Converter) rawTable(table string) string {
+	if name, ok := strings.CutPrefix(table, "raw."); ok {
+		if name == "responses_raw" {
+			return c.schema.responseRawSchema + "." + name
+		}
+		return c.schema.rawSchema + "." + name
+	}
+	return table
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// rawDBTestDirs are project directory names that would break SQL if the
+// path were spliced into it rather than bound.
+var rawDBTestDirs = []string{
+	"it's a project",
+	`say "cheese"`,
+	"with  spaces ",
+	"projet ünïcode 项目 🙂",
+	`'; DROP TABLE requests; --`,
+}
+
+// rawDBTestKey is a key with quotes, which must be bound like the path.
+const rawDBTestKey = `k'e"y`
+
+// cipherSupported reports whether this build can open encrypted databases.
+func cipherSupported(t *testing.T) bool {
+	t.Helper()
+	db, err := openKeyedDB(filepath.Join(t.TempDir(), "probe.caido"), rawDBTestKey)
+	if err != nil {
+		return false
+	}
+	db.Close()
+	return true
+}
+
+// openRawDBTest creates a project in dir under a temporary directory and
+// opens its database.caido on a single connection, as openDB does, so that
+// attached databases stay attached. With key, the project is encrypted
+// when the build supports it, and otherwise the key is only passed to
+// ATTACH, which ignores it.
+func openRawDBTest(t *testing.T, dir, key string, encrypted bool) (*sql.DB, string) {
+	t.Helper()
+	project := filepath.Join(t.TempDir(), dir)
+	initKey := ""
+	if encrypted {
+		initKey = key
+	}
+	if err := initProject(project, false, initKey); err != nil {
+		t.Fatalf("initProject: %v", err)
+	}
+	var db *sql.DB
+	var err error
+	if encrypted {
+		db, err = openKeyedDB(filepath.Join(project, "database.caido"), key)
+	} else {
+		db, err = sql.Open(sqliteDriver, filepath.Join(project, "database.caido"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, project
+}
+
+func TestAttachRawDatabase(t *testing.T) {
+	encrypted := cipherSupported(t)
+	for _, key := range []string{"", rawDBTestKey} {
+		for _, dir := range rawDBTestDirs {
+			name := dir
+			if key != "" {
+				name += " with key"
+			}
+			t.Run(name, func(t *testing.T) {
+				db, project := openRawDBTest(t, dir, key, key != "" && encrypted)
+				requests, responses, err := attachRawDatabase(db, project, key, nil)
+				if err != nil {
+					t.Fatalf("attachRawDatabase: %v", err)
+				}
+				if requests != "raw" || responses != "raw" {
+					t.Fatalf("attached as %s and %s, want raw", requests, responses)
+				}
+				if _, err := db.Exec("INSERT INTO raw.requests_raw (data, source, alteration) VALUES (x'00ff', 'import', 'none')"); err != nil {
+					t.Fatalf("writing to the attached database: %v", err)
+				}
+				var file string
+				if err := db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'raw'").Scan(&file); err != nil {
+					t.Fatal(err)
+				}
+				if want := filepath.Join(project, defaultRawDatabase); file != want {
+					t.Errorf("attached %q, want %q", file, want)
+				}
+			})
+		}
+	}
+}
+
+func TestAttachRawDatabases(t *testing.T) {
+	encrypted := cipherSupported(t)
+	for _, key := range []string{"", rawDBTestKey} {
+		for _, dir := range rawDBTestDirs {
+			name := dir
+			if key != "" {
+				name += " with key"
+			}
+			t.Run(name, func(t *testing.T) {
+				db, project := openRawDBTest(t, dir, key, key != "" && encrypted)
+				rawDBs := rawDatabaseList{{name: "blobs", path: defaultRawDatabase}}
+				requests, responses, err := attachRawDatabase(db, project, key, rawDBs)
+				if err != nil {
+					t.Fatalf("attachRawDatabase: %v", err)
+				}
+				if requests != "blobs" || responses != "blobs" {
+					t.Fatalf("found the raw tables in %s and %s, want blobs", requests, responses)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Encodings of the raw and response_raw CSV columns.
+const (
+	RawEncodingBase64 = "base64"
+	RawEncodingHex    = "hex"
+	// RawEncodingText takes the field as-is. The CSV reader drops a carriage
+	// return before a line feed inside quoted fields, so CRLF line endings
+	// do not survive it.
+	RawEncodingText = "text"
+)
+
+// rawEncodings is the encoding of each raw column, set with -raw-encoding.
+// Blank means base64.
+type rawEncodings struct {
+	Request  string
+	Response string
+	// Gunzip decompresses raw columns that are a gzip stream once decoded;
+	// see gunzipRawColumns. It is set with -raw-precompressed.
+	Gunzip bool
+}
+
+// parseRawEncodings parses a -raw-encoding value: either one encoding for
+// both raw columns, or comma-separated column=encoding pairs such as
+// "raw=hex,response_raw=base64". Columns not named stay base64.
+func parseRawEncodings(s string) (rawEncodings, error) {
+	var enc rawEncodings
+	if s == "" {
+		return enc, nil
+	}
+	if !strings.Contains(s, "=") {
+		if err := checkRawEncoding(s); err != nil {
+			return enc, err
+		}
+		return rawEncodings{Request: s, Response: s}, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		column, encoding, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if err := checkRawEncoding(encoding); err != nil {
+			return enc, err
+		}
+		switch column {
+		case "raw":
+			enc.Request = encoding
+		case "response_raw":
+			enc.Response = encoding
+		default:
+			return enc, fmt.Errorf("unknown column %q: must be raw or response_raw", column)
+		}
+	}
+	return enc, nil
+}
+
+func checkRawEncoding(encoding string) error {
+	switch encoding {
+	case RawEncodingBase64, RawEncodingHex, RawEncodingText:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding %q: must be %s, %s or %s", encoding, RawEncodingBase64, RawEncodingHex, RawEncodingText)
+	}
+}
+
+// decodeRaw decodes a raw column in the given encoding.
+func decodeRaw(s, encoding string) ([]byte, error) {
+	switch encoding {
+	case RawEncodingHex:
+		return hex.DecodeString(s)
+	case RawEncodingText:
+		return []byte(s), nil
+	default:
+		return base64.StdEncoding.DecodeString(s)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Reasons rows are skipped, tallied in Stats.SkipReasons.
+const (
+	reasonOutsideWindow    = "outside -since/-until"
+	reasonDuplicateID      = "duplicate id"
+	reasonSuperseded       = "superseded by a later response"
+	reasonNoRow            = "not held by the error report"
+	reasonImportedBefore   = "imported in an earlier run"
+	reasonDuplicateRequest = "duplicate request"
+	reasonResumed          = "committed before -resume"
+)
+
+// Reasons rows fail, tallied in Stats.FailReasons.
+const (
+	reasonParse      = "parse error"
+	reasonSpec       = "-spec violation"
+	reasonInvalid    = "invalid data"
+	reasonOversize   = "oversize"
+	reasonRejected   = "rejected by -route"
+	reasonForeignKey = "foreign key"
+	reasonInsert     = "insert error"
+	reasonRolledBack = "rolled back"
+	reasonPanic      = "panic"
+	reasonOther      = "other"
+)
+
+// reasonError is a row error with the reason it is tallied under.
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string { return e.err.Error() }
+func (e *reasonError) Unwrap() error { return e.err }
+
+// withReason tallies err under reason, unless a more specific reason was
+// already given to it where it happened.
+func withReason(reason string, err error) error {
+	var re *reasonError
+	if errors.As(err, &re) {
+		return err
+	}
+	return &reasonError{reason: reason, err: err}
+}
+
+// failureReason returns the reason a row that failed with err is tallied
+// under.
+func failureReason(err error) string {
+	var re *reasonError
+	if errors.As(err, &re) {
+		return re.reason
+	}
+	return reasonOther
+}
+
+// insertReason returns the reason for a failed insert: foreign key violations
+// are told apart from other database errors.
+func insertReason(err error) string {
+	if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+		return reasonForeignKey
+	}
+	return reasonInsert
+}
+
+// skipRows counts n rows as skipped for reason.
+func (c *Converter) skipRows(reason string, n int) {
+	c.stats.rowsSkipped += n
+	tally(&c.stats.skipReasons, reason, n)
+}
+
+// tally adds n to the count of reason in *counts, creating the map if needed.
+func tally(counts *map[string]int, reason string, n int) {
+	if *counts == nil {
+		*counts = make(map[string]int)
+	}
+	(*counts)[reason] += n
+}
+
+// formatReasons lists counts by reason, largest first, e.g.
+// "3 parse error, 1 foreign key".
+func formatReasons(counts map[string]int) string {
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%d %s", counts[reason], reason)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// logReasons logs the breakdown of the skipped and failed rows by reason.
+func logReasons(stats Stats) {
+	if len(stats.SkipReasons) > 0 {
+		log.Printf("[INFO] Skipped rows: %s.", formatReasons(stats.SkipReasons))
+	}
+	if len(stats.FailReasons) > 0 {
+		log.Printf("[INFO] Failed rows: %s.", formatReasons(stats.FailReasons))
+	}
+}
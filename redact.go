@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// defaultRedactHeaders are the headers -redact default stands for: those
+// carrying credentials or session state.
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+	"X-Xsrf-Token",
+}
+
+// redactedValue replaces the value of every redacted header.
+const redactedValue = "REDACTED"
+
+// parseRedactHeaders reads the comma-separated header names of -redact, in
+// which "default" stands for defaultRedactHeaders. Names are returned in
+// lower case. The headers that frame the body cannot be redacted.
+func parseRedactHeaders(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			continue
+		case strings.EqualFold(name, "default"):
+			for _, d := range defaultRedactHeaders {
+				names = append(names, strings.ToLower(d))
+			}
+			continue
+		case strings.EqualFold(name, "Content-Length"), strings.EqualFold(name, "Transfer-Encoding"):
+			return nil, fmt.Errorf("%s frames the body and cannot be redacted", name)
+		case strings.ContainsAny(name, ": \t"):
+			return nil, fmt.Errorf("%q is not a header name", name)
+		}
+		names = append(names, strings.ToLower(name))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no headers given")
+	}
+	return names, nil
+}
+
+// redactHeaders replaces the values of the headers in Options.Redact with
+// redactedValue in the raw request and response, whatever their case and
+// including any folded continuation lines. Bodies are left alone, so only
+// the lengths of the messages change. A message that cannot be parsed fails
+// the row, rather than being stored with its headers unredacted.
+func (c *Converter) redactHeaders(record *CSVRecord) error {
+	if len(c.opts.Redact) == 0 {
+		return nil
+	}
+	for _, m := range []struct {
+		kind   string
+		raw    *[]byte
+		length *int64
+	}{
+		{"request", &record.Raw, &record.Length},
+		{"response", &record.ResponseRaw, &record.ResponseLength},
+	} {
+		if len(*m.raw) == 0 {
+			continue
+		}
+		msg, err := parseHTTPMessage(*m.raw)
+		if err != nil {
+			return fmt.Errorf("cannot redact raw %s for host %s: %v", m.kind, record.Host, err)
+		}
+		redacted := 0
+		for i, h := range msg.Headers {
+			if slices.Contains(c.opts.Redact, strings.ToLower(strings.TrimSpace(h.Name))) {
+				msg.Headers[i].Value = redactedValue
+				redacted++
+			}
+		}
+		if redacted == 0 {
+			continue
+		}
+		c.stats.headersRedacted += redacted
+		raw := msg.Bytes()
+		*m.length = adjustLength(*m.length, *m.raw, raw)
+		*m.raw = raw
+	}
+	return nil
+}
+
+// logRedacted reports how many header values Options.Redact replaced.
+func (c *Converter) logRedacted() {
+	if len(c.opts.Redact) > 0 {
+		log.Printf("[INFO] Redacted %d header values", c.stats.headersRedacted)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// createRemapTablesSQL creates the temporary tables that record parent ids
+// until the second pass: every parent id with -remap-parents and
+// -defer-parents, and otherwise those not in the project yet. They live in SQLite's temporary storage,
+// on disk by default, so their size does not depend on available memory.
+const createRemapTablesSQL = `
+	PRAGMA temp_store = FILE;
+	CREATE TEMP TABLE IF NOT EXISTS csv_import_ids (
+		kind TEXT NOT NULL,
+		external_id INTEGER NOT NULL,
+		new_id INTEGER NOT NULL,
+		PRIMARY KEY (kind, external_id)
+	) WITHOUT ROWID;
+	CREATE TEMP TABLE IF NOT EXISTS csv_import_parents (
+		kind TEXT NOT NULL,
+		new_id INTEGER NOT NULL,
+		parent_external_id INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS temp.csv_import_parents_idx ON csv_import_parents (kind, new_id);`
+
+// remapParentSQL points parent_id of each row of table recorded in
+// csv_import_parents at the row inserted for its parent's external id, or
+// NULL if the parent was not imported. %[1]s is the table name, which is
+// also the kind recorded for it.
+const remapParentSQL = `
+	UPDATE %[1]s SET parent_id = (
+		SELECT i.new_id FROM temp.csv_import_parents p
+		JOIN temp.csv_import_ids i ON i.kind = p.kind AND i.external_id = p.parent_external_id
+		WHERE p.kind = '%[1]s' AND p.new_id = %[1]s.id
+	)
+	WHERE id IN (SELECT new_id FROM temp.csv_import_parents WHERE kind = '%[1]s')`
+
+// linkParentSQL is remapParentSQL without RemapParents, where the recorded
+// parent ids are ids in the project: parent_id is set to the recorded id if
+// such a row exists by the end of the import, and NULL otherwise.
+const linkParentSQL = `
+	UPDATE %[1]s SET parent_id = (
+		SELECT parent.id FROM temp.csv_import_parents p
+		JOIN %[1]s parent ON parent.id = p.parent_external_id
+		WHERE p.kind = '%[1]s' AND p.new_id = %[1]s.id
+	)
+	WHERE id IN (SELECT new_id FROM temp.csv_import_parents WHERE kind = '%[1]s')`
+
+// unresolvedLinksSQL is unresolvedParentsSQL without RemapParents. %[1]s is
+// the table name.
+const unresolvedLinksSQL = `
+	SELECT count(*) FROM temp.csv_import_parents p
+	LEFT JOIN %[1]s parent ON parent.id = p.parent_external_id
+	WHERE p.kind = ? AND parent.id IS NULL`
+
+// unresolvedParentsSQL counts the recorded parents of a kind that were not
+// imported.
+const unresolvedParentsSQL = `
+	SELECT count(*) FROM temp.csv_import_parents p
+	LEFT JOIN temp.csv_import_ids i ON i.kind = p.kind AND i.external_id = p.parent_external_id
+	WHERE p.kind = ? AND i.new_id IS NULL`
+
+// prepareRemap creates the remapping tables and prepares the statements that
+// fill them. The id mappings are only needed by RemapParents.
+func (c *Converter) prepareRemap(ctx context.Context, stmts *statements) error {
+	if _, err := c.db.ExecContext(ctx, createRemapTablesSQL); err != nil {
+		return fmt.Errorf("failed to create parent id tables: %w", err)
+	}
+	var err error
+	if c.opts.RemapParents {
+		if stmts.mapID, err = c.db.PrepareContext(ctx, mapIDSQL); err != nil {
+			return err
+		}
+	}
+	stmts.mapParent, err = c.db.PrepareContext(ctx, mapParentSQL)
+	return err
+}
+
+// deferParents reports whether parent ids are inserted as NULL and set by
+// Converter.RemapParents after the import.
+func (c *Converter) deferParents() bool {
+	return c.opts.RemapParents || c.opts.DeferParents
+}
+
+// parentFor returns the parent id to insert a row of table with. Parents
+// deferred by deferParents, and by default those not in the project yet,
+// such as a parent further down the input, are inserted as NULL and linked
+// by RemapParents after the import, so that no insert fails its foreign key.
+// Staged rows and -emit-sql keep their parent ids as given.
+func (c *Converter) parentFor(ctx context.Context, table string, parentID sql.NullInt64) (sql.NullInt64, error) {
+	if !parentID.Valid || c.stmts.mapParent == nil || c.emit != nil {
+		return parentID, nil
+	}
+	if c.deferParents() {
+		return sql.NullInt64{}, nil
+	}
+	var present bool
+	if err := c.conn().QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = ?)", parentID.Int64).Scan(&present); err != nil {
+		return parentID, fmt.Errorf("failed to look up parent %d in %s: %w", parentID.Int64, table, err)
+	}
+	if present {
+		return parentID, nil
+	}
+	c.debugf("Parent %d is not in %s yet; linking it after the import", parentID.Int64, table)
+	c.stats.parentsDeferred++
+	return sql.NullInt64{}, nil
+}
+
+// recordIDs remembers the id inserted into table for a row's external id and
+// the external id of its parent, for RemapParents, or just the parent id
+// otherwise. Parents inserted as given, in inserted, need no second pass.
+func (c *Converter) recordIDs(ctx context.Context, table string, newID, externalID int64, parentID, inserted sql.NullInt64) error {
+	if c.stmts.mapParent == nil || c.emit != nil {
+		return nil
+	}
+	if c.stmts.mapID != nil && externalID != 0 {
+		if _, err := c.stmts.mapID.ExecContext(ctx, table, externalID, newID); err != nil {
+			return fmt.Errorf("failed to record id mapping: %w", err)
+		}
+	}
+	if parentID.Valid && !inserted.Valid {
+		if _, err := c.stmts.mapParent.ExecContext(ctx, table, newID, parentID.Int64); err != nil {
+			return fmt.Errorf("failed to record parent id: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemapParents is the second pass of every import: after every row has been
+// imported, it sets the parent ids of the inserted requests and responses
+// that were inserted without them, in one transaction, in the project and
+// those of Options.Routes. With RemapParents they are set to the ids their
+// parents were inserted with, and parents missing from the input are left
+// NULL; otherwise they are set as given, and parents missing from the
+// project are left NULL. Either way, missing parents are counted in a
+// warning.
+func (c *Converter) RemapParents(ctx context.Context) error {
+	for _, target := range append([]*Converter{c}, c.routes.targets(c)...) {
+		if err := target.remapParents(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Converter) remapParents(ctx context.Context) error {
+	if !c.deferParents() && c.stats.parentsDeferred == 0 {
+		return nil
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"requests", "responses"} {
+		update, unresolvedQuery := fmt.Sprintf(remapParentSQL, table), unresolvedParentsSQL
+		verb, missing := "Remapped", "was not imported"
+		if !c.opts.RemapParents {
+			update, unresolvedQuery = fmt.Sprintf(linkParentSQL, table), fmt.Sprintf(unresolvedLinksSQL, table)
+			verb, missing = "Linked", "is not in the project"
+		}
+		res, err := tx.ExecContext(ctx, update)
+		if err != nil {
+			return fmt.Errorf("failed to set parent ids of %s: %w", table, err)
+		}
+		n, _ := res.RowsAffected()
+
+		var unresolved int
+		if err := tx.QueryRowContext(ctx, unresolvedQuery, table).Scan(&unresolved); err != nil {
+			return err
+		}
+		log.Printf("[INFO] %s parent ids of %d %s", verb, n-int64(unresolved), table)
+		if unresolved > 0 {
+			log.Printf("[WARN] %d %s have a parent id that %s; their parent is left empty", unresolved, table, missing)
+		}
+	}
+
+	for _, table := range []string{"csv_import_ids", "csv_import_parents"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM temp."+table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
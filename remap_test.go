@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parentsCSV returns a v2 CSV whose rows have the given parent ids, used for
+// both parent_id and response_parent_id, with 0 for none.
+func parentsCSV(parents ...int64) string {
+	rows := make([]testRow, len(parents))
+	for i, parent := range parents {
+		rows[i] = testRow{parentID: parent}
+	}
+	return testCSV(rows...)
+}
+
+// foreignKeyCheck returns the violations PRAGMA foreign_key_check reports.
+func foreignKeyCheck(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var violations []string
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid sql.NullInt64
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			t.Fatal(err)
+		}
+		violations = append(violations, fmt.Sprintf("%s row %d references %s", table, rowid.Int64, parent))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return violations
+}
+
+// importLinked imports a CSV like main does, including the second pass that
+// links parents, and checks that foreign keys are enforced while it runs.
+func importLinked(t *testing.T, project, path string) Stats {
+	t.Helper()
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var enforced bool
+	if err := c.db.QueryRow("PRAGMA foreign_keys").Scan(&enforced); err != nil {
+		t.Fatal(err)
+	}
+	if !enforced {
+		t.Fatal("foreign keys are not enforced")
+	}
+	stats, err := c.Import(context.Background(), path, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemapParents(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+// TestParentsForeignKeys imports rows whose parents come later in the input
+// or are missing, which must neither fail a row nor leave a foreign key
+// violation behind.
+func TestParentsForeignKeys(t *testing.T) {
+	project := newTestProject(t)
+	// Row 1's parent is row 3, further down; row 2's parent is row 1; row
+	// 4's parent is not in the project at all.
+	stats := importLinked(t, project, writeTestFile(t, "parents.csv", parentsCSV(3, 1, 0, 99)))
+	if stats.RowsInserted != 4 {
+		t.Fatalf("inserted %d rows, want 4 (failed %d: %v)", stats.RowsInserted, stats.RowsFailed, stats.FailReasons)
+	}
+
+	db := openTestDB(t, project, "database.caido")
+	if violations := foreignKeyCheck(t, db); len(violations) > 0 {
+		t.Errorf("foreign key violations: %v", violations)
+	}
+	for _, table := range []string{"requests", "responses"} {
+		rows, err := db.Query("SELECT id, parent_id FROM " + table + " ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for rows.Next() {
+			var id int64
+			var parent sql.NullInt64
+			if err := rows.Scan(&id, &parent); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%d:%d", id, parent.Int64))
+		}
+		rows.Close()
+		if want := "1:3 2:1 3:0 4:0"; strings.Join(got, " ") != want {
+			t.Errorf("%s parents are %s, want %s", table, strings.Join(got, " "), want)
+		}
+	}
+}
+
+// TestGeneratedForeignKeys imports a generated CSV, whose rows point at
+// earlier ones, and checks the project for foreign key violations.
+func TestGeneratedForeignKeys(t *testing.T) {
+	const rows = 500
+	path := filepath.Join(t.TempDir(), "gen.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generateCSV(f, rows, 16); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	project := newTestProject(t)
+	if stats := importLinked(t, project, path); stats.RowsInserted != rows {
+		t.Fatalf("inserted %d rows, want %d (failed %d: %v)", stats.RowsInserted, rows, stats.RowsFailed, stats.FailReasons)
+	}
+	if violations := foreignKeyCheck(t, openTestDB(t, project, "database.caido")); len(violations) > 0 {
+		t.Errorf("foreign key violations: %v", violations)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Primary SQLite result codes that indicate a problem with the database file
+// or connection rather than with the row being inserted.
+const (
+	sqliteReadOnly = 8  // SQLITE_READONLY, e.g. the file was moved or deleted
+	sqliteIOErr    = 10 // SQLITE_IOERR
+	sqliteFull     = 13 // SQLITE_FULL
+	sqliteCantOpen = 14 // SQLITE_CANTOPEN
+	sqliteNotADB   = 26 // SQLITE_NOTADB
+)
+
+// isConnectionError reports whether err is a failure of the database
+// connection, which reopening the project may fix, as opposed to an error
+// caused by the row's data, such as a constraint violation.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, sql.ErrTxDone) {
+		return true
+	}
+	code, ok := sqliteErrorCode(err)
+	if !ok {
+		return false
+	}
+	switch code {
+	case sqliteReadOnly, sqliteIOErr, sqliteFull, sqliteCantOpen, sqliteNotADB:
+		return true
+	}
+	return false
+}
+
+// reopen closes the database after a connection error and opens it again
+// with openDB, re-preparing the statements. An open -commit-every batch is
+// rolled back, and its rows are counted as failed. The -remap-parents
+// mappings live in the connection's temporary storage, so imports using it
+// cannot be resumed; rows waiting for a parent further down the input lose
+// it with a warning.
+func (c *Converter) reopen(ctx context.Context) error {
+	if c.opts.RemapParents {
+		return fmt.Errorf("cannot reopen the project with -remap-parents, whose id mappings are lost with the connection")
+	}
+	if c.opts.DeferParents {
+		return fmt.Errorf("cannot reopen the project with -defer-parents, whose parent ids are lost with the connection")
+	}
+	if c.stats.parentsDeferred > 0 {
+		log.Printf("[WARN] Reopening the project loses the parent ids of up to %d rows whose parent was not in the project yet; they are left without a parent", c.stats.parentsDeferred)
+		c.stats.parentsDeferred = 0
+	}
+	c.rollbackBatch()
+	c.stmts.Close()
+	c.db.Close()
+
+	db, schema, err := openDB(c.projectPath, c.opts.Key, c.opts.RawDatabases, c.opts.TxMode)
+	if err != nil {
+		return err
+	}
+	c.db, c.schema = db, schema
+	stmts, err := c.prepareAll(ctx)
+	if err != nil {
+		return err
+	}
+	c.stmts = stmts
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DeleteHosts removes every request to one of hosts, compared
+// case-insensitively, along with its intercept entry, findings, WebSocket
+// streams and messages, tag, -trace-source line, response, raw messages and
+// metadata, in a single transaction. Responses and raw rows still referenced
+// by other requests are kept, and parent ids of other rows that point at
+// deleted ones are cleared. It returns the number of requests deleted.
+func (c *Converter) DeleteHosts(ctx context.Context, hosts []string) (int64, error) {
+	// Tables that not every project has are looked up before the
+	// transaction takes the only connection, and skipped where missing.
+	rawMessages := c.schema.rawSchema + "." + wsRawTable
+	present := make(map[string]bool)
+	for _, table := range []string{"csv_import_tags", "csv_import_sources", "findings", wsStreamsTable, wsMessagesTable, rawMessages} {
+		columns, err := tableColumns(ctx, c.db, table)
+		if err != nil {
+			return 0, err
+		}
+		present[table] = len(columns) > 0
+	}
+	// WebSocket messages are found through their streams, and their raw
+	// payloads through the messages.
+	present[wsMessagesTable] = present[wsMessagesTable] && present[wsStreamsTable]
+	present[rawMessages] = present[rawMessages] && present[wsMessagesTable]
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hosts)), ", ")
+	args := make([]any, len(hosts))
+	for i, host := range hosts {
+		args[i] = strings.ToLower(host)
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE csv_replace_requests AS
+		SELECT id, raw_id, response_id, metadata_id FROM requests WHERE lower(host) IN (`+placeholders+`)`, args...); err != nil {
+		return 0, fmt.Errorf("failed to select requests to replace: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE csv_replace_responses AS
+		SELECT id, raw_id FROM responses WHERE id IN (SELECT response_id FROM temp.csv_replace_requests)`); err != nil {
+		return 0, fmt.Errorf("failed to select responses to replace: %w", err)
+	}
+
+	for _, query := range []string{
+		"UPDATE requests SET parent_id = NULL WHERE parent_id IN (SELECT id FROM temp.csv_replace_requests) AND id NOT IN (SELECT id FROM temp.csv_replace_requests)",
+		"UPDATE responses SET parent_id = NULL WHERE parent_id IN (SELECT id FROM temp.csv_replace_responses) AND id NOT IN (SELECT id FROM temp.csv_replace_responses)",
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return 0, fmt.Errorf("failed to clear parent ids: %w", err)
+		}
+	}
+
+	// Children are deleted before the rows they reference, except that raw
+	// WebSocket payloads go before the messages they are found through.
+	var deleted int64
+	streams := "SELECT id FROM " + wsStreamsTable + " WHERE request_id IN (SELECT id FROM temp.csv_replace_requests)"
+	steps := []struct {
+		what  string
+		table string
+		query string
+	}{
+		{"findings", "findings", "DELETE FROM findings WHERE request_id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{wsRawTable, rawMessages, fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT raw_id FROM %s WHERE stream_id IN (%s))", rawMessages, wsMessagesTable, streams)},
+		{wsMessagesTable, wsMessagesTable, "DELETE FROM " + wsMessagesTable + " WHERE stream_id IN (" + streams + ")"},
+		{wsStreamsTable, wsStreamsTable, "DELETE FROM " + wsStreamsTable + " WHERE request_id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{"intercept_entries", "", "DELETE FROM intercept_entries WHERE request_id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{"csv_import_tags", "csv_import_tags", "DELETE FROM csv_import_tags WHERE id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{"csv_import_sources", "csv_import_sources", "DELETE FROM csv_import_sources WHERE id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{"requests", "", "DELETE FROM requests WHERE id IN (SELECT id FROM temp.csv_replace_requests)"},
+		{"responses", "", "DELETE FROM responses WHERE id IN (SELECT id FROM temp.csv_replace_responses) AND id NOT IN (SELECT response_id FROM requests WHERE response_id IS NOT NULL)"},
+		{"requests_raw", "", fmt.Sprintf("DELETE FROM %s.requests_raw WHERE id IN (SELECT raw_id FROM temp.csv_replace_requests) AND id NOT IN (SELECT raw_id FROM requests WHERE raw_id IS NOT NULL)", c.schema.rawSchema)},
+		{"responses_raw", "", fmt.Sprintf("DELETE FROM %s.responses_raw WHERE id IN (SELECT raw_id FROM temp.csv_replace_responses) AND id NOT IN (SELECT raw_id FROM responses WHERE raw_id IS NOT NULL)", c.schema.responseRawSchema)},
+		{"requests_metadata", "", "DELETE FROM requests_metadata WHERE id IN (SELECT metadata_id FROM temp.csv_replace_requests) AND id NOT IN (SELECT metadata_id FROM requests WHERE metadata_id IS NOT NULL)"},
+	}
+	for _, step := range steps {
+		if step.table != "" && !present[step.table] {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, step.query)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", step.what, err)
+		}
+		n, _ := res.RowsAffected()
+		c.debugf("Deleted %d rows from %s", n, step.what)
+		switch step.what {
+		case "requests":
+			deleted = n
+		case "findings":
+			if n > 0 {
+				log.Printf("[INFO] Deleted %d findings on the requests being replaced", n)
+			}
+		}
+	}
+	for _, table := range []string{"csv_replace_requests", "csv_replace_responses"} {
+		if _, err := tx.ExecContext(ctx, "DROP TABLE temp."+table); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	log.Printf("[INFO] Deleted %d existing requests to %s", deleted, strings.Join(hosts, ", "))
+	return deleted, nil
+}
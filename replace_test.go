@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// TestDeleteHostsWithFinding deletes a host whose request has a finding and
+// WebSocket frames, which reference it and must go first for the delete to
+// pass the foreign key checks.
+func TestDeleteHostsWithFinding(t *testing.T) {
+	project := newTestProject(t)
+	importTestCSV(t, project, writeTestFile(t, "requests.csv", preservedCSV(1, 2)), Options{})
+	frames := "request_id,direction,opcode,payload\n1,client,text,aGVsbG8=\n1,server,text,d29ybGQ=\n"
+	c, err := NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Import(context.Background(), writeTestFile(t, "frames.csv", frames), "ws-csv"); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	db := openTestDB(t, project, "database.caido")
+	if _, err := db.Exec("INSERT INTO findings (title, reporter, host, path, request_id, created_at) VALUES ('XSS', 'test', 'example.com', '/1', 1, 0)"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewConverter(project, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := c.DeleteHosts(context.Background(), []string{"EXAMPLE.com"})
+	c.Close()
+	if err != nil {
+		t.Fatalf("DeleteHosts: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d requests, want 2", deleted)
+	}
+
+	raw := openTestDB(t, project, "database_raw.caido")
+	for _, c := range []struct {
+		db    *sql.DB
+		table string
+	}{
+		{db, "requests"},
+		{db, "responses"},
+		{db, "findings"},
+		{db, wsStreamsTable},
+		{db, wsMessagesTable},
+		{raw, wsRawTable},
+		{raw, "requests_raw"},
+		{raw, "responses_raw"},
+	} {
+		if ids := tableIDs(t, c.db, c.table); len(ids) > 0 {
+			t.Errorf("%s still has rows %v", c.table, ids)
+		}
+	}
+	if violations := foreignKeyCheck(t, db); len(violations) > 0 {
+		t.Errorf("foreign key violations: %v", violations)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SQL for -resume. The last line of the input covered by a committed batch
+// is kept in csv_import_progress, written in the batch's own transaction so
+// that it can never disagree with the rows in the project.
+const (
+	createProgressSQL = `
+		CREATE TABLE IF NOT EXISTS csv_import_progress (
+			input TEXT PRIMARY KEY,
+			size INTEGER NOT NULL,
+			line INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		)`
+	selectProgressSQL = "SELECT size, line FROM csv_import_progress WHERE input = ?"
+	saveProgressSQL   = "INSERT OR REPLACE INTO csv_import_progress (input, size, line, updated_at) VALUES (?, ?, ?, ?)"
+	deleteProgressSQL = "DELETE FROM csv_import_progress WHERE input = ?"
+)
+
+// resumePoint is where an import with -resume picks up: the input as
+// recorded in csv_import_progress, its size, and the last line committed by
+// an earlier run.
+type resumePoint struct {
+	input string
+	size  int64
+	line  int
+}
+
+// LoadProgress reads where an earlier, interrupted import of path stopped,
+// for -resume. Rows up to that line are then skipped, and every
+// committed batch moves the point forward. A file whose size changed since
+// is refused, as its lines no longer match. URLs are refused too, as
+// nothing tells whether they still serve the same content.
+func (c *Converter) LoadProgress(ctx context.Context, path string) error {
+	if isURL(path) {
+		return fmt.Errorf("cannot resume the import of a URL; download it first")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	point := &resumePoint{size: info.Size()}
+	if point.input, err = filepath.Abs(path); err != nil {
+		return err
+	}
+
+	if _, err := c.db.ExecContext(ctx, createProgressSQL); err != nil {
+		return fmt.Errorf("failed to create csv_import_progress: %w", err)
+	}
+	var size int64
+	err = c.db.QueryRowContext(ctx, selectProgressSQL, point.input).Scan(&size, &point.line)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to read csv_import_progress: %w", err)
+	case size != point.size:
+		return fmt.Errorf("%s is %d bytes, but was %d bytes when the import stopped after line %d; run without -resume to import it from the start", point.input, point.size, size, point.line)
+	default:
+		log.Printf("[INFO] Resuming the import of %s after line %d", point.input, point.line)
+	}
+	c.resume = point
+	return nil
+}
+
+// resumed reports whether the row on line was committed by the run being
+// resumed, counting it as skipped if so.
+func (c *Converter) resumed(line int) bool {
+	if c.resume == nil || line <= 0 || line > c.resume.line {
+		return false
+	}
+	c.skipRows(reasonResumed, 1)
+	return true
+}
+
+// saveProgress records in tx that the rows up to line are done.
+func (c *Converter) saveProgress(ctx context.Context, tx queryer, line int) error {
+	if c.resume == nil || line <= c.resume.line {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, saveProgressSQL, c.resume.input, c.resume.size, line, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to record progress in csv_import_progress: %w", err)
+	}
+	c.resume.line = line
+	return nil
+}
+
+// FinishProgress forgets the progress of a completed import, so that the
+// next run with -resume starts from the beginning.
+func (c *Converter) FinishProgress(ctx context.Context) error {
+	if c.resume == nil {
+		return nil
+	}
+	if _, err := c.db.ExecContext(ctx, deleteProgressSQL, c.resume.input); err != nil {
+		return fmt.Errorf("failed to clear csv_import_progress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// importResumable imports path with -resume and -commit-every 2, leaving
+// the progress recorded as if the run had been interrupted after its last
+// batch.
+func importResumable(t *testing.T, project, path string) (Stats, error) {
+	t.Helper()
+	c, err := NewConverter(project, Options{CommitEvery: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.LoadProgress(context.Background(), path); err != nil {
+		return Stats{}, err
+	}
+	return c.Import(context.Background(), path, "csv")
+}
+
+func TestResumeSkipsCommittedRows(t *testing.T) {
+	project := newTestProject(t)
+	path := writeTestFile(t, "resume.csv", preservedCSV(1, 2, 3, 4))
+	stats, err := importResumable(t, project, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowsInserted != 4 {
+		t.Fatalf("first run inserted %d rows, want 4", stats.RowsInserted)
+	}
+	stats, err = importResumable(t, project, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowsInserted != 0 || stats.SkipReasons[reasonResumed] != 4 {
+		t.Errorf("resumed run inserted %d rows and skipped %v, want 0 and 4 %s", stats.RowsInserted, stats.SkipReasons, reasonResumed)
+	}
+
+	// A file that changed since is refused.
+	if err := os.WriteFile(path, []byte(preservedCSV(1, 2, 3, 4, 5)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importResumable(t, project, path); err == nil || !strings.Contains(err.Error(), "bytes") {
+		t.Errorf("resuming a changed file: got %v, want a size mismatch", err)
+	}
+}
+
+func TestResumeRefusesURL(t *testing.T) {
+	project := newTestProject(t)
+	if _, err := importResumable(t, project, "https://example.com/export.csv"); err == nil {
+		t.Error("LoadProgress accepted a URL")
+	}
+}
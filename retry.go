@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// retryFormat is the input format of Converter.Import for -retry.
+const retryFormat = "retry"
+
+// ImportFromErrorReport imports the rows of an error report written with
+// Options.ErrorReport, so rows corrected in the report can be retried
+// without the rest of the input. CSV rows are read by the canonical names
+// the report records for their columns, whatever the layout of their file,
+// and JSON Lines rows from their object. Entries without a row, such as CSV
+// quoting errors, cannot be retried and are skipped with a warning. Rows
+// keep the line numbers of the original input in messages and in a new
+// error report. Like ImportFromCSV, it returns the converter's Stats.
+func (c *Converter) ImportFromErrorReport(ctx context.Context, path string) (Stats, error) {
+	start := time.Now()
+	err := c.importErrorReport(ctx, path)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importErrorReport(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening error report: %v", err)
+	}
+	defer f.Close()
+
+	release, err := c.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// layouts caches the layout of each set of columns, keyed by the names
+	// joined with commas, as every row of a CSV shares them.
+	layouts := make(map[string]columnLayout)
+	reader := bufio.NewReader(f)
+	for reportLine := 1; ; reportLine++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+
+		text, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error reading error report: %v", err)
+		}
+		if len(bytes.TrimSpace(text)) > 0 {
+			var entry failedRow
+			if jsonErr := json.Unmarshal(text, &entry); jsonErr != nil {
+				return fmt.Errorf("line %d of the error report is not a failed row: %v", reportLine, jsonErr)
+			}
+			if err := c.retryRow(ctx, entry, layouts); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return c.flushPending(ctx)
+		}
+	}
+}
+
+// retryRow imports the row of one error report entry.
+func (c *Converter) retryRow(ctx context.Context, entry failedRow, layouts map[string]columnLayout) error {
+	c.stats.rowsRead++
+	switch {
+	case len(entry.Object) > 0:
+		return c.importJSONLine(ctx, entry.Object, entry.Line)
+	case len(entry.Columns) > 0:
+		key := strings.Join(entry.Columns, ",")
+		layout, ok := layouts[key]
+		if !ok {
+			layout = headerLayout(entry.Columns)
+			layouts[key] = layout
+		}
+		return c.importCSVRow(ctx, entry.Row, c.csvSource(entry.Columns, entry.Row), layout, entry.Line, entry.Line)
+	case len(entry.Row) == 1:
+		// A JSON Lines line that was not valid JSON, possibly corrected since.
+		return c.importJSONLine(ctx, []byte(entry.Row[0]), entry.Line)
+	default:
+		log.Printf("[WARN] Cannot retry line %d, the report does not hold its row: %s", entry.Line, entry.Error)
+		c.skipRows(reasonNoRow, 1)
+		return nil
+	}
+}
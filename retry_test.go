@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// v1RetryCSV returns a v1 CSV, with Caido's header, of two rows, the second
+// a child of the first with the given response_raw.
+func v1RetryCSV(responseRaw string) string {
+	var header []string
+	for _, f := range columnFields {
+		if !f.optional {
+			header = append(header, f.field)
+		}
+	}
+	request := func(path string) string {
+		return base64.StdEncoding.EncodeToString([]byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	}
+	var b strings.Builder
+	b.WriteString(strings.Join(header, ",") + "\n")
+	fmt.Fprintf(&b, "1,example.com,GET,/app.js,40,8443,%s,true,v=1,.js,intercept,none,false,,1700000000000,1,404,%s,42,none,false,,1700000000250\n", request("/app.js?v=1"), v1RetryResponse)
+	fmt.Fprintf(&b, "2,example.com,POST,/api.php,41,8443,%s,true,,.php,replay,manual,true,1,1700000001000,2,404,%s,42,manual,true,1,1700000001500\n", request("/api.php"), responseRaw)
+	return b.String()
+}
+
+// v1RetryResponse is the response_raw of the rows of v1RetryCSV.
+var v1RetryResponse = base64.StdEncoding.EncodeToString([]byte("HTTP/1.1 404 Not Found\r\nContent-Length: 2\r\n\r\nno"))
+
+// importRetryTest imports path in format into project like main does,
+// linking parents afterwards.
+func importRetryTest(t *testing.T, project, path, format string, opts Options) Stats {
+	t.Helper()
+	c, err := NewConverter(project, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	stats, err := c.Import(context.Background(), path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemapParents(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+// tableRows returns every row of a table in id order, formatted as text.
+func tableRows(t *testing.T, db *sql.DB, table string) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT * FROM " + table + " ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatal(err)
+		}
+		fields := make([]string, len(columns))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			fields[i] = fmt.Sprintf("%s=%v", columns[i], v)
+		}
+		got = append(got, strings.Join(fields, " "))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// TestRetryV1Row retries a failed row of a v1 file, which must be stored
+// exactly as if it had not failed.
+func TestRetryV1Row(t *testing.T) {
+	project := newTestProject(t)
+	reportPath := writeTestFile(t, "errors.jsonl", "")
+	report, err := createErrorReport(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := importRetryTest(t, project, writeTestFile(t, "v1.csv", v1RetryCSV("not base64!")), "csv", Options{ErrorReport: report})
+	report.Close()
+	if stats.RowsInserted != 1 || stats.RowsFailed != 1 {
+		t.Fatalf("inserted %d and failed %d rows, want 1 and 1", stats.RowsInserted, stats.RowsFailed)
+	}
+
+	// Correct the response in the report.
+	f, err := os.Open(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry failedRow
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	if !scanner.Scan() {
+		t.Fatalf("the error report is empty: %v", scanner.Err())
+	}
+	err = json.Unmarshal(scanner.Bytes(), &entry)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := csvColumns; !reflect.DeepEqual(entry.Columns, want) {
+		t.Fatalf("the report records columns %v, want %v", entry.Columns, want)
+	}
+	entry.Row[17] = v1RetryResponse
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(reportPath, append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stats = importRetryTest(t, project, reportPath, retryFormat, Options{})
+	if stats.RowsInserted != 1 {
+		t.Fatalf("retry inserted %d rows, want 1 (failed %d: %v)", stats.RowsInserted, stats.RowsFailed, stats.FailReasons)
+	}
+
+	// The project must hold what importing the corrected file does.
+	want := newTestProject(t)
+	importRetryTest(t, want, writeTestFile(t, "fixed.csv", v1RetryCSV(v1RetryResponse)), "csv", Options{})
+	for _, c := range []struct{ db, table string }{
+		{"database.caido", "requests"},
+		{"database.caido", "responses"},
+		{"database_raw.caido", "requests_raw"},
+		{"database_raw.caido", "responses_raw"},
+	} {
+		got, expected := tableRows(t, openTestDB(t, project, c.db), c.table), tableRows(t, openTestDB(t, want, c.db), c.table)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s after the retry:\n%s\nwant:\n%s", c.table, strings.Join(got, "\n"), strings.Join(expected, "\n"))
+		}
+	}
+}
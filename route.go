@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// routeReject is the project of a -route rule whose rows are failed instead
+// of imported.
+const routeReject = "-"
+
+// readRoutes reads a -route file of host=project lines, as read by
+// readMapping. Hosts are keyed like hostAliases, so "*.example.com" matches
+// every subdomain of example.com.
+func readRoutes(path string) (map[string]string, error) {
+	mapping, err := readMapping(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := make(map[string]string, len(mapping))
+	for host, project := range mapping {
+		if host == "" || project == "" {
+			return nil, fmt.Errorf("invalid rule %s=%s", host, project)
+		}
+		rules[strings.TrimRight(strings.ToLower(host), ".")] = project
+	}
+	return rules, nil
+}
+
+// router dispatches the rows of an import to the projects of -route rules.
+type router struct {
+	rules map[string]string
+	// converters holds a Converter for each project named by the rules,
+	// keyed by the project as written in them. The converter's own project
+	// maps to the converter itself.
+	converters map[string]*Converter
+	// workers holds the worker of each routed converter while an import
+	// with Options.ParallelRoutes runs.
+	workers map[*Converter]*routeWorker
+}
+
+// Sizes for Options.ParallelRoutes: how many rows can wait for each worker
+// before the dispatcher blocks, and how many rows a worker imports between
+// progress reports.
+const (
+	routeQueueSize     = 256
+	routeProgressEvery = 10000
+)
+
+// routeJob is a row sent to a routed project's worker.
+type routeJob struct {
+	record CSVRecord
+	line   int
+}
+
+// routeWorker imports the rows routed to one project in a goroutine of its
+// own, for Options.ParallelRoutes. Only the worker touches its converter
+// until it is drained, except for the failure count, which it publishes in
+// failed for -max-errors.
+type routeWorker struct {
+	target *Converter
+	jobs   chan routeJob
+	// pending counts the rows sent but not yet imported, and done is closed
+	// once jobs is closed and the worker has returned.
+	pending sync.WaitGroup
+	done    chan struct{}
+	failed  atomic.Int64
+	// err is the error that stopped the worker, after which the rows sent
+	// to it are dropped.
+	mu  sync.Mutex
+	err error
+}
+
+// startRouteWorker starts a worker importing rows into target until its jobs
+// are closed.
+func startRouteWorker(ctx context.Context, target *Converter) *routeWorker {
+	w := &routeWorker{target: target, jobs: make(chan routeJob, routeQueueSize), done: make(chan struct{})}
+	go w.run(ctx)
+	return w
+}
+
+func (w *routeWorker) run(ctx context.Context) {
+	defer close(w.done)
+	start := time.Now()
+	rows := 0
+	for job := range w.jobs {
+		if w.error() == nil {
+			if err := w.store(ctx, job); err != nil {
+				w.mu.Lock()
+				w.err = fmt.Errorf("project %s: %w", w.target.projectPath, err)
+				w.mu.Unlock()
+			}
+			w.failed.Store(int64(w.target.stats.rowsFailed))
+			if rows++; rows%routeProgressEvery == 0 {
+				log.Printf("[INFO] Routed to %s: %d rows in %v, %d inserted, %d failed", w.target.projectPath, rows, time.Since(start).Round(time.Second), w.target.stats.rowsInserted, w.target.stats.rowsFailed)
+			}
+		}
+		w.pending.Done()
+	}
+}
+
+// store imports one row, failing it on a panic as importRecord does.
+func (w *routeWorker) store(ctx context.Context, job routeJob) error {
+	defer w.target.recoverRow(job.line, job.record.source)
+	return w.target.storeRecord(ctx, job.record, job.line)
+}
+
+// error returns the error that stopped the worker, if any.
+func (w *routeWorker) error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// send queues a row for the worker, or returns the error that stopped it.
+func (w *routeWorker) send(record CSVRecord, line int) error {
+	if err := w.error(); err != nil {
+		return err
+	}
+	w.pending.Add(1)
+	w.jobs <- routeJob{record: record, line: line}
+	return nil
+}
+
+// drain waits until the workers have imported every row sent to them, and
+// returns the first error that stopped one.
+func (r *router) drain() error {
+	if r == nil {
+		return nil
+	}
+	var first error
+	for _, w := range r.workers {
+		w.pending.Wait()
+		if err := w.error(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// rowsFailed returns the number of rows failed in the converter and its
+// routed projects, which may be counted by their workers meanwhile.
+func (c *Converter) rowsFailed() int {
+	failed := c.stats.rowsFailed
+	for _, target := range c.routes.targets(c) {
+		if w := c.routes.workers[target]; w != nil {
+			failed += int(w.failed.Load())
+		} else {
+			failed += target.stats.rowsFailed
+		}
+	}
+	return failed
+}
+
+// OpenRoutes makes the converter send each row to the project of the rule
+// matching its host, opening a Converter with the same options for every
+// project of rules. Rows whose host matches no rule are imported into the
+// converter's own project, and those whose rule names routeReject fail.
+func (c *Converter) OpenRoutes(rules map[string]string) error {
+	own, err := filepath.Abs(c.projectPath)
+	if err != nil {
+		return err
+	}
+	r := &router{rules: rules, converters: make(map[string]*Converter)}
+	for _, project := range rules {
+		if project == routeReject || r.converters[project] != nil {
+			continue
+		}
+		if abs, err := filepath.Abs(project); err == nil && abs == own {
+			r.converters[project] = c
+			continue
+		}
+		target, err := NewConverter(project, c.opts)
+		if err != nil {
+			r.close(c)
+			return fmt.Errorf("failed to open project %s: %w", project, err)
+		}
+		r.converters[project] = target
+	}
+	c.routes = r
+	return nil
+}
+
+// dispatch imports a record into target, the converter route chose for it,
+// through the target's worker with Options.ParallelRoutes.
+func (c *Converter) dispatch(ctx context.Context, target *Converter, record CSVRecord, line int) error {
+	if c.routes != nil {
+		if w := c.routes.workers[target]; w != nil {
+			return w.send(record, line)
+		}
+	}
+	return target.storeRecord(ctx, record, line)
+}
+
+// route returns the converter to import a row for host into.
+func (c *Converter) route(host string) (*Converter, error) {
+	if c.routes == nil {
+		return c, nil
+	}
+	name := host
+	if h, _ := splitHostPort(host); h != "" {
+		name = h
+	}
+	project, ok := matchHost(c.routes.rules, name)
+	switch {
+	case !ok:
+		return c, nil
+	case project == routeReject:
+		return nil, fmt.Errorf("host %s is rejected by -route", host)
+	default:
+		return c.routes.converters[project], nil
+	}
+}
+
+// targets returns the routed converters other than the converter itself,
+// sorted by project.
+func (r *router) targets(self *Converter) []*Converter {
+	if r == nil {
+		return nil
+	}
+	projects := make([]string, 0, len(r.converters))
+	for project, target := range r.converters {
+		if target != self {
+			projects = append(projects, project)
+		}
+	}
+	sort.Strings(projects)
+	targets := make([]*Converter, len(projects))
+	for i, project := range projects {
+		targets[i] = r.converters[project]
+	}
+	return targets
+}
+
+// close closes the routed converters other than self.
+func (r *router) close(self *Converter) {
+	for _, target := range r.targets(self) {
+		target.Close()
+	}
+}
+
+// prepareRoutes prepares the routed converters for an import, like prepare,
+// and with Options.ParallelRoutes starts a worker for each. The returned
+// function stops the workers once they have imported the rows sent to them,
+// and releases the converters.
+func (c *Converter) prepareRoutes(ctx context.Context) (func(), error) {
+	var releases []func()
+	release := func() {
+		for _, w := range c.routes.workers {
+			close(w.jobs)
+			<-w.done
+			if err := w.error(); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		}
+		c.routes.workers = nil
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, target := range c.routes.targets(c) {
+		r, err := target.prepare(ctx)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to prepare project %s: %w", target.projectPath, err)
+		}
+		releases = append(releases, r)
+	}
+	if c.opts.ParallelRoutes {
+		c.routes.workers = make(map[*Converter]*routeWorker)
+		for _, target := range c.routes.targets(c) {
+			c.routes.workers[target] = startRouteWorker(ctx, target)
+		}
+	}
+	return release, nil
+}
+
+// logRoutes logs the rows imported into each routed project other than the
+// converter's own.
+func (c *Converter) logRoutes() {
+	for _, target := range c.routes.targets(c) {
+		log.Printf("[INFO] Routed to %s: %d inserted, %d failed", target.projectPath, target.stats.rowsInserted, target.stats.rowsFailed)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// withSavepoint runs fn inside the SQLite savepoint name, rolling back
+// everything fn inserted if it fails, so a record whose request insert fails
+// does not leave its response and raw rows behind. Outside a -commit-every
+// batch the outermost savepoint is a transaction of its own. The savepoint
+// statements ignore cancellation of ctx so that an interrupted row is still
+// rolled back.
+func (c *Converter) withSavepoint(ctx context.Context, name string, fn func() error) error {
+	ctx = context.WithoutCancel(ctx)
+	exec := c.conn().ExecContext
+
+	if _, err := exec(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	mark := c.emit.begin()
+	tracked := c.tracked()
+	if err := fn(); err != nil {
+		c.emit.end(mark, false)
+		c.untrack(tracked)
+		if _, rbErr := exec(ctx, "ROLLBACK TO "+name); rbErr != nil {
+			log.Printf("[WARN] Failed to roll back savepoint %s: %v", name, rbErr)
+		}
+		if _, relErr := exec(ctx, "RELEASE "+name); relErr != nil {
+			log.Printf("[WARN] Failed to release savepoint %s: %v", name, relErr)
+		}
+		return err
+	}
+	if _, err := exec(ctx, "RELEASE "+name); err != nil {
+		c.emit.end(mark, false)
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	c.emit.end(mark, true)
+	return nil
+}
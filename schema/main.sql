@@ -0,0 +1,102 @@
+-- Tables of database.caido: the HTTP history the importer writes, and the
+-- scopes, findings and WebSocket history of a Caido project, so that a
+-- project created with -init supports every feature of the importer.
+CREATE TABLE IF NOT EXISTS requests_metadata (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    color TEXT,
+    label TEXT,
+    notes TEXT
+);
+
+CREATE TABLE IF NOT EXISTS responses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status_code INTEGER NOT NULL,
+    raw_id INTEGER NOT NULL,
+    length INTEGER NOT NULL,
+    alteration TEXT NOT NULL,
+    edited BOOLEAN NOT NULL,
+    parent_id INTEGER REFERENCES responses(id),
+    created_at INTEGER NOT NULL,
+    roundtrip_time INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    length INTEGER NOT NULL,
+    port INTEGER NOT NULL,
+    is_tls BOOLEAN NOT NULL,
+    raw_id INTEGER NOT NULL,
+    query TEXT NOT NULL,
+    response_id INTEGER REFERENCES responses(id),
+    source TEXT NOT NULL,
+    alteration TEXT NOT NULL,
+    edited BOOLEAN NOT NULL,
+    parent_id INTEGER REFERENCES requests(id),
+    created_at INTEGER NOT NULL,
+    metadata_id INTEGER REFERENCES requests_metadata(id)
+);
+
+CREATE INDEX IF NOT EXISTS requests_host_idx ON requests (host);
+CREATE INDEX IF NOT EXISTS requests_response_id_idx ON requests (response_id);
+
+CREATE TABLE IF NOT EXISTS intercept_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    request_id INTEGER NOT NULL REFERENCES requests(id)
+);
+
+CREATE INDEX IF NOT EXISTS intercept_entries_request_id_idx ON intercept_entries (request_id);
+
+CREATE TABLE IF NOT EXISTS scopes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    allowlist TEXT NOT NULL DEFAULT '[]',
+    denylist TEXT NOT NULL DEFAULT '[]',
+    indexed BOOLEAN NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS findings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    reporter TEXT NOT NULL,
+    dedupe_key TEXT,
+    hidden BOOLEAN NOT NULL DEFAULT 0,
+    host TEXT NOT NULL,
+    path TEXT NOT NULL,
+    request_id INTEGER NOT NULL REFERENCES requests(id),
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS findings_request_id_idx ON findings (request_id);
+
+CREATE TABLE IF NOT EXISTS streams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    is_tls BOOLEAN NOT NULL,
+    protocol TEXT NOT NULL,
+    direction TEXT NOT NULL,
+    source TEXT NOT NULL,
+    request_id INTEGER NOT NULL REFERENCES requests(id),
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS streams_request_id_idx ON streams (request_id);
+
+CREATE TABLE IF NOT EXISTS stream_ws_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    stream_id INTEGER NOT NULL REFERENCES streams(id),
+    raw_id INTEGER NOT NULL,
+    direction TEXT NOT NULL,
+    format TEXT NOT NULL,
+    length INTEGER NOT NULL,
+    edited BOOLEAN NOT NULL,
+    alteration TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS stream_ws_messages_stream_id_idx ON stream_ws_messages (stream_id);
@@ -0,0 +1,21 @@
+-- Tables of database_raw.caido: the raw HTTP messages and WebSocket frames.
+CREATE TABLE IF NOT EXISTS requests_raw (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    data BLOB NOT NULL,
+    source TEXT NOT NULL,
+    alteration TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS responses_raw (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    data BLOB NOT NULL,
+    source TEXT NOT NULL,
+    alteration TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS stream_ws_messages_raw (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    data BLOB NOT NULL,
+    source TEXT NOT NULL DEFAULT 'import',
+    alteration TEXT NOT NULL DEFAULT 'none'
+);
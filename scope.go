@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// importScopeName names the scope that -update-scope maintains.
+const importScopeName = "CSV Import"
+
+// UpdateScope adds every host imported so far to the allowlist of the
+// "CSV Import" scope, creating it if needed, so imported hosts show up in
+// scoped views without a manual refresh. Projects without a scopes table
+// holding name and allowlist columns are skipped with a warning.
+func (c *Converter) UpdateScope(ctx context.Context) error {
+	columns, err := tableColumns(ctx, c.db, "scopes")
+	if err != nil {
+		return err
+	}
+	if !columns["name"] || !columns["allowlist"] {
+		log.Println("[WARN] Project has no scopes table with name and allowlist columns, skipping scope update")
+		return nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var allowlistJSON string
+	err = tx.QueryRowContext(ctx, "SELECT id, allowlist FROM scopes WHERE name = ?", importScopeName).Scan(&id, &allowlistJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read scope: %w", err)
+	}
+	exists := err == nil
+
+	hosts := make(map[string]bool)
+	if exists && allowlistJSON != "" {
+		var allowlist []string
+		if err := json.Unmarshal([]byte(allowlistJSON), &allowlist); err != nil {
+			return fmt.Errorf("failed to decode allowlist of scope %q: %w", importScopeName, err)
+		}
+		for _, host := range allowlist {
+			hosts[host] = true
+		}
+	}
+	added := 0
+	for host := range c.stats.hosts {
+		if !hosts[host] {
+			hosts[host] = true
+			added++
+		}
+	}
+
+	allowlist := make([]string, 0, len(hosts))
+	for host := range hosts {
+		allowlist = append(allowlist, host)
+	}
+	sort.Strings(allowlist)
+	data, err := json.Marshal(allowlist)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		_, err = tx.ExecContext(ctx, "UPDATE scopes SET allowlist = ? WHERE id = ?", string(data), id)
+	} else {
+		_, err = tx.ExecContext(ctx, "INSERT INTO scopes (name, allowlist) VALUES (?, ?)", importScopeName, string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write scope: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[INFO] Added %d hosts to scope %q", added, importScopeName)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// verifySQL reads back one request with its response and raw messages.
+// %[1]s and %[2]s are the schemas holding requests_raw and responses_raw.
+const verifySQL = `
+	SELECT r.host, r.method, r.path, r.length, r.port, r.is_tls, r.query, r.source, r.alteration, r.edited, r.parent_id, r.created_at, rr.data,
+		r.response_id, s.status_code, s.length, s.alteration, s.edited, s.parent_id, s.created_at, sr.data
+	FROM requests r
+	LEFT JOIN %[1]s.requests_raw rr ON rr.id = r.raw_id
+	LEFT JOIN responses s ON s.id = r.response_id
+	LEFT JOIN %[2]s.responses_raw sr ON sr.id = s.raw_id
+	WHERE r.id = ?`
+
+// verifyRecord reads back the request inserted for record, and its
+// response, and reports every column that differs from the record as it was
+// inserted, for Options.SelfTest. This catches truncated values, blobs
+// altered by encoding and requests linked to the wrong response.
+func (c *Converter) verifyRecord(ctx context.Context, requestID int64, responseID sql.NullInt64, record CSVRecord) error {
+	var (
+		host, method, path, query, source, alteration string
+		length, port, createdAt                       int64
+		isTLS                                         bool
+		edited, responseEdited                        sql.NullBool
+		parentID, storedResponseID, responseParentID  sql.NullInt64
+		status, responseLength, responseCreatedAt     sql.NullInt64
+		responseAlteration                            sql.NullString
+		raw, responseRaw                              []byte
+	)
+	err := c.conn().QueryRowContext(ctx, fmt.Sprintf(verifySQL, c.schema.rawSchema, c.schema.responseRawSchema), requestID).Scan(
+		&host, &method, &path, &length, &port, &isTLS, &query, &source, &alteration, &edited, &parentID, &createdAt, &raw,
+		&storedResponseID, &status, &responseLength, &responseAlteration, &responseEdited, &responseParentID, &responseCreatedAt, &responseRaw)
+	if err != nil {
+		return fmt.Errorf("failed to read back request %d: %w", requestID, err)
+	}
+
+	var diffs []string
+	check := func(column string, got, want any) {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			diffs = append(diffs, fmt.Sprintf("%s is %v, expected %v", column, got, want))
+		}
+	}
+	checkBlob := func(column string, got, want []byte) {
+		if !bytes.Equal(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s is %d bytes, expected %d bytes as inserted", column, len(got), len(want)))
+		}
+	}
+
+	check("host", host, record.Host)
+	check("method", method, record.Method)
+	check("path", path, record.Path)
+	check("length", length, record.Length)
+	check("port", port, record.Port)
+	check("is_tls", isTLS, record.IsTLS)
+	check("query", query, record.Query)
+	check("source", source, record.Source)
+	check("alteration", alteration, record.Alteration)
+	check("edited", edited, record.Edited)
+	// A parent that is not in the project yet is linked after the import.
+	if !c.deferParents() && (parentID.Valid || !record.ParentID.Valid) {
+		check("parent_id", parentID, record.ParentID)
+	}
+	check("created_at", createdAt, record.CreatedAt)
+	checkBlob("raw", raw, record.Raw)
+
+	check("response_id", storedResponseID, responseID)
+	if responseID.Valid {
+		check("response_status_code", status.Int64, record.ResponseStatusCode)
+		check("response_length", responseLength.Int64, record.ResponseLength)
+		check("response_alteration", responseAlteration.String, record.ResponseAlteration)
+		check("response_edited", responseEdited, record.ResponseEdited)
+		if !c.deferParents() && (responseParentID.Valid || !record.ResponseParentID.Valid) {
+			check("response_parent_id", responseParentID, record.ResponseParentID)
+		}
+		check("response_created_at", responseCreatedAt.Int64, record.ResponseCreatedAt)
+		checkBlob("response_raw", responseRaw, record.ResponseRaw)
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("request %d does not match its row: %s", requestID, strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// runSelfTest imports the input into a new project in a temporary directory,
+// reading every inserted request back and comparing it with the row it came
+// from. It exits non-zero if any row failed to import or did not match.
+func runSelfTest(path, format string, opts Options) {
+	log.Printf("[INFO] Self-testing %s", path)
+	stats, err := selfTest(path, format, opts)
+	if err != nil {
+		log.Fatalf("Self-test failed: %v", err)
+	}
+	if stats.RowsFailed > 0 {
+		log.Fatalf("Self-test FAILED: %d of %d rows failed to import or read back differently (%d verified, %d skipped).", stats.RowsFailed, stats.RowsRead, stats.RowsInserted, stats.RowsSkipped)
+	}
+	log.Printf("[INFO] Self-test passed: %d of %d rows imported and read back unchanged (%d skipped).", stats.RowsInserted, stats.RowsRead, stats.RowsSkipped)
+}
+
+// selfTest performs runSelfTest's import, removing the temporary project
+// afterwards.
+func selfTest(path, format string, opts Options) (Stats, error) {
+	dir, err := os.MkdirTemp("", "caido-selftest-")
+	if err != nil {
+		return Stats{}, fmt.Errorf("error creating temporary project: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := initProject(dir, true, opts.Key); err != nil {
+		return Stats{}, err
+	}
+
+	opts.SelfTest = true
+	// The temporary project keeps its raw tables in database_raw.caido.
+	opts.RawDatabases = nil
+	converter, err := NewConverter(dir, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer converter.Close()
+
+	ctx := context.Background()
+	stats, err := converter.Import(ctx, path, format)
+	if err != nil {
+		return stats, err
+	}
+	if err := converter.RemapParents(ctx); err != nil {
+		return stats, err
+	}
+	violations, err := converter.foreignKeyViolations(ctx)
+	if err != nil {
+		return stats, err
+	}
+	if violations > 0 {
+		return stats, fmt.Errorf("the imported rows have %d foreign key violations", violations)
+	}
+	return stats, nil
+}
+
+// foreignKeyViolations counts the rows of the project whose foreign keys do
+// not refer to an existing row.
+func (c *Converter) foreignKeyViolations(ctx context.Context) (int, error) {
+	rows, err := c.db.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return 0, fmt.Errorf("error checking foreign keys: %v", err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
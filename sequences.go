@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// ReconcileSequences raises the AUTOINCREMENT counter of every table in the
+// project and its raw database to at least the table's largest id, in one
+// transaction. SQLite never hands out an id below the counter, so a counter
+// left behind the table, as can happen when rows are written with explicit
+// ids or the counter is edited, would otherwise let a later insert reuse ids
+// that links elsewhere still point at. Counters are never lowered.
+func (c *Converter) ReconcileSequences(ctx context.Context) error {
+	schemas := c.schema.schemas()
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, schema := range schemas {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT name, seq FROM %s.sqlite_sequence", schema))
+		if err != nil {
+			// Databases without AUTOINCREMENT tables have no sqlite_sequence.
+			c.debugf("No id sequences in %s: %v", schema, err)
+			continue
+		}
+		sequences := make(map[string]int64)
+		for rows.Next() {
+			var name string
+			var seq int64
+			if err := rows.Scan(&name, &seq); err != nil {
+				rows.Close()
+				return err
+			}
+			sequences[name] = seq
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for name, seq := range sequences {
+			var maxID int64
+			query := fmt.Sprintf("SELECT coalesce(max(rowid), 0) FROM %s.%s", schema, quoteIdentifier(name))
+			if err := tx.QueryRowContext(ctx, query).Scan(&maxID); err != nil {
+				return fmt.Errorf("failed to read the largest id of %s.%s: %w", schema, name, err)
+			}
+			if maxID <= seq {
+				continue
+			}
+			update := fmt.Sprintf("UPDATE %s.sqlite_sequence SET seq = ? WHERE name = ?", schema)
+			if _, err := tx.ExecContext(ctx, update, maxID, name); err != nil {
+				return fmt.Errorf("failed to update the id sequence of %s.%s: %w", schema, name, err)
+			}
+			log.Printf("[INFO] Advanced the id sequence of %s.%s from %d to %d", schema, name, seq, maxID)
+		}
+	}
+	return tx.Commit()
+}
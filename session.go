@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// updateSessionSQL stamps a request or response with the session it was
+// imported into, for schemas that partition data by session. %s is the
+// table.
+const updateSessionSQL = "UPDATE %s SET session_id = ? WHERE id = ?"
+
+// prepareSession prepares the statements that stamp imported rows with a
+// session, if the project's requests table has a session_id column. The
+// session is Options.Session, which must exist in the sessions table when
+// the project has one, or otherwise the project's first session. Projects
+// without the column are left alone unless a session was asked for.
+func (c *Converter) prepareSession(ctx context.Context, stmts *statements) error {
+	requestColumns, err := tableColumns(ctx, c.db, "requests")
+	if err != nil {
+		return err
+	}
+	if !requestColumns["session_id"] {
+		if c.opts.Session != "" {
+			return fmt.Errorf("requests table has no session_id column, so -session is not supported by this project")
+		}
+		return nil
+	}
+
+	sessionColumns, err := tableColumns(ctx, c.db, "sessions")
+	if err != nil {
+		return err
+	}
+	session := c.opts.Session
+	switch {
+	case len(sessionColumns) == 0 && session == "":
+		log.Printf("[WARN] Project has a session_id column but no sessions table; leaving session_id unset")
+		return nil
+	case len(sessionColumns) == 0:
+		log.Printf("[WARN] Project has no sessions table; not checking that session %s exists", session)
+	case session == "":
+		err := c.db.QueryRowContext(ctx, "SELECT id FROM sessions ORDER BY id LIMIT 1").Scan(&session)
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] Project has no sessions; leaving session_id unset")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read sessions: %w", err)
+		}
+	default:
+		var n int
+		if err := c.db.QueryRowContext(ctx, "SELECT count(*) FROM sessions WHERE id = ?", session).Scan(&n); err != nil {
+			return fmt.Errorf("failed to read sessions: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("session %s does not exist in this project", session)
+		}
+	}
+
+	if stmts.requestSession, err = stmts.prepare(ctx, c.db, fmt.Sprintf(updateSessionSQL, "requests")); err != nil {
+		return err
+	}
+	responseColumns, err := tableColumns(ctx, c.db, "responses")
+	if err != nil {
+		return err
+	}
+	if responseColumns["session_id"] {
+		if stmts.responseSession, err = stmts.prepare(ctx, c.db, fmt.Sprintf(updateSessionSQL, "responses")); err != nil {
+			return err
+		}
+	}
+	c.session = session
+	log.Printf("[INFO] Importing into session %s", session)
+	return nil
+}
+
+// stampSession sets the session of a row inserted into table with stmt, if
+// sessions are in use.
+func (c *Converter) stampSession(ctx context.Context, stmt *sql.Stmt, table string, id int64) error {
+	if stmt == nil {
+		return nil
+	}
+	if err := c.stmts.exec(ctx, stmt, c.session, id); err != nil {
+		return fmt.Errorf("failed to set session of %s: %w", table, err)
+	}
+	return nil
+}
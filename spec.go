@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Column types of a -spec file.
+const (
+	SpecInt    = "int"
+	SpecBool   = "bool"
+	SpecString = "string"
+	SpecBase64 = "base64"
+)
+
+// columnSpec declares one column of a -spec file.
+type columnSpec struct {
+	name     string
+	typ      string
+	required bool
+}
+
+// csvSpec is a -spec file: the columns a CSV must have, in any order.
+type csvSpec []columnSpec
+
+// readSpec loads a -spec file. Each line declares a column as its name, its
+// type and optionally "required", separated by whitespace, e.g.
+// "created_at int required". Blank lines and lines starting with # are
+// ignored.
+func readSpec(path string) (csvSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spec csvSpec
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && fields[2] != "required") {
+			return nil, fmt.Errorf("%s:%d: expected NAME TYPE [required], got %q", path, lineNum, line)
+		}
+		column := columnSpec{name: strings.ToLower(fields[0]), typ: fields[1], required: len(fields) == 3}
+		switch column.typ {
+		case SpecInt, SpecBool, SpecString, SpecBase64:
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown type %q: must be %s, %s, %s or %s", path, lineNum, column.typ, SpecInt, SpecBool, SpecString, SpecBase64)
+		}
+		if seen[column.name] {
+			return nil, fmt.Errorf("%s:%d: column %q is declared twice", path, lineNum, column.name)
+		}
+		seen[column.name] = true
+		spec = append(spec, column)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("%s declares no columns", path)
+	}
+	return spec, nil
+}
+
+// boundSpec is a csvSpec matched to the columns of a header row.
+type boundSpec struct {
+	columns []columnSpec
+	// index holds the position of each of columns in the rows.
+	index []int
+}
+
+// bind checks the header row of a CSV against the spec: every column must be
+// declared, and every required column present. Names are matched
+// case-insensitively. Blank and "-" names, as used by -columns to skip a
+// column, are ignored.
+func (s csvSpec) bind(header []string) (*boundSpec, error) {
+	declared := make(map[string]bool, len(s))
+	for _, column := range s {
+		declared[column.name] = true
+	}
+	positions := make(map[string]int, len(header))
+	var problems []string
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "-" {
+			continue
+		}
+		if !declared[name] {
+			problems = append(problems, fmt.Sprintf("column %d %q is not in the spec", i+1, name))
+			continue
+		}
+		positions[name] = i
+	}
+
+	b := &boundSpec{}
+	for _, column := range s {
+		i, ok := positions[column.name]
+		if !ok {
+			if column.required {
+				problems = append(problems, fmt.Sprintf("required column %q is missing", column.name))
+			}
+			continue
+		}
+		b.columns = append(b.columns, column)
+		b.index = append(b.index, i)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return b, nil
+}
+
+// specViolation is a field of a row that does not match its columnSpec.
+type specViolation struct {
+	// field is the position of the field in the row.
+	field int
+	err   error
+}
+
+// check returns the fields of row that do not match the spec. Fields missing
+// from a short row are treated as blank.
+func (b *boundSpec) check(row []string) []specViolation {
+	var violations []specViolation
+	for n, column := range b.columns {
+		i := b.index[n]
+		value := ""
+		if i < len(row) {
+			value = trimCR(row[i])
+		}
+		if err := column.checkValue(value); err != nil {
+			violations = append(violations, specViolation{field: i, err: fmt.Errorf("%s: %w", column.name, err)})
+		}
+	}
+	return violations
+}
+
+// checkValue reports whether value is a valid value of the column.
+func (column columnSpec) checkValue(value string) error {
+	if value == "" {
+		if column.required {
+			return fmt.Errorf("required value is blank")
+		}
+		return nil
+	}
+	var err error
+	switch column.typ {
+	case SpecInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case SpecBool:
+		_, err = strconv.ParseBool(value)
+	case SpecBase64:
+		_, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", truncateForLog([]byte(value)), column.typ)
+	}
+	return nil
+}
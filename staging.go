@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// stagedTables are the tables Options.TablePrefix writes to prefixed copies
+// of, with "raw." standing for the schema holding the raw tables.
+var stagedTables = []string{"intercept_entries", "requests", "responses", "raw.requests_raw", "raw.responses_raw"}
+
+// tablePrefixPattern is the grammar of -table-prefix values, which are used
+// unquoted in table names.
+var tablePrefixPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// stagedTable returns the name of the staging copy of one of stagedTables.
+func (c *Converter) stagedTable(table, prefix string) string {
+	table = c.rawTable(table)
+	if i := strings.IndexByte(table, '.'); i != -1 {
+		return table[:i+1] + prefix + table[i+1:]
+	}
+	return prefix + table
+}
+
+// createStagingTables creates the staging copies of stagedTables that do not
+// exist yet. They have the columns of the live tables but none of their
+// constraints, so staged rows only refer to each other and nothing checks
+// them against the live tables until they are promoted.
+func (c *Converter) createStagingTables(ctx context.Context) error {
+	for _, table := range stagedTables {
+		live := c.rawTable(table)
+		schema, name := "main", live
+		if i := strings.IndexByte(live, '.'); i != -1 {
+			schema, name = live[:i], live[i+1:]
+		}
+		rows, err := c.db.QueryContext(ctx, "SELECT name, type FROM pragma_table_info(?, ?) WHERE name != 'id' ORDER BY cid", name, schema)
+		if err != nil {
+			return fmt.Errorf("error reading columns of %s: %v", live, err)
+		}
+		columns := []string{"id INTEGER PRIMARY KEY AUTOINCREMENT"}
+		for rows.Next() {
+			var column, typ string
+			if err := rows.Scan(&column, &typ); err != nil {
+				rows.Close()
+				return err
+			}
+			columns = append(columns, strings.TrimSpace(quoteIdentifier(column)+" "+typ))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(columns) == 1 {
+			return fmt.Errorf("project has no %s table to stage rows for", live)
+		}
+
+		staged := c.stagedTable(table, c.opts.TablePrefix)
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", staged, strings.Join(columns, ", "))
+		if _, err := c.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create staging table %s: %w", staged, err)
+		}
+	}
+	return nil
+}
+
+// prepareStaging is prepareAll for Options.TablePrefix. Only the row inserts
+// are prepared: metadata, sessions, tags, file extensions and parent links
+// refer to live rows, so they are left to Promote.
+func (c *Converter) prepareStaging(ctx context.Context) (*statements, error) {
+	if err := c.createStagingTables(ctx); err != nil {
+		return nil, err
+	}
+	stmts, err := prepareStatements(ctx, c.db, c.schema, c.opts.TablePrefix, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.readNullableEdited(ctx); err != nil {
+		stmts.Close()
+		return nil, err
+	}
+	return stmts, nil
+}
+
+// Promote moves the rows staged in the tables named with prefix into the live
+// tables. The staged rows are exported like -export does and the export is
+// imported with the converter's options, so rows are promoted exactly as a
+// direct import would have inserted them. Options.Columns and
+// Options.RawEncodings are ignored. The staging tables are dropped once every
+// row has been promoted, and kept if any failed.
+func (c *Converter) Promote(ctx context.Context, prefix string) (Stats, error) {
+	f, err := os.CreateTemp("", "caido-promote-*.csv")
+	if err != nil {
+		return Stats{}, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	n, err := c.export(ctx, f, prefix, "")
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to read staged rows: %w", err)
+	}
+	log.Printf("[INFO] Promoting %d staged requests", n)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Stats{}, err
+	}
+
+	c.opts.Columns = nil
+	c.opts.RawEncodings = rawEncodings{}
+	stats, err := c.ImportFromReader(ctx, f)
+	if err != nil {
+		return stats, err
+	}
+	if stats.RowsFailed > 0 {
+		log.Printf("[WARN] %d staged rows failed to promote; the staging tables are kept", stats.RowsFailed)
+		return stats, nil
+	}
+
+	for _, table := range stagedTables {
+		if _, err := c.db.ExecContext(ctx, "DROP TABLE "+c.stagedTable(table, prefix)); err != nil {
+			return stats, fmt.Errorf("failed to drop staging table: %w", err)
+		}
+	}
+	return stats, nil
+}
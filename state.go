@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SQL for the -state database, which lists the external ids of the rows
+// imported by earlier runs, whatever the input or project.
+const (
+	createStateTableSQL = `
+		CREATE TABLE IF NOT EXISTS imported_ids (
+			external_id INTEGER PRIMARY KEY,
+			imported_at INTEGER NOT NULL
+		)`
+	selectStateSQL = "SELECT 1 FROM imported_ids WHERE external_id = ?"
+	insertStateSQL = "INSERT OR IGNORE INTO imported_ids (external_id, imported_at) VALUES (?, ?)"
+)
+
+// importState is the -state database. A row whose id it holds is skipped,
+// and the id of every row inserted is added once the row is committed, so
+// that later runs import only new rows.
+type importState struct {
+	// mu serializes the -route-parallel workers.
+	mu   sync.Mutex
+	db   *sql.DB
+	seen *sql.Stmt
+	// deferred holds the ids in pending until flush instead of writing
+	// them as they are committed, for -atomic imports that are only
+	// committed when the staged project is swapped in.
+	deferred bool
+	pending  []int64
+	// recorded counts the ids added to the database.
+	recorded int
+}
+
+// openImportState opens the state database at path, creating it if it does
+// not exist.
+func openImportState(path string) (*importState, error) {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createStateTableSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create imported_ids: %w", err)
+	}
+	seen, err := db.Prepare(selectStateSQL)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &importState{db: db, seen: seen}, nil
+}
+
+// has reports whether an earlier run imported the row with id.
+func (s *importState) has(id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var one int
+	err := s.seen.QueryRow(id).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// record adds the ids of committed rows, or holds them until flush when
+// deferred.
+func (s *importState) record(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deferred {
+		s.pending = append(s.pending, ids...)
+		return nil
+	}
+	return s.write(ids)
+}
+
+// flush adds the ids held back while deferred.
+func (s *importState) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write(s.pending)
+	s.pending = nil
+	return err
+}
+
+// write adds ids in a single transaction.
+func (s *importState) write(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().UnixMilli()
+	for _, id := range ids {
+		if _, err := tx.Exec(insertStateSQL, id, now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.recorded += len(ids)
+	return nil
+}
+
+// Close closes the state database.
+func (s *importState) Close() error {
+	s.seen.Close()
+	return s.db.Close()
+}
+
+// checkState skips a record that an earlier run imported, with
+// Options.State. Blank (zero) IDs cannot be tracked and are always imported.
+func (c *Converter) checkState(record CSVRecord, line int) (skip bool, err error) {
+	if c.opts.State == nil || record.ID == 0 {
+		return false, nil
+	}
+	seen, err := c.opts.State.has(record.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read -state: %w", err)
+	}
+	if seen {
+		c.debugf("Line %d: id %d was imported in an earlier run", line, record.ID)
+		c.skipRows(reasonImportedBefore, 1)
+	}
+	return seen, nil
+}
+
+// recordState adds the id of an inserted record to Options.State: with the
+// open batch when it is committed, or at once outside a batch. An -emit-sql
+// dry run records nothing.
+func (c *Converter) recordState(record CSVRecord) error {
+	if c.opts.State == nil || record.ID == 0 || c.emit != nil {
+		return nil
+	}
+	if c.batch != nil {
+		c.batch.stateIDs = append(c.batch.stateIDs, record.ID)
+		return nil
+	}
+	if err := c.opts.State.record([]int64{record.ID}); err != nil {
+		return fmt.Errorf("failed to write -state: %w", err)
+	}
+	return nil
+}
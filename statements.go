@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// rowColumn is a column the insert of a request, response or raw message can
+// set. The table must have the required ones; the others are left out of the
+// insert when a project's schema lacks them.
+type rowColumn struct {
+	name     string
+	required bool
+}
+
+// Columns of the row inserts, in the order of the values insertRequest and
+// insertResponse give them. The inserts are built by prepareStatements from
+// the columns each project's tables have.
+var (
+	rawColumns      = []rowColumn{{"data", true}, {"source", false}, {"alteration", false}}
+	responseColumns = []rowColumn{{"status_code", true}, {"raw_id", true}, {"length", false}, {"alteration", false}, {"edited", false}, {"parent_id", false}, {"created_at", false}, {"roundtrip_time", false}}
+	requestColumns  = []rowColumn{{"host", true}, {"method", true}, {"path", true}, {"length", false}, {"port", true}, {"is_tls", true}, {"raw_id", true}, {"query", false}, {"response_id", false}, {"source", false}, {"alteration", false}, {"edited", false}, {"parent_id", false}, {"created_at", false}, {"metadata_id", false}}
+)
+
+// SQL for the intercept entry of an imported row, formatted with the prefix
+// of the table names, which is empty unless staging (see staging.go).
+const (
+	insertInterceptSQL = "INSERT INTO %[1]sintercept_entries (request_id) VALUES (?) RETURNING id"
+	// insertPositionedInterceptSQL is insertInterceptSQL for schemas whose
+	// intercept queue is ordered by a position column. A NULL position
+	// appends the entry after the last one, reading the last position in the
+	// insert itself so that concurrent imports cannot take the same one.
+	insertPositionedInterceptSQL = `
+		INSERT INTO %[1]sintercept_entries (request_id, position)
+		VALUES (?, coalesce(?, (SELECT coalesce(max(position), 0) + 1 FROM %[1]sintercept_entries))) RETURNING id`
+
+	// Mappings from the ids in the input to the ids inserted, recorded by
+	// -remap-parents; see remap.go.
+	mapIDSQL     = "INSERT OR REPLACE INTO temp.csv_import_ids (kind, external_id, new_id) VALUES (?, ?, ?)"
+	mapParentSQL = "INSERT INTO temp.csv_import_parents (kind, new_id, parent_external_id) VALUES (?, ?, ?)"
+
+	// updateExtensionSQL stores a request's file extension, for schemas that
+	// have a column for it.
+	updateExtensionSQL = "UPDATE requests SET file_extension = ? WHERE id = ?"
+)
+
+// statements holds the insert statements, prepared once per import and
+// reused for every row to avoid re-parsing the SQL.
+type statements struct {
+	rawResponse *sql.Stmt
+	response    *sql.Stmt
+	rawRequest  *sql.Stmt
+	// metadata is prepared by prepareMetadata, and nil if the project has
+	// no requests_metadata table.
+	metadata  *sql.Stmt
+	request   *sql.Stmt
+	intercept *sql.Stmt
+	// extension is only prepared when file extensions are stored.
+	extension *sql.Stmt
+	// mapID and mapParent are only prepared when remapping parent ids.
+	mapID     *sql.Stmt
+	mapParent *sql.Stmt
+	// tag is only prepared when -tag is stored in csv_import_tags; see
+	// tag.go. metadataTagged is whether metadata takes the tag as its
+	// argument instead.
+	tag            *sql.Stmt
+	metadataTagged bool
+	// traceSource is only prepared with -trace-source; see trace.go.
+	traceSource *sql.Stmt
+	// requestSession and responseSession are only prepared when the project
+	// partitions rows by session; see session.go.
+	requestSession  *sql.Stmt
+	responseSession *sql.Stmt
+	// returning is whether the inserts return their id with RETURNING.
+	returning bool
+	// explicitIDs is whether the request and response inserts take the
+	// row's id as their first argument; see Options.PreserveIDs.
+	explicitIDs bool
+	// interceptPositioned is whether intercept takes the entry's position
+	// as its second argument; see insertPositionedInterceptSQL.
+	interceptPositioned bool
+	// queries holds the SQL of the statements prepared with prepare, and
+	// emit receives them as they run during an -emit-sql dry run.
+	queries map[*sql.Stmt]string
+	emit    *sqlEmitter
+	// kept holds, for the row inserts that leave out columns the project
+	// lacks, the indexes of the arguments they keep; see insertSQL.
+	kept map[*sql.Stmt][]int
+}
+
+// prepareStatements prepares all row insert statements against db for a
+// project with the given schema, writing raw messages to the tables in
+// schema.rawSchema and schema.responseRawSchema and every row to tables whose names start with prefix.
+// Without schema.returning, the RETURNING clause is dropped and ids are read
+// from LastInsertId instead. With explicitIDs, the request and response
+// inserts set the id column too.
+func prepareStatements(ctx context.Context, db *sql.DB, schema projectSchema, prefix string, explicitIDs bool) (*statements, error) {
+	s := &statements{returning: schema.returning, explicitIDs: explicitIDs, interceptPositioned: schema.interceptPosition, queries: make(map[*sql.Stmt]string), kept: make(map[*sql.Stmt][]int)}
+	for _, p := range []struct {
+		stmt       **sql.Stmt
+		table      string
+		columns    []rowColumn
+		explicitID bool
+	}{
+		{&s.rawResponse, schema.responseRawSchema + "." + prefix + "responses_raw", rawColumns, false},
+		{&s.response, prefix + "responses", responseColumns, true},
+		{&s.rawRequest, schema.rawSchema + "." + prefix + "requests_raw", rawColumns, false},
+		{&s.request, prefix + "requests", requestColumns, true},
+	} {
+		columns := p.columns
+		if explicitIDs && p.explicitID {
+			columns = append([]rowColumn{{"id", true}}, columns...)
+		}
+		query, kept, err := insertSQL(ctx, db, p.table, columns)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if !schema.returning {
+			query = strings.TrimSuffix(query, " RETURNING id")
+		}
+		stmt, err := s.prepare(ctx, db, query)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to prepare statement %q: %w", query, err)
+		}
+		if kept != nil {
+			s.kept[stmt] = kept
+		}
+		*p.stmt = stmt
+	}
+
+	query := fmt.Sprintf(insertInterceptSQL, prefix)
+	if schema.interceptPosition {
+		query = fmt.Sprintf(insertPositionedInterceptSQL, prefix)
+	}
+	if !schema.returning {
+		query = strings.TrimSuffix(query, " RETURNING id")
+	}
+	var err error
+	if s.intercept, err = s.prepare(ctx, db, query); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to prepare statement %q: %w", query, err)
+	}
+	return s, nil
+}
+
+// insertSQL builds the insert of columns into table from the columns the
+// table has, as Caido versions add and drop some of them. Optional columns
+// the table lacks are left out, and columns it requires that the importer
+// does not set are given empty values, both with a note in the log. It fails
+// if the table lacks a required column. kept lists the indexes of the columns
+// inserted, or is nil if all of them are.
+func insertSQL(ctx context.Context, db *sql.DB, table string, columns []rowColumn) (query string, kept []int, err error) {
+	info, err := readTableInfo(ctx, db, table)
+	if err != nil {
+		return "", nil, err
+	}
+	if info == nil {
+		return "", nil, fmt.Errorf("project has no %s table", table)
+	}
+
+	var names, values, missing []string
+	for i, column := range columns {
+		if !info.columns[column.name] {
+			if column.required {
+				return "", nil, fmt.Errorf("%s has no %s column", table, column.name)
+			}
+			missing = append(missing, column.name)
+			continue
+		}
+		names = append(names, column.name)
+		values = append(values, "?")
+		kept = append(kept, i)
+	}
+	if len(missing) > 0 {
+		log.Printf("[INFO] %s has no %s column; inserting rows without it", table, strings.Join(missing, ", "))
+	} else {
+		kept = nil
+	}
+
+	var unmapped []string
+	for name, zero := range info.required {
+		if !slices.Contains(names, name) && name != "id" {
+			unmapped = append(unmapped, name)
+			names = append(names, quoteIdentifier(name))
+			values = append(values, zero)
+		}
+	}
+	if len(unmapped) > 0 {
+		slices.Sort(unmapped)
+		log.Printf("[INFO] %s requires %s, which the importer does not set; inserting empty values", table, strings.Join(unmapped, ", "))
+	}
+	query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id", table, strings.Join(names, ", "), strings.Join(values, ", "))
+	return query, kept, nil
+}
+
+// prepare prepares query against db, keeping its SQL for -emit-sql.
+func (s *statements) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	stmt, err := db.PrepareContext(ctx, query)
+	if err == nil {
+		s.queries[stmt] = query
+	}
+	return stmt, err
+}
+
+// insert runs one of the insert statements and returns the new row's id.
+func (s *statements) insert(ctx context.Context, stmt *sql.Stmt, args ...any) (int64, error) {
+	if kept, ok := s.kept[stmt]; ok {
+		values := make([]any, len(kept))
+		for i, k := range kept {
+			values[i] = args[k]
+		}
+		args = values
+	}
+	var id int64
+	if !s.returning {
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return 0, err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	} else if err := stmt.QueryRowContext(ctx, args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	// A script has no use for the ids, which later statements give as
+	// literals.
+	s.emit.statement(strings.TrimSuffix(s.queries[stmt], " RETURNING id"), args)
+	return id, nil
+}
+
+// exec runs one of the statements that return no id.
+func (s *statements) exec(ctx context.Context, stmt *sql.Stmt, args ...any) error {
+	if _, err := stmt.ExecContext(ctx, args...); err != nil {
+		return err
+	}
+	s.emit.statement(s.queries[stmt], args)
+	return nil
+}
+
+// supportsReturning reports whether the SQLite library supports the RETURNING
+// clause (added in SQLite 3.35), by trying it on a temporary table.
+func supportsReturning(db *sql.DB) bool {
+	defer db.Exec("DROP TABLE IF EXISTS temp.csv_import_returning_check")
+	if _, err := db.Exec("CREATE TEMP TABLE csv_import_returning_check (x)"); err != nil {
+		return false
+	}
+	var x int
+	err := db.QueryRow("INSERT INTO temp.csv_import_returning_check (x) VALUES (1) RETURNING x").Scan(&x)
+	return err == nil
+}
+
+// bind returns a copy of s whose statements run within tx. The copies are
+// closed when tx ends.
+func (s *statements) bind(tx *sql.Tx) *statements {
+	b := *s
+	b.queries = make(map[*sql.Stmt]string, len(s.queries))
+	b.kept = make(map[*sql.Stmt][]int, len(s.kept))
+	for _, stmt := range []**sql.Stmt{&b.rawResponse, &b.response, &b.rawRequest, &b.metadata, &b.request, &b.intercept, &b.extension, &b.mapID, &b.mapParent, &b.tag, &b.traceSource, &b.requestSession, &b.responseSession} {
+		if *stmt != nil {
+			query, ok := s.queries[*stmt]
+			kept, isKept := s.kept[*stmt]
+			*stmt = tx.Stmt(*stmt)
+			if ok {
+				b.queries[*stmt] = query
+			}
+			if isKept {
+				b.kept[*stmt] = kept
+			}
+		}
+	}
+	return &b
+}
+
+// Close releases the prepared statements.
+func (s *statements) Close() {
+	for _, stmt := range []*sql.Stmt{s.rawResponse, s.response, s.rawRequest, s.metadata, s.request, s.intercept, s.extension, s.mapID, s.mapParent, s.tag, s.traceSource, s.requestSession, s.responseSession} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// SQL for -tag in projects whose requests_metadata has no label column; see
+// prepareMetadata for the others. The tag is kept in csv_import_tags, whose
+// id is the id of the tagged request.
+const (
+	createTagTableSQL = `
+		CREATE TABLE IF NOT EXISTS csv_import_tags (
+			id INTEGER PRIMARY KEY REFERENCES requests(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL
+		)`
+	insertTagSQL = "INSERT OR REPLACE INTO csv_import_tags (id, tag) VALUES (?, ?)"
+)
+
+// prepareTag sets up storing Options.Tag for every imported request. It must
+// run after prepareMetadata, which writes the tag to the metadata's label
+// column when there is one.
+func (c *Converter) prepareTag(ctx context.Context, stmts *statements) error {
+	if stmts.metadataTagged {
+		log.Printf("[INFO] Tagging requests with label %q", c.opts.Tag)
+		return nil
+	}
+
+	if _, err := c.db.ExecContext(ctx, createTagTableSQL); err != nil {
+		return fmt.Errorf("failed to create csv_import_tags: %w", err)
+	}
+	c.emit.statement(createTagTableSQL, nil)
+	var err error
+	if stmts.tag, err = stmts.prepare(ctx, c.db, insertTagSQL); err != nil {
+		return err
+	}
+	log.Printf("[INFO] requests_metadata has no label column; tagging requests with %q in csv_import_tags", c.opts.Tag)
+	return nil
+}
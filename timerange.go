@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Defaults of -min-time and -max-time: timestamps before 2000 or more than a
+// day ahead are taken to be wrong, such as the epoch for an unparsable
+// value, or to be in another unit than milliseconds. timeRangeNone turns
+// either bound off.
+const (
+	defaultMinTime = "2000-01-01T00:00:00Z"
+	maxTimeAhead   = 24 * time.Hour
+	timeRangeNone  = "none"
+)
+
+// timeUnits are the units created_at values out of range are tried in, with
+// the factor converting them to milliseconds or, if negative, dividing them.
+var timeUnits = []struct {
+	name   string
+	factor int64
+}{
+	{"seconds", 1000},
+	{"microseconds", -1000},
+	{"nanoseconds", -1000000},
+}
+
+// checkTimes enforces Options.MinTime and MaxTime on a record's CreatedAt,
+// and ResponseCreatedAt if it has a response. A value in the range once
+// read as seconds, microseconds or nanoseconds is converted to
+// milliseconds; other values out of range are kept and counted, with a
+// warning for the first of each column. Under Strict, either fails the row
+// instead.
+func (c *Converter) checkTimes(record *CSVRecord) error {
+	if err := c.checkTime("created_at", &record.CreatedAt); err != nil {
+		return err
+	}
+	if len(record.ResponseRaw) == 0 && record.ResponseCreatedAt == 0 {
+		return nil
+	}
+	return c.checkTime("response_created_at", &record.ResponseCreatedAt)
+}
+
+// checkTime is checkTimes for the column named column.
+func (c *Converter) checkTime(column string, ms *int64) error {
+	if c.inTimeRange(*ms) {
+		return nil
+	}
+	for _, unit := range timeUnits {
+		var converted int64
+		switch {
+		case unit.factor < 0:
+			converted = *ms / -unit.factor
+		case *ms > math.MaxInt64/unit.factor || *ms < math.MinInt64/unit.factor:
+			continue
+		default:
+			converted = *ms * unit.factor
+		}
+		if converted == 0 || !c.inTimeRange(converted) {
+			continue
+		}
+		if c.opts.Strict {
+			return fmt.Errorf("%s %d is outside -min-time/-max-time, and appears to be in %s", column, *ms, unit.name)
+		}
+		key := column + " " + unit.name
+		if !c.warnedTimeUnits[key] {
+			log.Printf("[WARN] %s values such as %d appear to be in %s; converting them to milliseconds", column, *ms, unit.name)
+			if c.warnedTimeUnits == nil {
+				c.warnedTimeUnits = make(map[string]bool)
+			}
+			c.warnedTimeUnits[key] = true
+		}
+		*ms = converted
+		return nil
+	}
+	if c.opts.Strict {
+		return fmt.Errorf("%s %d (%s) is outside -min-time/-max-time", column, *ms, time.UnixMilli(*ms).UTC().Format(time.RFC3339))
+	}
+	c.stats.timesOutOfRange++
+	key := column + " out of range"
+	if !c.warnedTimeUnits[key] {
+		log.Printf("[WARN] %s values such as %d (%s) are outside -min-time/-max-time; keeping them", column, *ms, time.UnixMilli(*ms).UTC().Format(time.RFC3339))
+		if c.warnedTimeUnits == nil {
+			c.warnedTimeUnits = make(map[string]bool)
+		}
+		c.warnedTimeUnits[key] = true
+	}
+	return nil
+}
+
+// logTimeRange reports how many timestamps outside Options.MinTime and
+// MaxTime were kept.
+func (c *Converter) logTimeRange() {
+	if c.stats.timesOutOfRange > 0 {
+		log.Printf("[INFO] Kept %d timestamps outside -min-time/-max-time", c.stats.timesOutOfRange)
+	}
+}
+
+// inTimeRange reports whether ms, in milliseconds since the epoch, is within
+// Options.MinTime and MaxTime.
+func (c *Converter) inTimeRange(ms int64) bool {
+	if !c.opts.MinTime.IsZero() && ms < c.opts.MinTime.UnixMilli() {
+		return false
+	}
+	if !c.opts.MaxTime.IsZero() && ms > c.opts.MaxTime.UnixMilli() {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTimeRangeWarnsOnce imports rows whose timestamps are all 0, which are
+// kept with one warning per column and counted.
+func TestTimeRangeWarnsOnce(t *testing.T) {
+	const rows = 5
+	var b strings.Builder
+	b.WriteString("#caido-csv v2\nhost,method,path,port,raw,created_at,response_raw,response_created_at\n")
+	request := base64.StdEncoding.EncodeToString([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	response := base64.StdEncoding.EncodeToString([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&b, "example.com,GET,/,443,%s,0,%s,0\n", request, response)
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	c, err := NewConverter(newTestProject(t), Options{MinTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Import(context.Background(), writeTestFile(t, "epoch.csv", b.String()), "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(logged.String(), "outside -min-time/-max-time"); n != 2 {
+		t.Errorf("logged %d warnings, want one for each column:\n%s", n, logged.String())
+	}
+	if c.stats.timesOutOfRange != 2*rows {
+		t.Errorf("counted %d timestamps out of range, want %d", c.stats.timesOutOfRange, 2*rows)
+	}
+}
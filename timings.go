@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Timings is the time an import spent in each of its phases, across all of a
+// Converter's Import calls. Whatever is not covered, such as -rate waits and
+// sorting, is the rest of Stats.Duration.
+type Timings struct {
+	// Parse covers reading and decoding rows of the input.
+	Parse      time.Duration
+	Normalize  time.Duration
+	Responses  time.Duration
+	Requests   time.Duration
+	Intercepts time.Duration
+	// Commits covers committing -commit-every batches.
+	Commits     time.Duration
+	Checkpoints time.Duration
+}
+
+// addSince adds the time elapsed since start to total. It is meant to be
+// deferred with time.Now() as start.
+func addSince(total *time.Duration, start time.Time) {
+	*total += time.Since(start)
+}
+
+// logTimings logs how the duration of an import divides into its phases.
+func logTimings(stats Stats) {
+	t := stats.Timings
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"parsing", t.Parse},
+		{"normalizing", t.Normalize},
+		{"responses", t.Responses},
+		{"requests", t.Requests},
+		{"intercept entries", t.Intercepts},
+		{"commits", t.Commits},
+		{"checkpoints", t.Checkpoints},
+	}
+	other := stats.Duration
+	parts := make([]string, 0, len(phases)+1)
+	for _, p := range phases {
+		other -= p.d
+		parts = append(parts, formatPhase(p.name, p.d, stats.Duration))
+	}
+	parts = append(parts, formatPhase("other", max(other, 0), stats.Duration))
+	log.Printf("[INFO] Time spent in %v: %s", stats.Duration.Round(time.Millisecond), strings.Join(parts, ", "))
+}
+
+// formatPhase formats the time spent in a phase with its share of total.
+func formatPhase(name string, d, total time.Duration) string {
+	share := 0.0
+	if total > 0 {
+		share = 100 * float64(d) / float64(total)
+	}
+	return fmt.Sprintf("%s %v (%.1f%%)", name, d.Round(time.Microsecond), share)
+}
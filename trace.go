@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// SQL for -trace-source. The input and line each request was read from are
+// kept in csv_import_sources, whose id is the id of the request, as
+// requests_metadata has no columns for them.
+const (
+	createSourceTableSQL = `
+		CREATE TABLE IF NOT EXISTS csv_import_sources (
+			id INTEGER PRIMARY KEY REFERENCES requests(id) ON DELETE CASCADE,
+			input TEXT NOT NULL,
+			line INTEGER NOT NULL
+		)`
+	insertSourceSQL = "INSERT OR REPLACE INTO csv_import_sources (id, input, line) VALUES (?, ?, ?)"
+)
+
+// prepareTraceSource sets up recording the input and line of every imported
+// request for Options.TraceSource.
+func (c *Converter) prepareTraceSource(ctx context.Context, stmts *statements) error {
+	if _, err := c.db.ExecContext(ctx, createSourceTableSQL); err != nil {
+		return fmt.Errorf("failed to create csv_import_sources: %w", err)
+	}
+	c.emit.statement(createSourceTableSQL, nil)
+	var err error
+	if stmts.traceSource, err = stmts.prepare(ctx, c.db, insertSourceSQL); err != nil {
+		return err
+	}
+	log.Println("[INFO] Recording the input line of each request in csv_import_sources")
+	return nil
+}
+
+// traceSource records the input and line the request was read from, when
+// Options.TraceSource is set.
+func (c *Converter) traceSource(ctx context.Context, requestID int64, record CSVRecord) error {
+	if c.stmts.traceSource == nil {
+		return nil
+	}
+	if err := c.stmts.exec(ctx, c.stmts.traceSource, requestID, record.input, record.line); err != nil {
+		return fmt.Errorf("failed to insert into csv_import_sources: %w", err)
+	}
+	c.track("csv_import_sources", requestID)
+	return nil
+}
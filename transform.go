@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// transformFields lists the record fields a transform rule may rewrite.
+var transformFields = []string{"host", "path", "query", "port"}
+
+// transform is a single -transform rule: a literal or regular expression
+// replacement applied to one field of every record.
+type transform struct {
+	field   string
+	pattern *regexp.Regexp
+	repl    string
+}
+
+// parseTransform parses a rule of the form field=s/regex/replacement/ or
+// field=r/old/new/. With s the pattern is a Go regular expression and the
+// replacement may refer to groups as $1; with r both sides are literal
+// strings. The delimiter is the character after s or r, so host=s|a/b|c|
+// works for values containing slashes.
+func parseTransform(rule string) (transform, error) {
+	field, expr, found := strings.Cut(rule, "=")
+	if !found {
+		return transform{}, fmt.Errorf("expected field=expr, got %q", rule)
+	}
+	field = strings.ToLower(strings.TrimSpace(field))
+	known := false
+	for _, f := range transformFields {
+		known = known || f == field
+	}
+	if !known {
+		return transform{}, fmt.Errorf("unsupported field %q: must be one of %s", field, strings.Join(transformFields, ", "))
+	}
+
+	if len(expr) < 2 || (expr[0] != 's' && expr[0] != 'r') {
+		return transform{}, fmt.Errorf("expression %q must start with s or r and a delimiter", expr)
+	}
+	delim := expr[1:2]
+	parts := strings.Split(expr[2:], delim)
+	if len(parts) != 3 || parts[2] != "" || parts[0] == "" {
+		return transform{}, fmt.Errorf("expression %q must have the form %s%sold%snew%s", expr, expr[:1], delim, delim, delim)
+	}
+
+	pattern, repl := parts[0], parts[1]
+	if expr[0] == 'r' {
+		pattern, repl = regexp.QuoteMeta(pattern), strings.ReplaceAll(repl, "$", "$$")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return transform{}, fmt.Errorf("invalid pattern in %q: %w", expr, err)
+	}
+	return transform{field: field, pattern: re, repl: repl}, nil
+}
+
+// apply rewrites the rule's field in record.
+func (t transform) apply(record *CSVRecord) error {
+	switch t.field {
+	case "host":
+		record.Host = t.pattern.ReplaceAllString(record.Host, t.repl)
+	case "path":
+		record.Path = t.pattern.ReplaceAllString(record.Path, t.repl)
+	case "query":
+		record.Query = t.pattern.ReplaceAllString(record.Query, t.repl)
+	case "port":
+		port := t.pattern.ReplaceAllString(strconv.Itoa(record.Port), t.repl)
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("transform on port produced %q, not a number", port)
+		}
+		record.Port = n
+	}
+	return nil
+}
+
+// transformList collects repeated -transform flags.
+type transformList []transform
+
+func (l *transformList) String() string {
+	if l == nil || len(*l) == 0 {
+		return ""
+	}
+	return fmt.Sprint(len(*l), " rules")
+}
+
+func (l *transformList) Set(rule string) error {
+	t, err := parseTransform(rule)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, t)
+	return nil
+}
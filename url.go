@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// fetchTimeout bounds connecting to a -f URL and waiting for its response
+// headers. The body is then streamed for as long as the import takes, which
+// -timeout limits.
+const fetchTimeout = 30 * time.Second
+
+// isURL reports whether an input path is an http or https URL.
+func isURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// ImportFromURL downloads CSV or, with format "jsonl" or "burp-xml", JSON
+// Lines or Burp Suite XML from an http or https URL and imports it as it arrives, without saving it first.
+// Gzip-compressed bodies are decompressed. Zip archives need random access,
+// so they cannot be read from a URL. Like ImportFromCSV, it returns the
+// converter's Stats.
+func (c *Converter) ImportFromURL(ctx context.Context, rawURL, format string) (Stats, error) {
+	start := time.Now()
+	err := c.importURL(ctx, rawURL, format)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importURL(ctx context.Context, rawURL, format string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if strings.EqualFold(path.Ext(u.Path), ".zip") {
+		return fmt.Errorf("zip archives cannot be imported from a URL; download %s first", rawURL)
+	}
+
+	body, err := c.fetch(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if format == "jsonl" {
+		return c.importJSONLReader(ctx, body)
+	}
+	if format == burpFormat {
+		return c.importBurpXMLReader(ctx, body)
+	}
+	return c.importCSVReader(ctx, body)
+}
+
+// fetch requests u and returns its body, decompressed if it is gzipped. The
+// server's certificate is not checked with Options.Insecure.
+func (c *Converter) fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: fetchTimeout}).DialContext
+	transport.TLSHandshakeTimeout = fetchTimeout
+	transport.ResponseHeaderTimeout = fetchTimeout
+	if c.opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "caido-importer/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching input: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error fetching input: %s returned %s", u.Redacted(), resp.Status)
+	}
+
+	// Files such as export.csv.gz are served as they are, rather than with
+	// a Content-Encoding the transport would undo, so the body is checked
+	// for the gzip magic number.
+	buffered := bufio.NewReader(resp.Body)
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("error decompressing input: %v", err)
+		}
+		return readCloser{zr, resp.Body}, nil
+	}
+	return readCloser{buffered, resp.Body}, nil
+}
+
+// readCloser reads from a reader layered over a body and closes the body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// flagGroups orders the flags in the -help output. Flags missing from every
+// group are listed under "Other" so none are hidden.
+var flagGroups = []struct {
+	title string
+	flags []string
+}{
+	{"Input", []string{"f", "insecure", "format", "retry", "columns", "strict-columns", "raw-encoding", "trim-cr", "split-raw", "response-only", "sort-by", "latest-response", "fail-on-empty", "fail-on-mismatch", "validate", "selftest", "diff", "emit-sql", "gen", "gen-body-size", "print-fields"}},
+	{"Database", []string{"p", "route", "route-parallel", "init", "force", "replace", "fix-sequences", "table-prefix", "promote", "key", "raw-db", "safe", "session", "atomic", "readonly-check", "validate-schema-only", "mode", "store-extensions", "extension-source", "update-scope", "undo", "export"}},
+	{"Filtering and rewriting", []string{"since", "until", "min-time", "max-time", "strict", "max-errors", "limit-hosts", "spec", "validate-raw", "strict-method", "method-passthrough", "tolerate-response-errors", "unique-id", "state", "dedup", "dedup-expected", "dedup-fp-rate", "port-default", "max-raw-bytes", "max-field-bytes", "oversize-policy", "compress-raw", "raw-precompressed", "dechunk", "no-raw", "normalize-host", "canonical-host", "normalize-query", "transform", "redact", "map-source", "map-alteration", "strict-alteration", "edited-default", "trust-status", "check-lengths", "remap-parents", "defer-parents", "preserve-ids", "tag", "trace-source"}},
+	{"Performance", []string{"commit-every", "resume", "tx-mode", "checkpoint-every", "fast-unsafe", "reopen", "rate", "timeout", "timings", "cpuprofile", "memprofile"}},
+	{"Output", []string{"verbose", "log", "errors", "manifest"}},
+}
+
+// usageExamples is a format string taking the program name.
+const usageExamples = `Examples:
+  Import an export into a project:
+    %[1]s -p ~/.local/share/caido/projects/<id> -f export.csv
+
+  Check a file without touching a project:
+    %[1]s -validate -f export.csv
+
+  Import into a copy of a closed project, keeping a manifest for -undo:
+    %[1]s -p <project> -f export.zip -atomic -manifest import.json
+
+  Import a large export in batches, picking up after the last committed
+  batch (recorded in the project's csv_import_progress table) if rerun:
+    %[1]s -p <project> -f export.csv -commit-every 10000 -resume
+`
+
+// usage prints the flags grouped by category, followed by examples.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: %s -p PROJECT -f FILE [options]\n\n", filepath.Base(flag.CommandLine.Name()))
+	fmt.Fprintln(w, "Imports HTTP history from a CSV or JSON Lines export into a Caido project.")
+
+	listed := make(map[string]bool)
+	for _, group := range flagGroups {
+		fmt.Fprintf(w, "\n%s:\n", group.title)
+		for _, name := range group.flags {
+			if f := flag.Lookup(name); f != nil {
+				printFlag(w, f)
+				listed[name] = true
+			}
+		}
+	}
+
+	var other []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !listed[f.Name] {
+			other = append(other, f)
+		}
+	})
+	if len(other) > 0 {
+		fmt.Fprintln(w, "\nOther:")
+		for _, f := range other {
+			printFlag(w, f)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, usageExamples, filepath.Base(flag.CommandLine.Name()))
+}
+
+// printFlag writes one flag in the layout of flag.PrintDefaults.
+func printFlag(w io.Writer, f *flag.Flag) {
+	name, text := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	line += "\n    \t" + strings.ReplaceAll(text, "\n", "\n    \t")
+	switch f.DefValue {
+	case "", "0", "false", "0s":
+	default:
+		line += fmt.Sprintf(" (default %q)", f.DefValue)
+	}
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// VerifyCount checks that the requests the import counted as inserted are
+// in the project, to catch inserts that failed without being reported. It
+// counts the requests with the ids the import recorded inserting, run by
+// run, so rows that were already in the project between them, as with
+// Options.PreserveIDs, are not counted. With Options.Tag, only the requests
+// carrying the tag are counted. The projects of Options.Routes are checked
+// too. It logs the result and returns an error describing any discrepancy.
+func (c *Converter) VerifyCount(ctx context.Context) error {
+	for _, target := range append([]*Converter{c}, c.routes.targets(c)...) {
+		if err := target.verifyCount(ctx); err != nil {
+			if target != c {
+				err = fmt.Errorf("%s: %w", target.projectPath, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Converter) verifyCount(ctx context.Context) error {
+	expected := c.stats.requestsInserted
+	r, ok := c.stats.ids["requests"]
+	if !ok {
+		if expected > 0 {
+			return fmt.Errorf("%d requests were counted as inserted, but none were recorded", expected)
+		}
+		return nil
+	}
+
+	table := c.stagedTable("requests", c.opts.TablePrefix)
+	query := "SELECT count(*) FROM " + table + " r"
+	var args []any
+	how := ""
+	if c.opts.Tag != "" {
+		columns, err := tableColumns(ctx, c.db, "requests_metadata")
+		if err != nil {
+			return err
+		}
+		switch {
+		case columns["label"] && !c.metadataFailed:
+			query += " JOIN requests_metadata m ON m.id = r.metadata_id AND m.label = ?"
+			args = append(args, c.opts.Tag)
+			how = fmt.Sprintf(" with label %q", c.opts.Tag)
+		case !columns["label"]:
+			query += " JOIN csv_import_tags t ON t.id = r.id AND t.tag = ?"
+			args = append(args, c.opts.Tag)
+			how = fmt.Sprintf(" tagged %q", c.opts.Tag)
+		}
+	}
+	query += " WHERE r.id BETWEEN ? AND ?"
+
+	var found int
+	for _, run := range r.Runs {
+		var n int
+		if err := c.db.QueryRowContext(ctx, query, append(args, run[0], run[1])...).Scan(&n); err != nil {
+			return fmt.Errorf("failed to count the imported requests: %w", err)
+		}
+		found += n
+	}
+	if found != expected {
+		return fmt.Errorf("%d requests were counted as inserted, but %d%s of the inserted ids (%d-%d) are in %s", expected, found, how, r.First, r.Last, table)
+	}
+	log.Printf("[INFO] Verified that the %d inserted requests are in %s", expected, c.projectPath)
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestVerifyCountInterleaved verifies an import whose preserved ids surround
+// a request it did not insert, which must not be counted.
+func TestVerifyCountInterleaved(t *testing.T) {
+	project := newTestProject(t)
+	opts := Options{PreserveIDs: true}
+	importTestCSV(t, project, writeTestFile(t, "other.csv", preservedCSV(11)), opts)
+
+	c, err := NewConverter(project, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Import(context.Background(), writeTestFile(t, "verified.csv", preservedCSV(10, 12)), "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyCount(context.Background()); err != nil {
+		t.Errorf("VerifyCount: %v", err)
+	}
+}
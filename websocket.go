@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tables of Caido's WebSocket history: a streams row for each connection,
+// a stream_ws_messages row for each frame, and the frame's payload in
+// stream_ws_messages_raw next to the other raw tables. Projects of versions
+// that do not record WebSockets lack them.
+const (
+	wsStreamsTable  = "streams"
+	wsMessagesTable = "stream_ws_messages"
+	wsRawTable      = "stream_ws_messages_raw"
+)
+
+// wsCSVColumns are the columns of a ws-csv file, identified by the names in
+// its header row. payload is encoded like the raw column.
+var wsCSVColumns = []string{"request_id", "direction", "opcode", "payload", "created_at"}
+
+// wsFrame is a WebSocket frame read from a ws-csv row.
+type wsFrame struct {
+	requestID int64
+	// direction is "client" for frames sent by the client and "server" for
+	// those it received.
+	direction string
+	// format is the frame's opcode by name, e.g. "text".
+	format    string
+	payload   []byte
+	createdAt int64
+}
+
+// wsOpcodes maps the opcodes of RFC 6455 frames to the format stored for
+// them.
+var wsOpcodes = map[int]string{1: "text", 2: "binary", 8: "close", 9: "ping", 10: "pong"}
+
+// parseWSFrame converts a ws-csv row, with field returning the value of a
+// named column, into a wsFrame. A blank opcode is text and a blank
+// created_at the current time.
+func parseWSFrame(field func(string) string, encoding string) (wsFrame, error) {
+	var f wsFrame
+	id, err := strconv.ParseInt(field("request_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return f, fmt.Errorf("invalid request_id %q", field("request_id"))
+	}
+	f.requestID = id
+
+	switch d := strings.ToLower(field("direction")); d {
+	case "client", "send", "outgoing":
+		f.direction = "client"
+	case "server", "receive", "incoming":
+		f.direction = "server"
+	default:
+		return f, fmt.Errorf("invalid direction %q: must be client or server", field("direction"))
+	}
+
+	f.format = "text"
+	if opcode := strings.ToLower(field("opcode")); opcode != "" {
+		n, err := strconv.Atoi(opcode)
+		switch {
+		case err == nil && wsOpcodes[n] != "":
+			f.format = wsOpcodes[n]
+		case err != nil && (opcode == "text" || opcode == "binary" || opcode == "close" || opcode == "ping" || opcode == "pong"):
+			f.format = opcode
+		default:
+			return f, fmt.Errorf("invalid opcode %q", field("opcode"))
+		}
+	}
+
+	if f.payload, err = decodeRaw(field("payload"), encoding); err != nil {
+		return f, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	f.createdAt = time.Now().UnixMilli()
+	if s := field("created_at"); s != "" {
+		if f.createdAt, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid created_at %q", s)
+		}
+	}
+	return f, nil
+}
+
+// insert inserts a row of the values of the table's columns among values,
+// with empty values for any other column that requires one, and returns its
+// id.
+func (t *tableInfo) insert(ctx context.Context, q queryer, values map[string]any) (int64, error) {
+	var names, placeholders []string
+	var args []any
+	for column, value := range values {
+		if t.columns[column] {
+			names = append(names, quoteIdentifier(column))
+			placeholders = append(placeholders, "?")
+			args = append(args, value)
+		}
+	}
+	for column, zero := range t.required {
+		if _, ok := values[column]; !ok {
+			names = append(names, quoteIdentifier(column))
+			placeholders = append(placeholders, zero)
+		}
+	}
+	res, err := q.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.name, strings.Join(names, ", "), strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// wsImport holds the tables of a WebSocket import and the stream opened for
+// each request so far.
+type wsImport struct {
+	streams, messages, raw *tableInfo
+	streamIDs              map[int64]int64
+}
+
+// prepareWSImport reads the WebSocket tables of the project. It returns nil
+// if the project has none of them, or lacks the columns linking frames to
+// their stream and payload.
+func (c *Converter) prepareWSImport(ctx context.Context) (*wsImport, error) {
+	w := &wsImport{streamIDs: make(map[int64]int64)}
+	var err error
+	if w.streams, err = readTableInfo(ctx, c.db, wsStreamsTable); err != nil {
+		return nil, err
+	}
+	if w.messages, err = readTableInfo(ctx, c.db, wsMessagesTable); err != nil {
+		return nil, err
+	}
+	if w.raw, err = readTableInfo(ctx, c.db, c.schema.rawSchema+"."+wsRawTable); err != nil {
+		return nil, err
+	}
+	if w.streams == nil || w.messages == nil || w.raw == nil {
+		return nil, nil
+	}
+	for _, column := range []string{"stream_id", "raw_id"} {
+		if !w.messages.columns[column] {
+			log.Printf("[WARN] %s has no %s column", wsMessagesTable, column)
+			return nil, nil
+		}
+	}
+	if !w.raw.columns["data"] {
+		log.Printf("[WARN] %s has no data column", wsRawTable)
+		return nil, nil
+	}
+	return w, nil
+}
+
+// streamFor returns the stream of the WebSocket connection upgraded by the
+// request with the given id, inserting it with the request's host, port,
+// path and TLS flag the first time.
+func (c *Converter) streamFor(ctx context.Context, w *wsImport, requestID int64) (int64, error) {
+	if id, ok := w.streamIDs[requestID]; ok {
+		return id, nil
+	}
+	var host, path string
+	var port int
+	var isTLS bool
+	var createdAt int64
+	err := c.conn().QueryRowContext(ctx, "SELECT host, port, path, is_tls, created_at FROM requests WHERE id = ?", requestID).
+		Scan(&host, &port, &path, &isTLS, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, withReason(reasonInvalid, fmt.Errorf("request %d is not in the project", requestID))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading request %d: %v", requestID, err)
+	}
+	id, err := w.streams.insert(ctx, c.conn(), map[string]any{
+		"request_id": requestID,
+		"host":       host,
+		"port":       port,
+		"path":       path,
+		"is_tls":     isTLS,
+		"protocol":   "ws",
+		"direction":  "both",
+		"source":     "import",
+		"created_at": createdAt,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert stream: %w", err)
+	}
+	c.track(wsStreamsTable, id)
+	w.streamIDs[requestID] = id
+	return id, nil
+}
+
+// insertFrame inserts a frame's payload and message, and the stream of its
+// request if needed, in one savepoint.
+func (c *Converter) insertFrame(ctx context.Context, w *wsImport, f wsFrame) error {
+	_, opened := w.streamIDs[f.requestID]
+	err := c.withSavepoint(ctx, "csv_import_ws", func() error {
+		streamID, err := c.streamFor(ctx, w, f.requestID)
+		if err != nil {
+			return err
+		}
+		rawID, err := w.raw.insert(ctx, c.conn(), map[string]any{"data": f.payload})
+		if err != nil {
+			return fmt.Errorf("failed to insert payload: %w", err)
+		}
+		c.track("raw."+wsRawTable, rawID)
+		messageID, err := w.messages.insert(ctx, c.conn(), map[string]any{
+			"stream_id":  streamID,
+			"raw_id":     rawID,
+			"direction":  f.direction,
+			"format":     f.format,
+			"length":     len(f.payload),
+			"edited":     false,
+			"alteration": "none",
+			"created_at": f.createdAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to insert message: %w", err)
+		}
+		c.track(wsMessagesTable, messageID)
+		return nil
+	})
+	if err != nil && !opened {
+		// A stream opened for the frame was rolled back with it.
+		delete(w.streamIDs, f.requestID)
+	}
+	return err
+}
+
+// ImportFromWebSocketCSV imports the WebSocket frames of a ws-csv file, one
+// per row, into the project's WebSocket tables; see wsCSVColumns. Frames of
+// the same request_id share a stream, opened for the request with that id
+// in the project. A project without WebSocket tables is left untouched with
+// a warning. Like ImportFromCSV, it returns the converter's Stats.
+func (c *Converter) ImportFromWebSocketCSV(ctx context.Context, path string) (Stats, error) {
+	start := time.Now()
+	err := c.importWebSocketCSV(ctx, path)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importWebSocketCSV(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening CSV file: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading header from CSV: %v", err)
+	}
+	index := make(map[string]int)
+	var unknown []string
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		index[name] = i
+		if !slices.Contains(wsCSVColumns, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if c.opts.StrictColumns && len(unknown) > 0 {
+		return fmt.Errorf("header has unknown columns: %s", strings.Join(unknown, ", "))
+	}
+	for _, name := range []string{"request_id", "direction", "payload"} {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("header has no %s column", name)
+		}
+	}
+
+	var w *wsImport
+	if !c.validateOnly {
+		if w, err = c.prepareWSImport(ctx); err != nil {
+			return err
+		}
+		if w == nil {
+			log.Printf("[WARN] Project has no WebSocket tables (%s, %s and %s); skipping the WebSocket import", wsStreamsTable, wsMessagesTable, wsRawTable)
+			return nil
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("import stopped after inserting %d rows: %w", c.stats.rowsInserted, err)
+		}
+		if err := c.checkMaxErrors(); err != nil {
+			return err
+		}
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		c.stats.rowsRead++
+		if err != nil {
+			line := 0
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				line = parseErr.StartLine
+			}
+			log.Printf("Error reading record from CSV: %v", err)
+			c.failRow(line, nil, withReason(reasonParse, err))
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		source := c.csvSource(header, row)
+		if field, err := c.checkFieldSizes(row, header); err != nil {
+			fieldLine, _ := reader.FieldPos(field)
+			log.Printf("Error reading CSV record on line %d: %v", fieldLine, err)
+			c.failRow(line, source, withReason(reasonOversize, err))
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		frame, err := parseWSFrame(field, c.opts.RawEncodings.Request)
+		if err != nil {
+			log.Printf("Error parsing WebSocket frame on line %d: %v", line, err)
+			c.failRow(line, source, withReason(reasonParse, err))
+			continue
+		}
+		if c.validateOnly {
+			c.stats.rowsValid++
+			continue
+		}
+		if err := c.insertFrame(ctx, w, frame); err != nil {
+			log.Printf("Error inserting WebSocket frame on line %d: %v", line, err)
+			c.failRow(line, source, withReason(insertReason(err), err))
+			continue
+		}
+		c.stats.rowsInserted++
+	}
+}
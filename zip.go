@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportFromZip imports every *.csv entry of a zip archive, in name order,
+// logging the counts of each entry. Entries in subdirectories are included;
+// other files are ignored.
+func (c *Converter) ImportFromZip(ctx context.Context, archivePath string) (Stats, error) {
+	start := time.Now()
+	err := c.importZip(ctx, archivePath)
+	c.stats.duration += time.Since(start)
+	return c.Stats(), err
+}
+
+func (c *Converter) importZip(ctx context.Context, archivePath string) error {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening zip archive: %v", err)
+	}
+	defer archive.Close()
+
+	var entries []*zip.File
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() && strings.EqualFold(path.Ext(f.Name), ".csv") {
+			entries = append(entries, f)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	if len(entries) == 0 {
+		return fmt.Errorf("zip archive %s contains no .csv files", archivePath)
+	}
+
+	for _, f := range entries {
+		log.Printf("[INFO] Importing %s from %s", f.Name, archivePath)
+		c.input = archivePath + "/" + f.Name
+		before := c.Stats()
+		if err := c.importZipEntry(ctx, f); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		after := c.Stats()
+		log.Printf("[INFO] %s: %d rows read, %d inserted, %d skipped, %d failed", f.Name,
+			after.RowsRead-before.RowsRead, after.RowsInserted-before.RowsInserted,
+			after.RowsSkipped-before.RowsSkipped, after.RowsFailed-before.RowsFailed)
+	}
+	return nil
+}
+
+// importZipEntry imports one CSV file of an archive.
+func (c *Converter) importZipEntry(ctx context.Context, f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("error opening archive entry: %v", err)
+	}
+	defer r.Close()
+	return c.importCSVReader(ctx, r)
+}